@@ -0,0 +1,142 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// archiveWriter is the export output format; altName is a second
+// name for the same entry ("cert.pem" or "key.pem") or empty
+type archiveWriter interface {
+	appendFile(path string, name string, altName string, mode int64)
+	appendData(data []byte, name string, altName string, mode int64)
+	close()
+}
+
+// newArchiveWriter returns a writer for the "-archive-format" value;
+// owner is only recorded by tgz archives
+func newArchiveWriter(format string, w io.Writer, owner tarOwner) archiveWriter {
+	switch format {
+	case "tgz":
+		gz := gzip.NewWriter(w)
+		return &tgzArchive{gz: gz, tw: tar.NewWriter(gz), owner: owner}
+	case "zip":
+		return &zipArchive{zw: zip.NewWriter(w)}
+	}
+	usageLog.Fatalf("Invalid archive format %s (must be tgz or zip)", format)
+	return nil
+}
+
+type tgzArchive struct {
+	gz    *gzip.Writer
+	tw    *tar.Writer
+	owner tarOwner
+}
+
+func (a *tgzArchive) appendFile(path string, name string, altName string, mode int64) {
+	tarAppendFile(a.tw, a.owner, path, name, altName, mode)
+}
+
+func (a *tgzArchive) appendData(data []byte, name string, altName string, mode int64) {
+	tarAppendData(a.tw, a.owner, data, name, altName, mode)
+}
+
+// tarOwner is the ownership recorded in the tar headers, so that files
+// extracted as root (ie. by deployment tools) get the right owner
+type tarOwner struct {
+	uid, gid     int
+	uname, gname string
+}
+
+func (o tarOwner) apply(header *tar.Header) *tar.Header {
+	header.Uid, header.Gid = o.uid, o.gid
+	header.Uname, header.Gname = o.uname, o.gname
+	return header
+}
+
+// parseTarOwner parses the "-owner" uid:gid and "-owner-name" user:group
+// values (empty for the default of 0:0 without names)
+func parseTarOwner(owner string, ownerName string) tarOwner {
+	result := tarOwner{}
+	if owner != "" {
+		parts := strings.Split(owner, ":")
+		var uidErr, gidErr error
+		if len(parts) == 2 {
+			result.uid, uidErr = strconv.Atoi(parts[0])
+			result.gid, gidErr = strconv.Atoi(parts[1])
+		}
+		if len(parts) != 2 || uidErr != nil || gidErr != nil || result.uid < 0 || result.gid < 0 {
+			usageLog.Fatalf("Invalid owner %s (must be numeric uid:gid, ie. 0:0)", owner)
+		}
+	}
+	if ownerName != "" {
+		parts := strings.Split(ownerName, ":")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			usageLog.Fatalf("Invalid owner name %s (must be user:group, ie. root:root)", ownerName)
+		}
+		result.uname, result.gname = parts[0], parts[1]
+	}
+	return result
+}
+
+func (a *tgzArchive) close() {
+	if err := a.tw.Close(); err != nil {
+		errorLog.Fatalf("Failed to close tar file: %s", err)
+	}
+	if err := a.gz.Close(); err != nil {
+		errorLog.Fatalf("Failed to close gzip writer: %s", err)
+	}
+}
+
+// zipArchive stores the alternative name as a copy because zip files
+// don't have hard links
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) appendFile(path string, name string, altName string, mode int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		errorLog.Fatalf("Failed to read file metadata: %s", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		errorLog.Fatalf("Failed to open file: %s", path)
+	}
+	a.append(data, name, mode, info.ModTime())
+	if altName != "" {
+		a.append(data, altName, mode, info.ModTime())
+	}
+}
+
+func (a *zipArchive) appendData(data []byte, name string, altName string, mode int64) {
+	a.append(data, name, mode, runTime)
+	if altName != "" {
+		a.append(data, altName, mode, runTime)
+	}
+}
+
+func (a *zipArchive) append(data []byte, name string, mode int64, modTime time.Time) {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime}
+	header.SetMode(os.FileMode(mode))
+	w, err := a.zw.CreateHeader(header)
+	if err != nil {
+		errorLog.Fatalf("Failed to write zip header: %s", name)
+	}
+	if _, err = w.Write(data); err != nil {
+		errorLog.Fatalf("Failed to write zip file: %s", name)
+	}
+}
+
+func (a *zipArchive) close() {
+	if err := a.zw.Close(); err != nil {
+		errorLog.Fatalf("Failed to close zip file: %s", err)
+	}
+}
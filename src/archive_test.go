@@ -0,0 +1,50 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeLargeChain writes a pem file of about 1MB, ie. the chain of a
+// large batch export
+func writeLargeChain(b *testing.B) string {
+	b.Helper()
+	block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: make([]byte, 1024)})
+	data := []byte{}
+	for len(data) < 1<<20 {
+		data = append(data, block...)
+	}
+	fileName := filepath.Join(b.TempDir(), "chain.crt")
+	if err := os.WriteFile(fileName, data, publicPerms); err != nil {
+		b.Fatal(err)
+	}
+	return fileName
+}
+
+// BenchmarkTarAppendFile streams the file into the archive, so the
+// allocations don't depend on the file size
+func BenchmarkTarAppendFile(b *testing.B) {
+	fileName := writeLargeChain(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tw := tar.NewWriter(io.Discard)
+		tarAppendFile(tw, tarOwner{}, fileName, "chain.crt", "cert.pem", 0644)
+	}
+}
+
+// BenchmarkTarAppendData reads the whole file into memory first, which
+// is what export did before files were streamed
+func BenchmarkTarAppendData(b *testing.B) {
+	fileName := writeLargeChain(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tw := tar.NewWriter(io.Discard)
+		tarAppendData(tw, tarOwner{}, []byte(readFile(fileName)), "chain.crt", "cert.pem", 0644)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"os"
+	"time"
+)
+
+// auditEntry is one line of the audit log (json lines format)
+type auditEntry struct {
+	Time     string `json:"time"`
+	Command  string `json:"command"`
+	Path     string `json:"path"`
+	Subject  string `json:"subject"`
+	Serial   string `json:"serial"`
+	Operator string `json:"operator"`
+}
+
+// defaultOperator is the operator recorded in the audit log when the
+// "-operator" flag isn't provided
+func defaultOperator() string {
+	for _, env := range []string{"CERTSHOP_OPERATOR", "USER", "USERNAME"} {
+		if operator := os.Getenv(env); operator != "" {
+			return operator
+		}
+	}
+	return ""
+}
+
+// addAuditFlags adds the "-audit-log" and "-operator" flags to commands
+// which issue or remove certificates
+func addAuditFlags(fs *flag.FlagSet) (*string, *string) {
+	auditLog := fs.String("audit-log", "", "append a json line for each certificate issued or removed to this file")
+	operator := fs.String("operator", defaultOperator(), "operator name recorded in the audit log")
+	return auditLog, operator
+}
+
+// writeAuditLog appends an entry for the certificate issued (or removed
+// by prune) by command to the audit log once it has been saved (does
+// nothing if logPath is empty)
+func writeAuditLog(logPath string, command string, operator string, path string, derCert []byte) {
+	if logPath == "" {
+		return
+	}
+	cert, err := x509.ParseCertificate(derCert)
+	if err != nil {
+		errorLog.Fatalf("Failed to parse certificate for audit log: %s", err)
+	}
+	line, err := json.Marshal(auditEntry{
+		Time:     runTime.Format(time.RFC3339),
+		Command:  command,
+		Path:     path,
+		Subject:  formatDn(cert.Subject),
+		Serial:   cert.SerialNumber.Text(16),
+		Operator: operator,
+	})
+	if err != nil {
+		errorLog.Fatalf("Failed to marshall audit log entry: %s", err)
+	}
+
+	infoLog.Printf("Writing audit log entry to %s\n", logPath)
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, privatePerms)
+	if err != nil {
+		errorLog.Fatalf("Failed to open audit log %s: %s", logPath, err)
+	}
+	defer func() {
+		if err := logFile.Close(); err != nil {
+			errorLog.Fatalf("Failed to close audit log %s: %s", logPath, err)
+		}
+	}()
+	if err := lockFile(logFile); err != nil {
+		errorLog.Fatalf("Failed to lock audit log %s: %s", logPath, err)
+	}
+	defer func() {
+		if err := unlockFile(logFile); err != nil {
+			errorLog.Fatalf("Failed to unlock audit log %s: %s", logPath, err)
+		}
+	}()
+	if _, err := logFile.Write(append(line, '\n')); err != nil {
+		errorLog.Fatalf("Failed to write audit log %s: %s", logPath, err)
+	}
+}
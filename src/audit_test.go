@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	manifest := `{"certificates": [{"command": "client", "path": "ca/batch-client", "dn": "/CN=batch", "audit-log": "audit.log", "operator": "carol"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "batch.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	certshop(t, dir, "ca", "-dn=/CN=root", "-maxPathLength=1", "-audit-log=audit.log", "-operator=alice")
+	certshop(t, dir, "ica", "-dn=/CN=ica", "-audit-log=audit.log", "-operator=alice", "ca/ica")
+	certshop(t, dir, "server", "-dn=/CN=server", "-audit-log=audit.log", "-operator=bob", "ca/ica/server")
+	certshop(t, dir, "batch", filepath.Join(dir, "batch.json"))
+	// a failed creation (the certificate already exists) isn't logged
+	runCertshop(t, dir, nil, "server", "-dn=/CN=server", "-audit-log=audit.log", "ca/ica/server")
+
+	data, err := os.ReadFile(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	tests := []auditEntry{
+		{Command: "ca", Path: "ca", Subject: "/CN=root", Operator: "alice"},
+		{Command: "ica", Path: "ca/ica", Subject: "/CN=ica", Operator: "alice"},
+		{Command: "server", Path: "ca/ica/server", Subject: "/CN=server", Operator: "bob"},
+		{Command: "client", Path: "ca/batch-client", Subject: "/CN=batch", Operator: "carol"},
+	}
+	if len(lines) != len(tests) {
+		t.Fatalf("got %d audit log entries, want %d:\n%s", len(lines), len(tests), data)
+	}
+	for i, want := range tests {
+		entry := auditEntry{}
+		if err := json.Unmarshal(lines[i], &entry); err != nil {
+			t.Fatalf("entry %d isn't valid json: %s", i+1, err)
+		}
+		cert := readCert(t, filepath.Join(dir, want.Path, filepath.Base(want.Path)+".crt"))
+		want.Time, want.Serial = entry.Time, cert.SerialNumber.Text(16)
+		if entry != want {
+			t.Errorf("got entry %+v, want %+v", entry, want)
+		}
+		if entry.Time == "" {
+			t.Errorf("entry %d has no time", i+1)
+		}
+	}
+}
+
+func TestAuditLogOtherCommands(t *testing.T) {
+	dir := newTree(t)
+	expired := time.Now().Add(-time.Hour)
+	writeCert(t, dir, "ca/dead-ca", expired, true)
+	writeCert(t, dir, "ca/dead-ca/expired-leaf", expired, false)
+	certshop(t, dir, "ca", "-dn=/CN=other root", "-maxPathLength=1", "other")
+	certshop(t, dir, "cross-sign", "-cert=ca/ica", "-audit-log=audit.log", "-operator=alice", "other/ica")
+	certshop(t, dir, "selfsign", "-dn=/CN=localhost", "-audit-log=audit.log", "-operator=bob", "self")
+	// the certificates are gone after the prune, so read them first
+	certs := map[string]*x509.Certificate{}
+	for _, path := range []string{"other/ica", "self", "ca/dead-ca", "ca/dead-ca/expired-leaf"} {
+		certs[path] = readCert(t, filepath.Join(dir, path, filepath.Base(path)+".crt"))
+	}
+	// a dry run doesn't remove anything, so it isn't logged
+	certshop(t, dir, "prune", "-dry-run", "-audit-log=audit.log", "ca")
+	certshop(t, dir, "prune", "-force", "-audit-log=audit.log", "-operator=carol", "ca")
+
+	data, err := os.ReadFile(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	tests := []auditEntry{
+		{Command: "cross-sign", Path: "other/ica", Operator: "alice"},
+		{Command: "selfsign", Path: "self", Operator: "bob"},
+		{Command: "prune", Path: "ca/dead-ca", Operator: "carol"},
+		{Command: "prune", Path: "ca/dead-ca/expired-leaf", Operator: "carol"},
+	}
+	if len(lines) != len(tests) {
+		t.Fatalf("got %d audit log entries, want %d:\n%s", len(lines), len(tests), data)
+	}
+	for i, want := range tests {
+		entry := auditEntry{}
+		if err := json.Unmarshal(lines[i], &entry); err != nil {
+			t.Fatalf("entry %d isn't valid json: %s", i+1, err)
+		}
+		cert := certs[want.Path]
+		want.Time, want.Subject, want.Serial = entry.Time, formatDn(cert.Subject), cert.SerialNumber.Text(16)
+		if entry != want {
+			t.Errorf("got entry %+v, want %+v", entry, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// auditKeys reports public keys which are used by certificates with
+// different subjects (renewals and cross-signs of the same subject are
+// expected to share a key) and returns the exit code
+func auditKeys(args []string) int {
+	fs := flag.NewFlagSet("audit-keys", flag.ContinueOnError)
+	addCommonFlags(fs)
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	path := "ca"
+	if len(fs.Args()) > 1 {
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+	} else if len(fs.Args()) == 1 {
+		path = fs.Arg(0)
+	}
+	infoLog.Printf("Auditing Keys in %s", path)
+
+	paths := map[string][]string{}    // fingerprint -> certificate paths
+	subjects := map[string][]string{} // fingerprint -> distinct subjects
+	walkCertificates(path, func(path string, cert *x509.Certificate) {
+		fingerprint := publicKeyFingerprint(cert)
+		paths[fingerprint] = append(paths[fingerprint], path)
+		subject := string(cert.RawSubject)
+		for _, s := range subjects[fingerprint] {
+			if s == subject {
+				return
+			}
+		}
+		subjects[fingerprint] = append(subjects[fingerprint], subject)
+	})
+
+	fingerprints := []string{}
+	for fingerprint := range subjects {
+		if len(subjects[fingerprint]) > 1 {
+			fingerprints = append(fingerprints, fingerprint)
+		}
+	}
+	sort.Strings(fingerprints)
+	for _, fingerprint := range fingerprints {
+		fmt.Printf("Public key %s is used by %d certificates with different subjects:\n", fingerprint, len(paths[fingerprint]))
+		for _, path := range paths[fingerprint] {
+			fmt.Printf("    %s (%s)\n", path, formatDn(parseCert(path).Subject))
+		}
+	}
+	if len(fingerprints) > 0 {
+		return 1
+	}
+	fmt.Println("OK: no reused keys found")
+	return 0
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAuditKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		create [][]string
+		code   int
+		listed []string
+	}{
+		{"distinct keys", [][]string{
+			{"server", "-dn=/CN=one", "ca/one"},
+			{"server", "-dn=/CN=two", "ca/two"},
+		}, 0, nil},
+		{"reused key", [][]string{
+			{"server", "-dn=/CN=one", "ca/one"},
+			{"server", "-dn=/CN=two", "-key-in=ca/one/one.key", "ca/two"},
+		}, 1, []string{"ca/one (/CN=one)", "ca/two (/CN=two)"}},
+		{"renewal of the same subject", [][]string{
+			{"server", "-dn=/CN=one", "ca/one"},
+			{"server", "-dn=/CN=one", "-key-in=ca/one/one.key", "ca/renewed"},
+		}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			certshop(t, dir, "ca", "-dn=/CN=root")
+			for _, args := range tt.create {
+				certshop(t, dir, args...)
+			}
+			res := runCertshop(t, dir, nil, "audit-keys")
+			if res.code != tt.code {
+				t.Errorf("got exit status %d, want %d:\n%s", res.code, tt.code, res.stdout)
+			}
+			for _, line := range tt.listed {
+				if !strings.Contains(string(res.stdout), "    "+line+"\n") {
+					t.Errorf("%s isn't listed in the report:\n%s", line, res.stdout)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// batchManifest lists the certificates created by the batch command;
+// each row is a certificate specification (flag names as keys, see
+// applySpec) with "command" and "path" fields, and overrides the
+// defaults shared by every row
+type batchManifest struct {
+	Defaults     map[string]interface{}   `json:"defaults"`
+	Certificates []map[string]interface{} `json:"certificates"`
+}
+
+// batchRow is a manifest row merged with the defaults and converted to
+// the arguments of its create command
+type batchRow struct {
+	command string
+	path    string
+	args    []string
+}
+
+// batchCreate creates every certificate in a json manifest, checking
+// all of the rows before any certificate is created
+func batchCreate(args []string) {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	addCommonFlags(fs)
+	addDeterministicSeedFlag(fs)
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	if len(fs.Args()) != 1 {
+		usageLog.Fatalf("Invalid manifest %s", strings.Join(fs.Args(), ","))
+	}
+	manifestFile := fs.Arg(0)
+	infoLog.Printf("Reading batch manifest %s\n", manifestFile)
+	data, err := ioutil.ReadFile(manifestFile)
+	if err != nil {
+		errorLog.Fatalf("Failed to read batch manifest %s: %s", manifestFile, err)
+	}
+	manifest := batchManifest{}
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		errorLog.Fatalf("Failed to parse batch manifest %s: %s", manifestFile, err)
+	}
+	if len(manifest.Certificates) == 0 {
+		errorLog.Fatalf("No certificates in batch manifest %s", manifestFile)
+	}
+	if _, ok := manifest.Defaults["path"]; ok {
+		errorLog.Fatalf("Invalid batch manifest %s: the defaults can't include a path", manifestFile)
+	}
+
+	rows := []batchRow{}
+	problems := []string{}
+	paths := map[string]int{}
+	for i, fields := range manifest.Certificates {
+		row, rowProblems := parseBatchRow(manifest.Defaults, fields)
+		if previous, ok := paths[row.path]; ok && row.path != "" {
+			rowProblems = append(rowProblems, fmt.Sprintf("path is the same as row %d", previous))
+		}
+		paths[row.path] = i + 1
+		for _, problem := range rowProblems {
+			problems = append(problems, fmt.Sprintf("row %d (%s): %s", i+1, row.path, problem))
+		}
+		rows = append(rows, row)
+	}
+	if len(problems) > 0 {
+		errorLog.Fatalf("Invalid batch manifest %s:\n\t%s", manifestFile, strings.Join(problems, "\n\t"))
+	}
+
+	// the ca keys are decrypted once (with "-ca-pass" or CERTSHOP_CA_PASS)
+	// and shared by the rows
+	defer clearSignerCache()
+	for i, row := range rows {
+		infoLog.Printf("Batch row %d of %d: %s %s\n", i+1, len(rows), row.command, row.path)
+		// the rows inherit the common flags of the batch command
+		runNested(func() { createCommands[row.command](append(append([]string{}, row.args...), row.path)) })
+	}
+	infoLog.Printf("Finished creating %d certificates from %s\n", len(rows), manifestFile)
+}
+
+// parseBatchRow converts the fields of a manifest row, merged with the
+// defaults, to the arguments of its create command, returning every
+// problem found with the row; every field must be a flag of the command,
+// except that defaults for the flags of other create commands (ie. "san"
+// for ca rows) are left out
+func parseBatchRow(defaults map[string]interface{}, rowFields map[string]interface{}) (batchRow, []string) {
+	row := batchRow{command: "server"}
+	problems := []string{}
+	if command, ok := rowFields["command"]; ok {
+		row.command = fmt.Sprint(command)
+	} else if command, ok := defaults["command"]; ok {
+		row.command = fmt.Sprint(command)
+	}
+	if _, ok := createCommands[row.command]; !ok {
+		problems = append(problems, fmt.Sprintf("unknown command %s (must be ca, ica, server, client or signature)", row.command))
+		return row, problems
+	}
+	if path, ok := rowFields["path"].(string); !ok || path == "" {
+		problems = append(problems, "missing path")
+	} else {
+		row.path = filepath.Clean(path)
+	}
+
+	fs := createFlagSet(row.command)
+	fields := map[string]interface{}{}
+	for name, value := range defaults {
+		if fs.Lookup(name) == nil && createCommandFlag(name) {
+			continue
+		}
+		fields[name] = value
+	}
+	for name, value := range rowFields {
+		fields[name] = value
+	}
+	names := []string{}
+	for name := range fields {
+		if name != "command" && name != "path" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fs.Lookup(name) == nil {
+			problems = append(problems, fmt.Sprintf("unknown field %s (not a flag of the %s command)", name, row.command))
+			continue
+		}
+		var text string
+		var err error
+		switch {
+		case name == "san":
+			text, err = batchSubjectAltNames(fields[name])
+		case name == "spec":
+			err = fmt.Errorf("specification files can't be used in a batch manifest")
+		default:
+			text, err = batchFlagValue(fields[name])
+		}
+		if err == nil && name == "validity" {
+			var days int
+			if _, scanErr := fmt.Sscanf(text, "%d", &days); scanErr != nil || fmt.Sprint(days) != text || days <= 0 {
+				err = fmt.Errorf("must be a positive number of days")
+			}
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid %s: %s", name, err))
+			continue
+		}
+		row.args = append(row.args, "-"+name+"="+text)
+	}
+	return row, problems
+}
+
+// createCommandFlag reports whether name is a flag of any create command
+func createCommandFlag(name string) bool {
+	for command := range createCommands {
+		if createFlagSet(command).Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// batchFlagValue converts a json value to flag text the way applySpec
+// does (lists are joined with commas)
+func batchFlagValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string, bool:
+		return fmt.Sprint(v), nil
+	case float64:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			if _, ok := item.([]interface{}); ok {
+				return "", fmt.Errorf("nested lists aren't supported")
+			} else if _, ok := item.(map[string]interface{}); ok {
+				return "", fmt.Errorf("objects aren't supported in lists")
+			}
+			values = append(values, fmt.Sprint(item))
+		}
+		return strings.Join(values, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
+// batchSubjectAltNames converts the "san" field of a row, either a list
+// (as for "-san") or an object with "dns", "ip" and "email" lists, to
+// the "-san" flag text after checking each name
+func batchSubjectAltNames(value interface{}) (string, error) {
+	kinds := map[string][]interface{}{}
+	switch v := value.(type) {
+	case string:
+		for _, name := range strings.Split(v, ",") {
+			kinds[""] = append(kinds[""], strings.TrimSpace(name))
+		}
+	case []interface{}:
+		kinds[""] = v
+	case map[string]interface{}:
+		for kind, names := range v {
+			if kind != "dns" && kind != "ip" && kind != "email" {
+				return "", fmt.Errorf("unknown kind %s (must be dns, ip or email)", kind)
+			}
+			list, ok := names.([]interface{})
+			if !ok {
+				return "", fmt.Errorf("%s must be a list", kind)
+			}
+			kinds[kind] = list
+		}
+	default:
+		return "", fmt.Errorf("must be a list or an object with dns, ip and email lists")
+	}
+
+	names := []string{}
+	for _, kind := range []string{"", "dns", "ip", "email"} {
+		for _, item := range kinds[kind] {
+			name, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("%v is not a string", item)
+			}
+			ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(name, "["), "]"))
+			email := parseEmailAddress(name)
+			switch {
+			case name == "":
+				continue
+			case kind == "ip" && ip == nil:
+				return "", fmt.Errorf("%s is not an ip address", name)
+			case kind == "email" && email == nil:
+				return "", fmt.Errorf("%s is not an email address", name)
+			case kind == "dns" && (ip != nil || email != nil):
+				return "", fmt.Errorf("%s is not a dns name", name)
+			case ip == nil && email == nil:
+				ascii, err := domainToASCII(name)
+				if err == nil {
+					err = checkWildcard(ascii)
+				}
+				if err != nil {
+					return "", fmt.Errorf("%s: %s", name, err)
+				}
+			}
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ","), nil
+}
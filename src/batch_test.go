@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNestedCommonFlags(t *testing.T) {
+	tests := []struct {
+		flag  string
+		value *bool
+	}{
+		{"strict-pem", &strictPem},
+		{"debug", &debug},
+		{"no-openssl", &noOpenssl},
+		{"yes", &assumeYes},
+		{"y", &assumeYes},
+	}
+	parse := func(t *testing.T, args ...string) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		addCommonFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			parse(t, "-"+tt.flag)
+			defer parse(t)
+			runNested(func() {
+				parse(t)
+				if !*tt.value {
+					t.Errorf("the nested command didn't inherit \"-%s\"", tt.flag)
+				}
+				parse(t, "-"+tt.flag+"=false")
+				if *tt.value {
+					t.Errorf("the nested command can't override \"-%s\"", tt.flag)
+				}
+			})
+			parse(t)
+			if *tt.value {
+				t.Errorf("\"-%s\" is still set after the nested command", tt.flag)
+			}
+		})
+	}
+}
+
+func TestBatchInheritsCommonFlags(t *testing.T) {
+	dir := newTree(t)
+	manifest := filepath.Join(dir, "manifest.json")
+	data := `{"certificates": [{"command": "server", "path": "ca/ica/server", "dn": "/CN=server", "overwrite": true, "overwrite-keys": true}]}`
+	if err := os.WriteFile(manifest, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// overwriting needs "-yes" without a terminal, and "-debug" must
+	// reach the row to log its timing
+	res := runCertshop(t, dir, nil, "batch", "manifest.json")
+	if res.code == 0 {
+		t.Fatal("the batch overwrote a certificate without \"-yes\"")
+	}
+	res = runCertshop(t, dir, nil, "batch", "-yes", "-debug", "manifest.json")
+	if res.code != 0 {
+		t.Fatalf("the batch failed with \"-yes\":\n%s", res.stderr)
+	}
+	if !strings.Contains(res.stderr, "DEBUG:") {
+		t.Errorf("the row didn't inherit \"-debug\":\n%s", res.stderr)
+	}
+}
+
+func TestBatchUnknownFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		err      string
+	}{
+		{"typo", `{"certificates": [{"path": "ca/ica/web", "sna": ["web.example.com"]}]}`, "unknown field sna (not a flag of the server command)"},
+		{"flag of another command", `{"certificates": [{"path": "ca/ica/web", "maxPathLength": 1}]}`, "unknown field maxPathLength (not a flag of the server command)"},
+		{"typo in defaults", `{"defaults": {"valdity": 30}, "certificates": [{"path": "ca/ica/web"}]}`, "unknown field valdity (not a flag of the server command)"},
+		{"unknown command", `{"certificates": [{"command": "certificate", "path": "ca/ica/web"}]}`, "unknown command certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newTree(t)
+			if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(tt.manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+			res := runCertshop(t, dir, nil, "batch", "manifest.json")
+			if res.code == 0 || !strings.Contains(res.stderr, tt.err) {
+				t.Errorf("got status %d, want an error with %q:\n%s", res.code, tt.err, res.stderr)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "ca/ica/web")); !os.IsNotExist(err) {
+				t.Errorf("ca/ica/web was created")
+			}
+		})
+	}
+}
+
+func TestBatchDefaultsForOtherCommands(t *testing.T) {
+	dir := t.TempDir()
+	manifest := `{"defaults": {"maxPathLength": 1, "san": ["web.example.com"]}, "certificates": [
+		{"command": "ca", "path": "ca", "dn": "/CN=root"},
+		{"path": "ca/web", "dn": "/CN=web"}
+	]}`
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	certshop(t, dir, "batch", "manifest.json")
+	if ca := readCert(t, filepath.Join(dir, "ca/ca.crt")); ca.MaxPathLen != 1 {
+		t.Errorf("the ca has a maximum path length of %d, want 1", ca.MaxPathLen)
+	}
+	if web := readCert(t, filepath.Join(dir, "ca/web/web.crt")); strings.Join(web.DNSNames, ",") != "web.example.com" {
+		t.Errorf("the server has dns names %v, want the default", web.DNSNames)
+	}
+}
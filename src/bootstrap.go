@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bootstrap creates a root ca and an intermediate ca signed by it, and
+// then moves the root key to offline storage (or explains how to) so
+// that only the intermediate is used for day to day issuance
+func bootstrap(args []string) {
+	fs := flag.NewFlagSet("bootstrap", flag.ContinueOnError)
+	addCommonFlags(fs)
+	addDeterministicSeedFlag(fs)
+	dn := fs.String("dn", "/CN=certstore-ca", "root ca subject")
+	dnEncoding := fs.String("dn-encoding", "printable", "asn.1 string type of the subject attributes of both cas (printable or utf8)")
+	icaDn := fs.String("ica-dn", "/CN=certstore-ica", "intermediate ca subject (inherits from the root ca subject)")
+	icaName := fs.String("ica-name", "ica", "folder name of the intermediate ca under the root ca")
+	validity := fs.Int("validity", 10*365+5, "root ca validity in days")
+	icaValidity := fs.Int("ica-validity", 5*365+5, "intermediate ca validity in days")
+	offlineDir := fs.String("offline-dir", "", "move the root ca private key to this folder (ie. removable media)")
+	manifestOut := fs.String("manifest-out", "", "add both created cas to this json manifest")
+	overwrite := fs.Bool("overwrite", false, "overwrite any existing files")
+	overwriteKeys := fs.Bool("overwrite-keys", false, "overwrite existing private keys (in addition to \"-overwrite\")")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	path := "ca"
+	if len(fs.Args()) > 1 {
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+	} else if len(fs.Args()) == 1 {
+		path = filepath.Clean(fs.Arg(0))
+	}
+	if filepath.Dir(path) != "." {
+		usageLog.Fatalf("Invalid path %s (the root ca must be a top level folder)", path)
+	}
+	if *icaName == "" || strings.ContainsAny(*icaName, `/\`) {
+		usageLog.Fatalf("Invalid intermediate ca name %s", *icaName)
+	}
+	icaPath := filepath.Join(path, *icaName)
+
+	// the cas inherit the common flags of the bootstrap command
+	shared := []string{fmt.Sprintf("-overwrite=%t", *overwrite), fmt.Sprintf("-overwrite-keys=%t", *overwriteKeys),
+		"-dn-encoding=" + *dnEncoding, "-manifest-out=" + *manifestOut}
+	runNested(func() {
+		// a path length of 1 lets the intermediate sign leaf certificates only
+		createCA("ca", append(append([]string{}, shared...), "-dn="+*dn, "-maxPathLength=1", fmt.Sprintf("-validity=%d", *validity), path),
+			path, *dn, *validity)
+		createCA("ica", append(append([]string{}, shared...), "-dn="+*icaDn, fmt.Sprintf("-validity=%d", *icaValidity), icaPath),
+			icaPath, *icaDn, *icaValidity)
+	})
+
+	rootKey := filepath.Join(path, path+".key")
+	if *offlineDir != "" {
+		createDirectory(*offlineDir)
+		offlineKey := filepath.Join(*offlineDir, path+".key")
+		if _, err := os.Stat(offlineKey); err == nil && !*overwriteKeys {
+			errorLog.Fatalf("Skipping move of the root ca key because file %s already exists.\nUse the \"-overwrite-keys\" option to overwrite the existing key.", offlineKey)
+		} else if err == nil {
+			confirm("Overwrite "+offlineKey+"?", "overwrite "+offlineKey)
+		}
+		// copy and remove rather than rename, which fails across devices
+		copyFile(rootKey, offlineKey, privatePerms)
+		if err := os.Remove(rootKey); err != nil {
+			errorLog.Fatalf("Failed to remove %s after copying it to %s: %s", rootKey, offlineKey, err)
+		}
+		infoLog.Printf("Moved the root ca private key to %s\n", offlineKey)
+		rootKey = offlineKey
+	} else {
+		infoLog.Printf("Move the root ca private key %s to offline storage (ie. removable media in a safe)\n", rootKey)
+	}
+	infoLog.Printf("Issue certificates from the intermediate ca, ie. \"certshop server %s\"; "+
+		"their chains end at the root ca so they validate against %s\n",
+		filepath.Join(icaPath, "server"), filepath.Join(path, "ca.pem"))
+	infoLog.Printf("The root ca key is only needed to create or renew intermediate cas (copy %s back to %s temporarily)\n",
+		rootKey, path)
+}
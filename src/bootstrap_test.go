@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBootstrap(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		rootKey string
+	}{
+		{"online", []string{"-dn=/CN=root", "-ica-dn=/CN=issuing"}, "ca/ca.key"},
+		{"offline", []string{"-dn=/CN=root", "-ica-dn=/CN=issuing", "-offline-dir=usb"}, "usb/ca.key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			certshop(t, dir, append([]string{"bootstrap"}, tt.args...)...)
+			if _, err := os.Stat(filepath.Join(dir, tt.rootKey)); err != nil {
+				t.Errorf("the root ca key isn't at %s: %s", tt.rootKey, err)
+			}
+			if tt.rootKey != "ca/ca.key" {
+				if _, err := os.Stat(filepath.Join(dir, "ca/ca.key")); !os.IsNotExist(err) {
+					t.Error("the root ca key is still in the tree")
+				}
+			}
+
+			// the intermediate signs leaves without the root key
+			certshop(t, dir, "server", "-dn=/CN=server", "-san=www.example.com", "ca/ica/server")
+			roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+			roots.AddCert(readCert(t, filepath.Join(dir, "ca/ca.pem")))
+			chain := parseCertsPem([]byte(readFile(filepath.Join(dir, "ca/ica/server/server.crt"))))
+			for _, cert := range chain[1:] {
+				intermediates.AddCert(cert)
+			}
+			if _, err := chain[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, DNSName: "www.example.com"}); err != nil {
+				t.Errorf("the leaf doesn't validate to the root: %s", err)
+			}
+		})
+	}
+}
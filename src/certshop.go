@@ -3,34 +3,57 @@ package main
 import (
 	"archive/tar"
 	"bytes"
-	"compress/gzip"
+	"crypto"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
 	"encoding/pem"
 	"flag"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"math/big"
 	"net"
 	"net/mail"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
+
+	"github.com/varasys/certshop/pki"
 )
 
 var infoLog = log.New(os.Stderr, "", 0)
 var errorLog = log.New(os.Stderr, "ERROR: ", log.Lshortfile)
 
-var serialNumberLimit = new(big.Int).Lsh(big.NewInt(1), 128)
-var privatePerms os.FileMode = 0600
-var publicPerms os.FileMode = 0644
+// usageLog reports errors in the command line (flags and arguments), which
+// are told apart from other errors with "-error-format=json"
+var usageLog = log.New(os.Stderr, "ERROR: ", log.Lshortfile)
+
+var privatePerms = pki.PrivatePerms
+var publicPerms = pki.PublicPerms
+
+// defaultClockSkew is how far the start of the validity period is
+// backdated so that relying parties with slow clocks accept new
+// certificates
+const defaultClockSkew = 10 * time.Minute
+
+// strictPem rejects certificate and key files with unexpected data
+// before, between or after the pem blocks (set by "-strict-pem")
+var strictPem bool
+
+// debug logs the duration of each phase (set by "-debug")
+var debug bool
+
+// runTime is used for all validity calculations so that a single
+// invocation uses a consistent time
+var runTime = time.Now().UTC()
 
 func main() {
 	var command string
@@ -39,56 +62,189 @@ func main() {
 	} else {
 		command = os.Args[1]
 	}
+	// the error format applies to errors parsing the flags given before it
+	if format := errorFormatArg(os.Args[1:]); format != "" {
+		if err := setErrorFormat(format); err != nil {
+			usageLog.Fatalf("Invalid error format %s: %s", format, err)
+		}
+	}
 	switch command {
-	case "ca":
-		createCA(os.Args[2:], "ca", "/CN=certstore-ca", 10*365+5)
-	case "ica":
-		createCA(os.Args[2:], "ca/ica", "/CN=certstore-ica", 5*365+5)
-	case "server":
-		createCertificate(os.Args[2:], "ca/server", "/CN=server", "localhost,127.0.0.1", 365+5,
+	case "ca", "ica", "server", "client", "signature":
+		createCommands[command](os.Args[2:])
+	case "batch":
+		batchCreate(os.Args[2:])
+	case "export":
+		exportCertificate(os.Args[2:])
+	case "diff":
+		diffCertificates(os.Args[2:])
+	case "expiring":
+		os.Exit(expiringCertificates(os.Args[2:]))
+	case "verify":
+		verifyCertificate(os.Args[2:])
+	case "cross-sign":
+		crossSign(os.Args[2:])
+	case "audit-keys":
+		os.Exit(auditKeys(os.Args[2:]))
+	case "prune":
+		pruneCertificates(os.Args[2:])
+	case "describe":
+		describeTree(os.Args[2:])
+	case "bootstrap":
+		bootstrap(os.Args[2:])
+	case "fetch":
+		fetchCertificates(os.Args[2:])
+	case "selftest":
+		os.Exit(selfTest(os.Args[2:]))
+	case "embed-scts":
+		embedSCTs(os.Args[2:])
+	case "merge-cas":
+		mergeCAs(os.Args[2:])
+	case "inspect":
+		os.Exit(inspectFile(os.Args[2:]))
+	case "rekey-password":
+		rekeyPassword(os.Args[2:])
+	case "dhparam":
+		generateDHParams(os.Args[2:])
+	case "convert":
+		convertFile(os.Args[2:])
+	case "selfsign":
+		selfSign(os.Args[2:])
+	case "lint":
+		os.Exit(lintTree(os.Args[2:]))
+	default:
+		infoLog.Println("Usage: certshop ca | ica | server | client | signature | batch | export | diff | expiring | verify | cross-sign | audit-keys | prune | describe | bootstrap | fetch | selftest | embed-scts | merge-cas | inspect | rekey-password | dhparam | convert | selfsign | lint")
+	}
+}
+
+// createCommands are the commands which create a certificate, with the
+// default path, subject, validity and usages of each
+var createCommands = map[string]func(args []string){
+	"ca": func(args []string) {
+		createCA("ca", args, "ca", "/CN=certstore-ca", 10*365+5)
+	},
+	"ica": func(args []string) {
+		createCA("ica", args, "ca/ica", "/CN=certstore-ica", 5*365+5)
+	},
+	"server": func(args []string) {
+		createCertificate("server", args, "ca/server", "/CN=server", "localhost,127.0.0.1", 365+5,
 			x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment,
 			[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
-	case "client":
-		createCertificate(os.Args[2:], "ca/client", "/CN=client", "", 365+5,
+	},
+	"client": func(args []string) {
+		createCertificate("client", args, "ca/client", "/CN=client", "", 365+5,
 			x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment,
 			[]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth})
-	case "signature":
-		createCertificate(os.Args[2:], "ca/sign", "/CN=sign", "", 365+5,
+	},
+	"signature": func(args []string) {
+		createCertificate("signature", args, "ca/sign", "/CN=sign", "", 365+5,
 			x509.KeyUsageDigitalSignature, nil)
-	case "export":
-		exportCertificate(os.Args[2:])
-	default:
-		infoLog.Println("Usage: certshop ca | ica | server | client | signature | export")
-	}
+	},
 }
 
-func createCA(args []string, path string, defaultDn string, defaultValidity int) {
-	fs := flag.NewFlagSet("ca", flag.PanicOnError)
+// collectingFlags makes the create commands return right after
+// defining their flags, which are saved in collectedFlags (see
+// createFlagSet)
+var collectingFlags bool
+var collectedFlags *flag.FlagSet
+
+// createFlagSet returns the flags of a create command without running
+// it, ie. to check the fields of batch manifest rows before any
+// certificate is created
+func createFlagSet(command string) *flag.FlagSet {
+	collectingFlags = true
+	defer func() { collectingFlags = false }()
+	// defining the common flags sets them to the inherited values, so
+	// the flags of the current command are kept
+	runNested(func() { createCommands[command](nil) })
+	return collectedFlags
+}
+
+func createCA(command string, args []string, path string, defaultDn string, defaultValidity int) {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	addCommonFlags(fs)
+	addDeterministicSeedFlag(fs)
 	dn := fs.String("dn", defaultDn, "certificate subject")
+	dnEncoding := fs.String("dn-encoding", "printable", "asn.1 string type of the subject attributes (printable or utf8)")
+	subjectRaw := fs.String("subject-raw", "", "base64 der encoded subject to use byte for byte instead of \"-dn\"")
 	maxPathLength := fs.Int("maxPathLength", 0, "max path length")
 	validity := fs.Int("validity", defaultValidity, "ca validity in days")
+	serial := fs.String("serial", "", "serial number (decimal or 0x prefixed hex, positive and at most 20 octets) instead of a random one")
+	clockSkew := fs.Duration("clock-skew", defaultClockSkew, "backdate the start of the validity period by this duration to tolerate clock skew")
 	overwrite := fs.Bool("overwrite", false, "overwrite any existing files")
+	overwriteKeys := fs.Bool("overwrite-keys", false, "overwrite an existing private key (in addition to \"-overwrite\")")
+	keyFormat := fs.String("key-format", "pem", "private key format (pem or openssh)")
+	passOut := fs.String("pass-out", "", "passphrase for the private key (openssh key format only)")
+	keyIn := fs.String("key-in", "", "existing private key file to use instead of generating a new key")
+	passIn := fs.String("pass-in", "", "passphrase of the \"-key-in\" private key (openssh key format only)")
+	addKeyPolicyFlags(fs)
+	auditLog, operator := addAuditFlags(fs)
+	manifestOut := fs.String("manifest-out", "", "add the created files with their serial, fingerprints and expiry to this json manifest")
+	keyOut := fs.String("key-out", "", "also write the private key to this file (ie. in /etc/ssl/private)")
+	certOut := fs.String("cert-out", "", "also write the certificate with its chain to this file (ie. in /etc/ssl/certs)")
+	permittedIP := fs.String("permitted-ip", "", "comma separated list of permitted ip ranges in CIDR notation")
+	excludedIP := fs.String("excluded-ip", "", "comma separated list of excluded ip ranges in CIDR notation")
+	spec := fs.String("spec", "", "json or yaml (.yaml or .yml) file with default values for these flags (flags on the command line take precedence)")
+	printOpenssl := fs.Bool("print-openssl-cmd", false, "print the equivalent openssl commands")
+	inheritPolicies := fs.Bool("inherit-policies", false, "copy the certificate policies of the signing ca")
+	extensions := []pkix.Extension{}
+	addExtensionFlag(fs, &extensions)
+	kmsKeyArn := fs.String("kms-key-arn", "", "aws kms key (arn, id or alias) holding the signing ca's private key")
+	caPass := fs.String("ca-pass", "", "passphrase of the signing ca's private key (default $CERTSHOP_CA_PASS)")
+	signatureAlgorithm := fs.String("signature-algorithm", "", "signature algorithm (ie. ECDSA-SHA256 or ECDSA-SHA384), which must suit the ca signing key (default chosen by go for the key)")
+	issueUntil := fs.String("issue-until", "", "refuse to sign certificates with this ca after this date (ie. 2027-01-01)")
+	issuanceDays := fs.String("issuance-days", "", "comma separated days of the week (UTC) on which this ca may sign certificates (ie. Sat,Sun)")
+	issuanceWindow := fs.String("issuance-window", "", "time range (UTC) in which this ca may sign certificates (ie. 22:00-02:00)")
 
+	if collectingFlags {
+		collectedFlags = fs
+		return
+	}
 	err := fs.Parse(args)
 	if err != nil {
-		errorLog.Fatalf("Failed to parse command line arguments: %s", err)
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+	applySpec(fs, *spec)
+	checkKeyFormat(*keyFormat, *passOut)
+	var subjectDer []byte
+	var subjectName *pkix.Name
+	if *subjectRaw != "" {
+		subjectDer, subjectName = parseRawSubject(*subjectRaw)
+		*dn = formatDn(*subjectName)
 	}
+	policy := issuancePolicy{NotAfter: *issueUntil, Window: *issuanceWindow}
+	if *issuanceDays != "" {
+		policy.Days = strings.Split(*issuanceDays, ",")
+	}
+	if err = policy.validate(); err != nil {
+		usageLog.Fatalf("Invalid issuance policy: %s", err)
+	}
+	serialNumber := serialFlag(*serial)
 
 	if len(fs.Args()) > 1 {
-		errorLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
 	} else if len(fs.Args()) == 1 {
 		path = fs.Arg(0)
 	}
 
 	infoLog.Printf("Creating Certificate Authority %s with Subject: %s\n", path, *dn)
 
+	defer lockTree(path)()
 	if !*overwrite {
 		checkExisting(path)
+	} else {
+		if !*overwriteKeys {
+			checkExistingKey(path, *keyIn)
+		}
+		confirmOverwrite(path)
 	}
+	checkOutputFiles(*keyOut, *certOut, *overwrite, *overwriteKeys)
 
 	ca := filepath.Dir(path)
+	if *kmsKeyArn != "" && ca == "." {
+		errorLog.Fatalf("The \"-kms-key-arn\" option signs with the parent ca, so it can't be used for a self-signed ca")
+	}
 	var caCert *x509.Certificate
-	var caKey *ecdsa.PrivateKey
+	var caKey crypto.Signer
 	if ca != "." {
 		caCert = parseCert(ca)
 		if !caCert.IsCA {
@@ -97,20 +253,19 @@ func createCA(args []string, path string, defaultDn string, defaultValidity int)
 			errorLog.Fatalf("Certificate Authority %s can't sign other certificate authorities (maxPathLength exceeded)", ca)
 		}
 		*maxPathLength = caCert.MaxPathLen - 1
-		caKey = parseKey(ca)
+		caKey = caSigner(ca, caCert, *kmsKeyArn, caPassword(*caPass))
 	}
 
-	key, derKey, err := generatePrivateKey()
-	if err != nil {
-		errorLog.Fatalf("Error generating private key: %s", err)
+	start := time.Now()
+	key, derKey := loadOrGeneratePrivateKey(*keyIn, *passIn)
+	debugTiming("key generation", start)
+	if *keyIn != "" {
+		if err := checkKeyPolicy(key.Public()); err != nil {
+			errorLog.Fatalf("Refusing to certify the \"-key-in\" key %s: %s", *keyIn, err)
+		}
 	}
 
-	notBefore := time.Now().UTC()
-	notAfter := notBefore.AddDate(0, 0, *validity)
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
-	if err != nil {
-		errorLog.Fatalf("Failed to generate serial number: %s", err)
-	}
+	notBefore, notAfter := validityPeriod(*clockSkew, *validity)
 
 	template := x509.Certificate{
 		SerialNumber:          serialNumber,
@@ -118,73 +273,215 @@ func createCA(args []string, path string, defaultDn string, defaultValidity int)
 		NotBefore:             notBefore,
 		NotAfter:              notAfter,
 		BasicConstraintsValid: true,
-		IsCA:           true,
-		MaxPathLen:     *maxPathLength,
-		MaxPathLenZero: *maxPathLength == 0,
-		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IsCA:                  true,
+		MaxPathLen:            *maxPathLength,
+		MaxPathLenZero:        *maxPathLength == 0,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		PermittedIPRanges:     parseIPRanges(*permittedIP),
+		ExcludedIPRanges:      parseIPRanges(*excludedIP),
+	}
+
+	if *printOpenssl {
+		if caCert == nil {
+			printOpensslCreateCmds(path, "", &template)
+		} else {
+			printOpensslCreateCmds(path, ca, &template)
+		}
 	}
 
 	if caCert == nil {
 		caCert = &template
 		caKey = key
+		template.SignatureAlgorithm = parseSignatureAlgorithm(*signatureAlgorithm, path, caKey.Public())
+	} else {
+		template.SignatureAlgorithm = parseSignatureAlgorithm(*signatureAlgorithm, ca, caKey.Public())
 	}
 
-	derCert, err := x509.CreateCertificate(rand.Reader, &template, caCert, &key.PublicKey, caKey)
+	if *inheritPolicies && caCert != nil {
+		// subject fields are always inherited by parseDn
+		template.PolicyIdentifiers = caCert.PolicyIdentifiers
+		template.Policies = caCert.Policies
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, extensions...)
+	if subjectDer != nil {
+		template.Subject = *subjectName
+		template.RawSubject = subjectDer
+	} else {
+		template.RawSubject = rawSubject(template.Subject, *dnEncoding)
+	}
+	start = time.Now()
+	derCert, err := pki.Sign(signingRandom(), &template, caCert, &key.PublicKey, caKey)
 	if err != nil {
 		errorLog.Fatalf("Failed to create CA Certificate: %s", err)
 	}
-	saveCert(path, derCert)
-	saveKey(path, derKey)
+	debugTiming("signing", start)
+	start = time.Now()
+	saveCert(path, derCert, nil)
+	saveKey(path, key, derKey, *keyFormat, *passOut)
+	writeAuditLog(*auditLog, command, *operator, path, derCert)
+	debugTiming("marshaling and saving", start)
 	if caCert != &template {
 		copyFile(filepath.Join(filepath.Dir(path), "ca.pem"), filepath.Join(path, "ca.pem"), publicPerms)
 	} else {
-		copyFile(filepath.Join(path, path+".crt"), filepath.Join(path, "ca.pem"), publicPerms)
+		copyFile(filepath.Join(path, filepath.Base(path)+".crt"), filepath.Join(path, "ca.pem"), publicPerms)
 	}
+	saveIssuancePolicy(path, policy)
+	writeManifest(*manifestOut, path, derCert)
+	copyOutputFiles(path, *keyOut, *certOut)
 	infoLog.Printf("Finished Creating Certificate Authority %s with Subject: %s\n", path, *dn)
 }
 
-func createCertificate(args []string, path string, defaultDn string, defaultSan string, defaultValidity int, keyUsage x509.KeyUsage, extKeyUsage []x509.ExtKeyUsage) {
-	fs := flag.NewFlagSet("server", flag.PanicOnError)
+func createCertificate(command string, args []string, path string, defaultDn string, defaultSan string, defaultValidity int, keyUsage x509.KeyUsage, extKeyUsage []x509.ExtKeyUsage) {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	addCommonFlags(fs)
+	addDeterministicSeedFlag(fs)
 	dn := fs.String("dn", defaultDn, "certificate subject")
+	dnEncoding := fs.String("dn-encoding", "printable", "asn.1 string type of the subject attributes (printable or utf8)")
+	subjectRaw := fs.String("subject-raw", "", "base64 der encoded subject to use byte for byte instead of \"-dn\"")
 	san := fs.String("san", defaultSan, "subject alternative names")
+	keyUsageFlag := fs.String("key-usage", strings.Join(keyUsageNames(keyUsage), ","), "comma separated list of key usages")
+	extKeyUsageFlag := fs.String("ext-key-usage", strings.Join(extKeyUsageNames(extKeyUsage), ","), "comma separated list of extended key usages")
+	ecExplicitParams := fs.Bool("ec-explicit-params", false, "encode the private key with explicit curve parameters instead of the named curve")
+	spec := fs.String("spec", "", "json or yaml (.yaml or .yml) file with default values for these flags (flags on the command line take precedence)")
+	printOpenssl := fs.Bool("print-openssl-cmd", false, "print the equivalent openssl commands")
+	inheritPolicies := fs.Bool("inherit-policies", false, "copy the certificate policies of the signing ca")
+	extensions := []pkix.Extension{}
+	addExtensionFlag(fs, &extensions)
+	kmsKeyArn := fs.String("kms-key-arn", "", "aws kms key (arn, id or alias) holding the signing ca's private key")
+	signatureAlgorithm := fs.String("signature-algorithm", "", "signature algorithm (ie. ECDSA-SHA256 or ECDSA-SHA384), which must suit the ca signing key (default chosen by go for the key)")
+	sanCritical := fs.String("subject-alt-name-critical", "", "force the critical flag of the subject alternative name extension (true or false)")
+	precert := fs.Bool("precert", false, "create a certificate transparency precertificate (see the embed-scts command)")
+	dateOfBirth := fs.String("date-of-birth", "", "date of birth (YYYY-MM-DD) subject directory attribute")
+	placeOfBirth := fs.String("place-of-birth", "", "place of birth subject directory attribute")
+	gender := fs.String("gender", "", "gender (M or F) subject directory attribute")
+	citizenship := fs.String("citizenship", "", "comma separated list of countries of citizenship (two letter codes) subject directory attribute")
+	residence := fs.String("residence", "", "comma separated list of countries of residence (two letter codes) subject directory attribute")
+	subjectSerial := fs.String("subject-serial", "", "serialNumber attribute of the subject (ie. a device serial number)")
 	validity := fs.Int("validity", defaultValidity, "certificate validity in days")
+	validFor := fs.Duration("valid-for", 0, "certificate validity as a duration (ie. 2h or 30m) instead of days")
+	serial := fs.String("serial", "", "serial number (decimal or 0x prefixed hex, positive and at most 20 octets) instead of a random one")
+	clockSkew := fs.Duration("clock-skew", defaultClockSkew, "backdate the start of the validity period by this duration to tolerate clock skew")
+	strict := fs.Bool("strict", false, "treat subject alternative names that don't suit the certificate type as errors")
+	validateSans := fs.Bool("validate-sans", false, "fail if the subject alternative names aren't well formed host names and ip addresses")
 	overwrite := fs.Bool("overwrite", false, "overwrite any existing files")
+	overwriteKeys := fs.Bool("overwrite-keys", false, "overwrite an existing private key (in addition to \"-overwrite\")")
+	keyFormat := fs.String("key-format", "pem", "private key format (pem or openssh)")
+	passOut := fs.String("pass-out", "", "passphrase for the private key (openssh key format only)")
+	keyIn := fs.String("key-in", "", "existing private key file to use instead of generating a new key")
+	passIn := fs.String("pass-in", "", "passphrase of the \"-key-in\" private key (openssh key format only)")
+	addKeyPolicyFlags(fs)
+	auditLog, operator := addAuditFlags(fs)
+	manifestOut := fs.String("manifest-out", "", "add the created files with their serial, fingerprints and expiry to this json manifest")
+	keyOut := fs.String("key-out", "", "also write the private key to this file (ie. in /etc/ssl/private)")
+	certOut := fs.String("cert-out", "", "also write the certificate with its chain to this file (ie. in /etc/ssl/certs)")
+	caP12 := fs.String("ca", "", "pkcs12 file containing the ca certificate and key (instead of the parent folder)")
+	caCertFile := fs.String("ca-cert", "", "pem file with the ca certificate followed by its chain (instead of the parent folder)")
+	caKeyFile := fs.String("ca-key", "", "pem or openssh file with the ca private key (used with \"-ca-cert\")")
+	caPass := fs.String("ca-pass", "", "passphrase of the signing ca's private key (default $CERTSHOP_CA_PASS)")
+	addOpensslFlags(fs)
 
+	if collectingFlags {
+		collectedFlags = fs
+		return
+	}
 	err := fs.Parse(args)
 	if err != nil {
-		errorLog.Fatalf("Failed to parse command line argumanets: %s", err)
+		usageLog.Fatalf("Failed to parse command line argumanets: %s", err)
 	}
+	applySpec(fs, *spec)
+	*caPass = caPassword(*caPass)
+	checkKeyFormat(*keyFormat, *passOut)
+	var subjectDer []byte
+	var subjectName *pkix.Name
+	if *subjectRaw != "" {
+		subjectDer, subjectName = parseRawSubject(*subjectRaw)
+		*dn = formatDn(*subjectName)
+	}
+	serialNumber := serialFlag(*serial)
 
 	if len(fs.Args()) > 1 {
-		errorLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
 	} else if len(fs.Args()) == 1 {
 		path = fs.Arg(0)
 	}
 
 	infoLog.Printf("Creating Certificate %s with Subject: %s\n", path, *dn)
 
+	if *caP12 != "" && *kmsKeyArn != "" {
+		errorLog.Fatalf("The \"-ca\" and \"-kms-key-arn\" options can't be used together")
+	} else if *caP12 != "" && *caCertFile != "" {
+		errorLog.Fatalf("The \"-ca\" and \"-ca-cert\" options can't be used together")
+	} else if *caCertFile != "" && *caKeyFile == "" && *kmsKeyArn == "" {
+		errorLog.Fatalf("The \"-ca-cert\" option requires \"-ca-key\" (or \"-kms-key-arn\")")
+	} else if *caCertFile == "" && *caKeyFile != "" {
+		errorLog.Fatalf("The \"-ca-key\" option requires \"-ca-cert\"")
+	}
+	if *caP12 != "" || *caCertFile != "" {
+		// the signing ca isn't in the tree, so only the folder of the new
+		// certificate is locked
+		createDirectory(path)
+		defer lockFolder(path)()
+	} else {
+		defer lockTree(path)()
+	}
 	if !*overwrite {
 		checkExisting(path)
+	} else {
+		if !*overwriteKeys {
+			checkExistingKey(path, *keyIn)
+		}
+		confirmOverwrite(path)
 	}
+	checkOutputFiles(*keyOut, *certOut, *overwrite, *overwriteKeys)
 
 	ca := filepath.Dir(path)
 
-	caCert := parseCert(ca)
+	var caCert *x509.Certificate
+	var caKey crypto.Signer
+	var caChain []byte
+	if *caP12 != "" {
+		ca = *caP12
+		caCert, caKey, caChain = parseP12(*caP12, *caPass)
+	} else if *caCertFile != "" {
+		ca = *caCertFile
+		caCert = parseCertChain(*caCertFile)[0]
+		caChain = []byte(readFile(*caCertFile))
+		if *kmsKeyArn != "" {
+			caKey = caSigner(ca, caCert, *kmsKeyArn, "")
+		} else {
+			caKey = parseKeyFile(*caKeyFile, *caPass)
+			checkSigner(ca, caCert, caKey)
+		}
+	} else {
+		caCert = parseCert(ca)
+		caKey = caSigner(ca, caCert, *kmsKeyArn, *caPass)
+	}
 	if !caCert.IsCA {
-		errorLog.Fatalf("Certificate %s is not a certificate authority", filepath.Dir(path))
+		errorLog.Fatalf("Certificate %s is not a certificate authority", ca)
 	}
-	caKey := parseKey(ca)
 
-	key, derKey, err := generatePrivateKey()
-	if err != nil {
-		errorLog.Fatalf("Error generating private key: %s", err)
+	start := time.Now()
+	key, derKey := loadOrGeneratePrivateKey(*keyIn, *passIn)
+	debugTiming("key generation", start)
+	if *keyIn != "" {
+		if err := checkKeyPolicy(key.Public()); err != nil {
+			errorLog.Fatalf("Refusing to certify the \"-key-in\" key %s: %s", *keyIn, err)
+		}
+	}
+	if *ecExplicitParams {
+		if *keyFormat != "pem" {
+			errorLog.Fatalf("The \"-ec-explicit-params\" option is only supported with \"-key-format=pem\"")
+		}
+		if derKey, err = marshalECPrivateKeyExplicit(key); err != nil {
+			errorLog.Fatalf("Error marshalling private key with explicit parameters: %s", err)
+		}
 	}
 
-	notBefore := time.Now().UTC().Add(-10 * time.Minute) // -10 min to mitigate clock skew
-	notAfter := notBefore.AddDate(0, 0, *validity).Add(10 * time.Minute)
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
-	if err != nil {
-		errorLog.Fatalf("Failed to generate serial number: %s", err)
+	notBefore, notAfter := validityPeriod(*clockSkew, *validity)
+	if *validFor < 0 {
+		errorLog.Fatalf("The \"-valid-for\" duration must be positive: %s", *validFor)
+	} else if *validFor > 0 {
+		notAfter = runTime.Add(*validFor)
 	}
 
 	template := x509.Certificate{
@@ -198,16 +495,78 @@ func createCertificate(args []string, path string, defaultDn string, defaultSan
 		EmailAddresses: []string{},
 	}
 
+	// the subject serialNumber identifies the device and is unrelated
+	// to the certificate serial number
+	if *subjectSerial != "" {
+		template.Subject.SerialNumber = *subjectSerial
+	}
+	template.KeyUsage = parseKeyUsage(*keyUsageFlag)
+	if *extKeyUsageFlag != "" {
+		template.ExtKeyUsage = parseExtKeyUsage(*extKeyUsageFlag)
+	}
 	parseSubjectAlternativeNames(*san, &template)
+	validateWildcards(&template)
+	checkSubjectAlternativeNames(&template, *strict)
+	if *validateSans {
+		validateSubjectAlternativeNames(&template)
+	}
+	if *sanCritical != "" {
+		critical, err := strconv.ParseBool(*sanCritical)
+		if err != nil {
+			usageLog.Fatalf("Invalid \"-subject-alt-name-critical\" value %s (must be true or false)", *sanCritical)
+		}
+		if len(template.DNSNames)+len(template.IPAddresses)+len(template.EmailAddresses) == 0 {
+			errorLog.Fatalf("The \"-subject-alt-name-critical\" option requires subject alternative names")
+		}
+		extension, err := subjectAltNameExtension(&template, critical)
+		if err != nil {
+			errorLog.Fatalf("Failed to encode subject alternative names: %s", err)
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, extension)
+	}
+	if *printOpenssl {
+		printOpensslCreateCmds(path, ca, &template)
+	}
 
-	derCert, err := x509.CreateCertificate(rand.Reader, &template, caCert, &key.PublicKey, caKey)
+	if *inheritPolicies && caCert != nil {
+		// subject fields are always inherited by parseDn
+		template.PolicyIdentifiers = caCert.PolicyIdentifiers
+		template.Policies = caCert.Policies
+	}
+	if *precert {
+		template.ExtraExtensions = append(template.ExtraExtensions, ctPoisonExtension())
+	}
+	if extension, ok, err := subjectDirectoryAttributes(*dateOfBirth, *placeOfBirth, *gender, *citizenship, *residence); err != nil {
+		usageLog.Fatalf("Invalid subject directory attributes: %s", err)
+	} else if ok {
+		template.ExtraExtensions = append(template.ExtraExtensions, extension)
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, extensions...)
+	if subjectDer != nil {
+		template.Subject = *subjectName
+		template.RawSubject = subjectDer
+	} else {
+		template.RawSubject = rawSubject(template.Subject, *dnEncoding)
+	}
+	template.SignatureAlgorithm = parseSignatureAlgorithm(*signatureAlgorithm, ca, caKey.Public())
+	start = time.Now()
+	derCert, err := pki.Sign(signingRandom(), &template, caCert, &key.PublicKey, caKey)
 	if err != nil {
 		errorLog.Fatalf("Failed to create Server Certificate %s: %s", path, err)
 	}
-
-	saveCert(path, derCert)
-	saveKey(path, derKey)
-	copyFile(filepath.Join(filepath.Dir(path), "ca.pem"), filepath.Join(path, "ca.pem"), publicPerms)
+	debugTiming("signing", start)
+	start = time.Now()
+	saveCert(path, derCert, caChain)
+	saveKey(path, key, derKey, *keyFormat, *passOut)
+	writeAuditLog(*auditLog, command, *operator, path, derCert)
+	debugTiming("marshaling and saving", start)
+	if caChain != nil {
+		writeFile(filepath.Join(path, "ca.pem"), rootOfChain(caChain), publicPerms)
+	} else {
+		copyFile(filepath.Join(filepath.Dir(path), "ca.pem"), filepath.Join(path, "ca.pem"), publicPerms)
+	}
+	writeManifest(*manifestOut, path, derCert)
+	copyOutputFiles(path, *keyOut, *certOut)
 	infoLog.Printf("Finished Creating Certificate %s with Subject: %s\n", path, *dn)
 }
 
@@ -217,16 +576,99 @@ func parseSubjectAlternativeNames(san string, template *x509.Certificate) {
 		template.IPAddresses = []net.IP{}
 		template.DNSNames = []string{}
 		for _, h := range strings.Split(san, ",") {
+			h = strings.TrimSpace(h)
+			if h == "" {
+				continue
+			}
 			infoLog.Printf("Parsing %s\n", h)
-			if ip := net.ParseIP(h); ip != nil {
+			// ip addresses only ever go in IPAddresses (an ip in DNSNames is
+			// invalid); ipv6 addresses may be bracketed as in urls
+			if ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(h, "["), "]")); ip != nil {
 				template.IPAddresses = append(template.IPAddresses, ip)
 			} else if email := parseEmailAddress(h); email != nil {
 				template.EmailAddresses = append(template.EmailAddresses, email.Address)
 			} else {
-				template.DNSNames = append(template.DNSNames, h)
+				ascii, err := domainToASCII(h)
+				if err != nil {
+					usageLog.Fatalf("Invalid domain name %s: %s", h, err)
+				}
+				if ascii != h {
+					infoLog.Printf("Encoding %s as %s\n", h, ascii)
+				}
+				template.DNSNames = append(template.DNSNames, ascii)
+			}
+		}
+	}
+}
+
+// checkSubjectAlternativeNames warns (or fails when strict) if the
+// subject alternative names don't suit the extended key usage
+// (ie. a signature certificate with dns names, or an s/mime certificate
+// with the email address in the common name)
+func checkSubjectAlternativeNames(template *x509.Certificate, strict bool) {
+	report := func(format string, v ...interface{}) {
+		if strict {
+			errorLog.Fatalf(format, v...)
+		}
+		infoLog.Printf("WARNING: "+format+"\n", v...)
+	}
+	serverAuth, emailProtection := false, false
+	for _, usage := range template.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageServerAuth {
+			serverAuth = true
+		} else if usage == x509.ExtKeyUsageEmailProtection {
+			emailProtection = true
+		}
+	}
+	if emailProtection && parseEmailAddress(template.Subject.CommonName) != nil {
+		// the s/mime baseline requirements only allow email addresses in
+		// the rfc822Name subject alternative names
+		report("s/mime certificate has the email address %s in the common name; use a name in the \"-dn\" and put the address in \"-san\" instead", template.Subject.CommonName)
+	}
+	if emailProtection && len(template.EmailAddresses) == 0 {
+		report("s/mime certificate has no email subject alternative names so mail clients won't be able to match the sender")
+	}
+	if serverAuth {
+		if len(template.DNSNames) == 0 && len(template.IPAddresses) == 0 {
+			report("server certificate has no dns or ip subject alternative names so clients won't be able to verify the host name")
+		}
+		for _, name := range template.DNSNames {
+			if strings.Trim(name, "0123456789.") == "" {
+				report("dns subject alternative name %s looks like an invalid ip address", name)
+			}
+		}
+		if len(template.EmailAddresses) > 0 {
+			report("server certificate includes email subject alternative names %s which aren't used for tls server authentication", strings.Join(template.EmailAddresses, ","))
+		}
+	} else if len(template.ExtKeyUsage) == 0 && (len(template.DNSNames) > 0 || len(template.IPAddresses) > 0) {
+		report("signature certificate includes dns or ip subject alternative names which aren't used for digital signatures")
+	}
+}
+
+// parseIPRanges parses a comma separated list of CIDRs for ip name
+// constraints; a bare ip is treated as a single address (/32 or /128)
+func parseIPRanges(ranges string) []*net.IPNet {
+	if ranges == "" {
+		return nil
+	}
+	infoLog.Printf("Parsing IP Ranges: %s\n", ranges)
+	ipNets := []*net.IPNet{}
+	for _, r := range strings.Split(ranges, ",") {
+		if strings.Contains(r, "/") {
+			_, ipNet, err := net.ParseCIDR(r)
+			if err != nil {
+				errorLog.Fatalf("Failed to parse ip range %s: %s", r, err)
 			}
+			ipNets = append(ipNets, ipNet)
+		} else if ip := net.ParseIP(r); ip == nil {
+			errorLog.Fatalf("Failed to parse ip range %s: invalid ip address", r)
+		} else if ip4 := ip.To4(); ip4 != nil {
+			ipNets = append(ipNets, &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)})
+		} else {
+			ipNets = append(ipNets, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
 		}
 	}
+	return ipNets
 }
 
 // implemented as a seperate function because net.mail.ParseAddress
@@ -245,8 +687,23 @@ func parseEmailAddress(address string) (email *mail.Address) {
 	return nil
 }
 
+// validityPeriod returns the validity period starting from runTime
+// backdated by clockSkew
+func validityPeriod(clockSkew time.Duration, days int) (notBefore time.Time, notAfter time.Time) {
+	if clockSkew < 0 {
+		errorLog.Fatalf("The \"-clock-skew\" duration can't be negative: %s", clockSkew)
+	}
+	return runTime.Add(-clockSkew), runTime.AddDate(0, 0, days)
+}
+
 func generatePrivateKey() (*ecdsa.PrivateKey, []byte, error) {
-	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	var key *ecdsa.PrivateKey
+	var err error
+	if deterministic {
+		key, err = deterministicKey()
+	} else {
+		key, err = pki.GenerateKey(rand.Reader)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -263,7 +720,7 @@ func checkExisting(path string) {
 	if _, err := os.Stat(fullPath + ".crt"); err == nil {
 		errorLog.Fatalf(errMsg, path, "./"+fullPath+".crt")
 	}
-	if _, err := os.Stat(fullPath + ".crt"); err == nil {
+	if _, err := os.Stat(fullPath + ".key"); err == nil {
 		errorLog.Fatalf(errMsg, path, "./"+fullPath+".key")
 	}
 	if _, err := os.Stat(filepath.Join(path, "ca.pem")); err == nil {
@@ -271,107 +728,250 @@ func checkExisting(path string) {
 	}
 }
 
+// checkExistingKey protects an existing private key when "-overwrite"
+// is given without "-overwrite-keys", since losing a key is much worse
+// than losing a certificate; reusing the same key with "-key-in" is
+// allowed
+func checkExistingKey(path string, keyIn string) {
+	keyFile := filepath.Join(path, filepath.Base(path)+".key")
+	existing, err := os.Stat(keyFile)
+	if err != nil {
+		return
+	}
+	if keyIn != "" {
+		if reused, err := os.Stat(keyIn); err == nil && os.SameFile(existing, reused) {
+			return
+		}
+	}
+	errorLog.Fatalf("Skipping creation of %s because the private key %s already exists.\nUse the \"-overwrite-keys\" option (as well as \"-overwrite\") to replace the existing key.", path, keyFile)
+}
+
 func createDirectory(directory string) {
 	if _, err := os.Stat(directory); os.IsNotExist(err) {
 		var publicPerms os.FileMode = 0755
-		if err := os.MkdirAll(directory, publicPerms); err != nil {
+		if err := os.MkdirAll(directory, publicPerms); os.IsPermission(err) {
+			errorLog.Fatalf("Permission denied creating directory ./%s: %s\nRun certshop as a user with write access to the parent folder or choose a different path.", directory, err.Error())
+		} else if err != nil {
 			errorLog.Fatalf("Error creating directory ./%s: %s", directory, err.Error())
 		}
 	}
 }
 
-func saveCert(directory string, derCert []byte) {
+// saveCert saves the certificate followed by the ca chain, which is
+// read from the parent folder if caChain is nil
+func saveCert(directory string, derCert []byte, caChain []byte) {
 	createDirectory(directory)
 
-	fileName := filepath.Join(directory, filepath.Base(directory)+".crt")
+	fileName := pki.CertFile(directory)
 
 	infoLog.Printf("Saving %s\n", fileName)
 
-	certFile, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE, publicPerms)
-	if err != nil {
-		errorLog.Fatalf("Failed to open %s for writing: %s", fileName, err)
+	if caChain == nil && filepath.Dir(directory) != "." {
+		caChain = []byte(readFile(pki.CertFile(filepath.Dir(directory))))
 	}
-	defer func() {
-		if err := certFile.Close(); err != nil {
-			errorLog.Fatalf("Failed to save %s: %s", fileName, err)
-		}
-	}()
-	if err := pem.Encode(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: derCert}); err != nil {
-		errorLog.Fatalf("Failed to marshall %s: %s", fileName, err)
+	if err := pki.WriteCertificate(directory, derCert, caChain); err != nil {
+		errorLog.Fatalf("Failed to save %s: %s", fileName, err)
 	}
-	if filepath.Dir(directory) != "." {
-		caFile, err := os.Open(filepath.Join(filepath.Dir(directory), filepath.Base(filepath.Dir(directory))) + ".crt")
-		if err != nil {
-			errorLog.Fatalf("Failed to open ca certificate: %s", err)
-		}
-		defer func() {
-			if err = caFile.Close(); err != nil {
-				errorLog.Fatalf("Failed to close %s: %s", filepath.Join(filepath.Dir(directory), filepath.Base(filepath.Dir(directory)))+".crt", err)
-			}
-		}()
-		_, err = io.Copy(certFile, caFile)
-		if err != nil {
-			errorLog.Fatalf("Failed to concat ca certificates: %s", err)
-		}
-		err = certFile.Sync()
-		if err != nil {
-			errorLog.Fatalf("Failed to sync certificate file: %s", err)
+}
+
+func checkKeyFormat(keyFormat string, passOut string) {
+	switch keyFormat {
+	case "pem":
+		if passOut != "" {
+			errorLog.Fatalf("The \"-pass-out\" option is only supported with \"-key-format=openssh\"")
 		}
+	case "openssh":
+	default:
+		usageLog.Fatalf("Invalid key format %s (must be pem or openssh)", keyFormat)
 	}
 }
 
-func saveKey(directory string, derKey []byte) {
+func saveKey(directory string, key *ecdsa.PrivateKey, derKey []byte, keyFormat string, passOut string) {
 
 	fileName := filepath.Join(directory, filepath.Base(directory)+".key")
 
 	infoLog.Printf("Saving %s\n", fileName)
 
-	keyFile, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, privatePerms)
-	if err != nil {
-		errorLog.Fatalf("Failed to open %s for writing: %s", fileName, err)
-	}
-	defer func() {
-		if err := keyFile.Close(); err != nil {
-			errorLog.Fatalf("Failed to close %s: %s", fileName, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: derKey})
+	if keyFormat == "openssh" {
+		var err error
+		if data, err = marshalOpenSSHKey(key, filepath.Base(directory), passOut); err != nil {
+			errorLog.Fatalf("Failed to marshal %s: %s", fileName, err)
 		}
-	}()
-	if err := pem.Encode(keyFile, &pem.Block{Type: "EC PRIVATE KEY", Bytes: derKey}); err != nil {
-		errorLog.Fatalf("Failed to marshall %s: %s", fileName, err)
+	}
+
+	if err := pki.WriteKey(directory, data); err != nil {
+		errorLog.Fatalf("Failed to write %s: %s", fileName, err)
 	}
 }
 
+// parseCert parses the certificate in path (the first certificate of
+// its certificate file)
 func parseCert(path string) *x509.Certificate {
-	der, err := ioutil.ReadFile(filepath.Join(path, filepath.Base(path)+".crt"))
+	return parseCertChain(pki.CertFile(path))[0]
+}
+
+// commonFlags are the values of the boolean flags accepted by every
+// command
+type commonFlags struct {
+	strictPem bool
+	debug     bool
+	noOpenssl bool
+	assumeYes bool
+}
+
+// inheritedFlags are the defaults of the common flags; a command run by
+// another command (ie. the rows of batch) inherits the parsed flags of
+// the outer command through runNested instead of having them passed on
+// as arguments
+var inheritedFlags commonFlags
+
+// runNested runs a command from within another command with the common
+// flags the outer command parsed as its defaults
+func runNested(run func()) {
+	saved := inheritedFlags
+	inheritedFlags = commonFlags{strictPem: strictPem, debug: debug, noOpenssl: noOpenssl, assumeYes: assumeYes}
+	defer func() { inheritedFlags = saved }()
+	run()
+}
+
+// addCommonFlags adds the flags accepted by every command
+func addCommonFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&strictPem, "strict-pem", inheritedFlags.strictPem, "reject certificate and key files containing data other than pem blocks")
+	fs.BoolVar(&debug, "debug", inheritedFlags.debug, "log how long each phase takes")
+	fs.BoolVar(&noOpenssl, "no-openssl", inheritedFlags.noOpenssl, "never run openssl, the only external program certshop uses (fail if an operation has no native implementation)")
+	fs.BoolVar(&assumeYes, "yes", inheritedFlags.assumeYes, "don't ask for confirmation before overwriting or removing files")
+	fs.BoolVar(&assumeYes, "y", inheritedFlags.assumeYes, "shorthand for \"-yes\"")
+	fs.Func("error-format", "format of error messages on stderr (text or json, default $CERTSHOP_ERROR_FORMAT)", setErrorFormat)
+	if errorFormat == "json" {
+		// report flag errors only as json
+		fs.SetOutput(ioutil.Discard)
+	}
+}
+
+// debugTiming logs the time since start when "-debug" is set
+func debugTiming(phase string, start time.Time) {
+	if debug {
+		infoLog.Printf("DEBUG: %s took %s\n", phase, time.Since(start))
+	}
+}
+
+// checkPem fails if strictPem is set and the file contains anything
+// other than pem blocks and whitespace (pem.Decode silently skips it)
+func checkPem(fileName string, data []byte) {
+	if !strictPem {
+		return
+	}
+	rest := bytes.TrimSpace(data)
+	for len(rest) > 0 {
+		if !bytes.HasPrefix(rest, []byte("-----BEGIN ")) {
+			errorLog.Fatalf("Unexpected data in %s which is not part of a pem block: %.20q", fileName, rest)
+		}
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			errorLog.Fatalf("Malformed pem block in %s: %.20q", fileName, rest)
+		}
+		rest = bytes.TrimSpace(rest)
+	}
+}
+
+// parseCertChain parses every certificate in a pem file (ie. a
+// certificate followed by the certificates of the ca chain)
+func parseCertChain(fileName string) []*x509.Certificate {
+	der, err := ioutil.ReadFile(fileName)
 	if err != nil {
-		errorLog.Fatalf("Failed to read certificate file %s: %s", filepath.Join(path, filepath.Base(path)+".crt"), err)
+		errorLog.Fatalf("Failed to read certificate file %s: %s", fileName, err)
 	}
-	block, _ := pem.Decode(der)
-	if block == nil || block.Type != "CERTIFICATE" {
-		errorLog.Fatalf("Failed to decode certificate %s: %s", filepath.Join(path, filepath.Base(path)+".crt"), err)
+	checkPem(fileName, der)
+	certs, err := pki.ParseCertificates(der)
+	if err != nil {
+		errorLog.Fatalf("Failed to parse certificate %s: %s", fileName, err)
 	}
-	crt, err := x509.ParseCertificate(block.Bytes)
+	return certs
+}
+
+// walkCertificates calls fn for every certificate folder (a folder
+// containing name/name.crt) at or below root
+func walkCertificates(root string, fn func(path string, cert *x509.Certificate)) {
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(path, filepath.Base(path)+".crt")); err == nil {
+			fn(path, parseCert(path))
+		}
+		return nil
+	})
 	if err != nil {
-		errorLog.Fatalf("Failed to parse certificate %s: %s", filepath.Join(path, filepath.Base(path)+".crt"), err)
+		errorLog.Fatalf("Failed to walk %s: %s", root, err)
 	}
-	return crt
 }
 
 func parseKey(path string) *ecdsa.PrivateKey {
-	der, err := ioutil.ReadFile(filepath.Join(path, filepath.Base(path)+".key"))
+	return parseKeyFile(filepath.Join(path, filepath.Base(path)+".key"), "")
+}
+
+// parseKeyFile reads a pem or openssh format private key, decrypting
+// openssh keys with the password when one is given
+func parseKeyFile(fileName string, password string) *ecdsa.PrivateKey {
+	der, err := ioutil.ReadFile(fileName)
 	if err != nil {
-		errorLog.Fatalf("Failed to read private key file %s: %s", filepath.Join(path, filepath.Base(path)+".key"), err)
+		errorLog.Fatalf("Failed to read private key file %s: %s", fileName, err)
 	}
+	return parseKeyData(fileName, der, password)
+}
+
+// parseKeyData parses the pem or openssh format private key read from
+// fileName (ie. "-" for stdin), decrypting openssh keys with the
+// password when one is given
+func parseKeyData(fileName string, der []byte, password string) *ecdsa.PrivateKey {
+	checkPem(fileName, der)
 	block, _ := pem.Decode(der)
-	if block == nil || block.Type != "EC PRIVATE KEY" {
-		errorLog.Fatalf("Failed to decode private key for %s: %s", filepath.Join(path, filepath.Base(path)+".key"), err)
+	if block == nil || (block.Type != "EC PRIVATE KEY" && block.Type != "PRIVATE KEY" && block.Type != "OPENSSH PRIVATE KEY") {
+		errorLog.Fatalf("Failed to decode private key for %s", fileName)
+	}
+	var key *ecdsa.PrivateKey
+	var err error
+	if block.Type == "OPENSSH PRIVATE KEY" {
+		if key, err = parseOpenSSHKey(der, password); err != nil && password != "" {
+			errorLog.Fatalf("Failed to decrypt private key %s: %s", fileName, err)
+		}
+	} else if key, err = pki.ParsePrivateKey(block); err != nil && block.Type == "EC PRIVATE KEY" {
+		// keys written with "-ec-explicit-params"
+		if explicit, explicitErr := parseECPrivateKeyExplicit(block.Bytes); explicitErr == nil {
+			key, err = explicit, nil
+		}
 	}
-	key, err := x509.ParseECPrivateKey(block.Bytes)
 	if err != nil {
-		errorLog.Fatalf("Failed to parse private key for %s: %s", filepath.Join(path, filepath.Base(path)+".key"), err)
+		errorLog.Fatalf("Failed to parse private key for %s: %s", fileName, err)
 	}
 	return key
 }
 
+// loadOrGeneratePrivateKey reads the "-key-in" key file to reuse an
+// existing key (ie. for key continuity across renewals), or generates
+// a new key when no file is given
+func loadOrGeneratePrivateKey(keyIn string, passIn string) (*ecdsa.PrivateKey, []byte) {
+	if keyIn == "" {
+		key, derKey, err := generatePrivateKey()
+		if err != nil {
+			errorLog.Fatalf("Error generating private key: %s", err)
+		}
+		return key, derKey
+	}
+	infoLog.Printf("Reusing private key %s\n", keyIn)
+	key := parseKeyFile(keyIn, passIn)
+	derKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		errorLog.Fatalf("Error marshalling private key %s: %s", keyIn, err)
+	}
+	return key, derKey
+}
+
 func parseDn(ca *x509.Certificate, dn string) *pkix.Name {
 	infoLog.Printf("Parsing distinguished name: %s\n", dn)
 	var caName pkix.Name
@@ -389,6 +989,8 @@ func parseDn(ca *x509.Certificate, dn string) *pkix.Name {
 		switch strings.ToUpper(value[0]) {
 		case "CN": // commonName
 			newName.CommonName = value[1]
+		case "SERIALNUMBER": // serialNumber (as written by formatDn)
+			newName.SerialNumber = value[1]
 		case "C": // countryName
 			if value[1] == "" {
 				caName.Country = []string{}
@@ -433,81 +1035,443 @@ func parseDn(ca *x509.Certificate, dn string) *pkix.Name {
 	return newName
 }
 
+// parseRawSubject decodes a base64 der subject, which must be a
+// complete distinguished name
+func parseRawSubject(b64 string) ([]byte, *pkix.Name) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64))
+	if err != nil {
+		usageLog.Fatalf("Invalid \"-subject-raw\" value: %s", err)
+	}
+	var rdns pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(der, &rdns); err != nil {
+		usageLog.Fatalf("Invalid \"-subject-raw\" value: %s", err)
+	} else if len(rest) > 0 {
+		usageLog.Fatalf("Invalid \"-subject-raw\" value: trailing data after the distinguished name")
+	}
+	name := &pkix.Name{}
+	name.FillFromRDNSequence(&rdns)
+	return der, name
+}
+
+// formatDn formats a name the same way as the "-dn" flag
+// (ie. "/CN=host.domain.com/O=My Organization")
+func formatDn(name pkix.Name) string {
+	dn := ""
+	if name.CommonName != "" {
+		dn += "/CN=" + name.CommonName
+	}
+	if name.SerialNumber != "" {
+		dn += "/serialNumber=" + name.SerialNumber
+	}
+	for _, value := range name.Country {
+		dn += "/C=" + value
+	}
+	for _, value := range name.Locality {
+		dn += "/L=" + value
+	}
+	for _, value := range name.Province {
+		dn += "/ST=" + value
+	}
+	for _, value := range name.Organization {
+		dn += "/O=" + value
+	}
+	for _, value := range name.OrganizationalUnit {
+		dn += "/OU=" + value
+	}
+	return dn
+}
+
+var (
+	oidCountry      = asn1.ObjectIdentifier{2, 5, 4, 6}
+	oidSerialNumber = asn1.ObjectIdentifier{2, 5, 4, 5}
+)
+
+// rawSubject encodes the name with a single attribute per RDN in a fixed
+// order (C, ST, L, O, OU, CN, serialNumber), so that reissued
+// certificates have byte for byte identical subjects (go would combine
+// repeated attributes such as two OUs into one multi-valued RDN);
+// encoding is "printable" (go's default of PrintableString unless the
+// value has other characters) or "utf8" (UTF8String except for the
+// country and serialNumber, which must be PrintableString)
+func rawSubject(name pkix.Name, encoding string) []byte {
+	if encoding != "printable" && encoding != "utf8" {
+		usageLog.Fatalf("Invalid dn encoding %s (must be printable or utf8)", encoding)
+	}
+	rdns := pkix.RDNSequence{}
+	add := func(oid asn1.ObjectIdentifier, values ...string) {
+		for _, value := range values {
+			if value == "" {
+				continue
+			}
+			var v interface{} = value
+			if encoding == "utf8" && !oid.Equal(oidCountry) && !oid.Equal(oidSerialNumber) {
+				v = asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(value)}
+			}
+			rdns = append(rdns, pkix.RelativeDistinguishedNameSET{{Type: oid, Value: v}})
+		}
+	}
+	add(oidCountry, name.Country...)
+	add(asn1.ObjectIdentifier{2, 5, 4, 8}, name.Province...)
+	add(asn1.ObjectIdentifier{2, 5, 4, 7}, name.Locality...)
+	add(asn1.ObjectIdentifier{2, 5, 4, 10}, name.Organization...)
+	add(asn1.ObjectIdentifier{2, 5, 4, 11}, name.OrganizationalUnit...)
+	add(asn1.ObjectIdentifier{2, 5, 4, 3}, name.CommonName)
+	add(oidSerialNumber, name.SerialNumber)
+	raw, err := asn1.Marshal(rdns)
+	if err != nil {
+		errorLog.Fatalf("Failed to marshal subject %s: %s", formatDn(name), err)
+	}
+	return raw
+}
+
+// keyUsages are the names of the x509.KeyUsage bits in bit order
+var keyUsages = []string{"digitalSignature", "contentCommitment", "keyEncipherment", "dataEncipherment",
+	"keyAgreement", "keyCertSign", "cRLSign", "encipherOnly", "decipherOnly"}
+
+var extKeyUsages = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "serverAuth",
+	x509.ExtKeyUsageClientAuth:      "clientAuth",
+	x509.ExtKeyUsageCodeSigning:     "codeSigning",
+	x509.ExtKeyUsageEmailProtection: "emailProtection",
+	x509.ExtKeyUsageIPSECEndSystem:  "ipsecEndSystem",
+	x509.ExtKeyUsageIPSECTunnel:     "ipsecTunnel",
+	x509.ExtKeyUsageIPSECUser:       "ipsecUser",
+	x509.ExtKeyUsageTimeStamping:    "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSPSigning",
+}
+
+func keyUsageNames(keyUsage x509.KeyUsage) []string {
+	usages := []string{}
+	for i, name := range keyUsages {
+		if keyUsage&(1<<uint(i)) != 0 {
+			usages = append(usages, name)
+		}
+	}
+	return usages
+}
+
+func extKeyUsageNames(extKeyUsage []x509.ExtKeyUsage) []string {
+	usages := []string{}
+	for _, usage := range extKeyUsage {
+		if name, ok := extKeyUsages[usage]; ok {
+			usages = append(usages, name)
+		} else {
+			usages = append(usages, "unknown")
+		}
+	}
+	return usages
+}
+
+// parseKeyUsage parses a comma separated list of key usage names
+func parseKeyUsage(names string) x509.KeyUsage {
+	var keyUsage x509.KeyUsage
+	for _, name := range strings.Split(names, ",") {
+		found := false
+		for i, usage := range keyUsages {
+			if strings.EqualFold(name, usage) {
+				keyUsage |= 1 << uint(i)
+				found = true
+			}
+		}
+		if !found {
+			errorLog.Fatalf("Unknown key usage %s (must be one of %s)", name, strings.Join(keyUsages, ","))
+		}
+	}
+	return keyUsage
+}
+
+// parseExtKeyUsage parses a comma separated list of extended key usage
+// names
+func parseExtKeyUsage(names string) []x509.ExtKeyUsage {
+	extKeyUsage := []x509.ExtKeyUsage{}
+	for _, name := range strings.Split(names, ",") {
+		found := false
+		for usage, usageName := range extKeyUsages {
+			if strings.EqualFold(name, usageName) {
+				extKeyUsage = append(extKeyUsage, usage)
+				found = true
+			}
+		}
+		if !found {
+			errorLog.Fatalf("Unknown extended key usage %s", name)
+		}
+	}
+	return extKeyUsage
+}
+
 func exportCertificate(args []string) {
-	fs := flag.NewFlagSet("export", flag.PanicOnError)
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	addCommonFlags(fs)
 	crt := fs.Bool("crt", true, "include the certificate in pem format")
 	key := fs.Bool("key", true, "include the private key in pem format")
 	ca := fs.Bool("ca", true, "include the ca bundle in pem format")
 	p12 := fs.Bool("p12", false, "include certificate and key together in pkcs12 format")
 	password := fs.String("password", "", "password for pkcs12 format")
+	p12Append := fs.String("p12-append", "", "existing pkcs12 file to add the certificate chain to (instead of creating the pkcs12 file from the certificate's key)")
+	passIn := fs.String("pass-in", "", "password of the \"-p12-append\" file, or of the path when it is a pkcs12 file")
+	treeOut := fs.String("tree-out", "", "directory to save the certificate, chain and private key of a pkcs12 path to in the tree layout instead of exporting an archive")
+	trustStore := fs.Bool("trust-store", false, "include the ca certificate with a subject comment for appending to system trust bundles")
+	printOpenssl := fs.Bool("print-openssl-cmd", false, "print the openssl command used to create the pkcs12 file")
+	addOpensslFlags(fs)
+	legacy := fs.Bool("legacy", false, "encrypt the pkcs12 file with 3DES and SHA1 for compatibility with old systems")
+	p7b := fs.Bool("p7b", false, "include the certificate chain (without the private key) in pkcs7 format")
 	openvpn := fs.Bool("openvpn", false, "include snippet that can be concatenated to the end of openvpn config files")
+	includeRoot := fs.Bool("include-root", true, "include the self-signed root certificate in the certificate chain")
+	chainOrder := fs.String("chain-order", "leaf-first", "order of the certificate chain (leaf-first or root-first)")
+	archiveFormat := fs.String("archive-format", "tgz", "format of the exported archive (tgz or zip)")
+	leafOnly := fs.Bool("leaf-only", false, "include only the certificate itself without its chain in the certificate, pkcs12 and openvpn files")
+	appendCa := fs.Bool("append-ca", false, "include the ca certificate at the end of the certificate file instead of as a separate ca.pem file")
+	forceChainRebuild := fs.Bool("force-chain-rebuild", false, "rebuild the certificate chain by matching key ids instead of using the directory nesting")
+	keyEncoding := fs.String("key-encoding", "sec1", "encoding of the private key (sec1 for \"EC PRIVATE KEY\", pkcs8 for \"PRIVATE KEY\" or openssh)")
+	passOut := fs.String("pass-out", "", "passphrase to encrypt the exported private key with (openssh key encoding only)")
+	printDer := fs.Bool("print-der-base64", false, "print the base64 encoded der certificate to stdout instead of exporting a tarball")
+	derFormat := fs.String("format", "line", "output format of \"-print-der-base64\" (line for the certificate or x5c for a json array of the chain)")
+	certMode := fs.String("cert-mode", "0644", "file mode (octal) of certificate entries")
+	keyMode := fs.String("key-mode", "0600", "file mode (octal) of entries containing the private key")
+	owner := fs.String("owner", "", "uid:gid recorded as the owner of the tgz entries (default 0:0)")
+	ownerName := fs.String("owner-name", "", "user:group names recorded as the owner of the tgz entries (default none)")
 
 	err := fs.Parse(args)
 	if err != nil {
-		errorLog.Fatalf("Failed to parse command line arguments: %s", err)
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
 	}
 
 	if len(fs.Args()) != 1 {
-		errorLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
 	}
 	path := fs.Arg(0)
-	name := filepath.Base(path)
 	infoLog.Printf("Exporting Certificate %s", path)
-
-	gz := gzip.NewWriter(os.Stdout)
-	defer func() {
-		if err = gz.Close(); err != nil {
-			errorLog.Fatalf("Failed to close gzip writer: %s", err)
+	// the flags are checked before a pkcs12 file is read, so an invalid
+	// flag never leaves its extracted certificates behind
+	if *p12Append != "" {
+		*p12 = true
+	}
+	if !*crt && !*key && !*ca && !*p12 && !*p7b && !*openvpn && !*trustStore && !*printDer && *treeOut == "" {
+		usageLog.Fatalf("Nothing to export from %s (\"-crt\", \"-key\" and \"-ca\" are false and no other output was requested)", path)
+	}
+	if *appendCa && (*leafOnly || !*includeRoot) {
+		errorLog.Fatalf("The \"-append-ca\" option can't be used with \"-leaf-only\" or \"-include-root=false\"")
+	}
+	if *p12 && noOpenssl {
+		errorLog.Fatalf("The \"-p12\" option needs openssl but \"-no-openssl\" was given (there is no native pkcs12 implementation)")
+	}
+	if *p12 {
+		if err := checkOpenssl(); err != nil {
+			errorLog.Fatalf("The \"-p12\" option needs openssl: %s", err)
 		}
-	}()
+	}
+	if *p12 && !*printDer && *password == "" {
+		errorLog.Fatalf("A password is required to export to pkcs12 format")
+	}
+	if *keyEncoding != "sec1" && *keyEncoding != "pkcs8" && *keyEncoding != "openssh" {
+		usageLog.Fatalf("Invalid key encoding %s (must be sec1, pkcs8 or openssh)", *keyEncoding)
+	} else if *keyEncoding == "openssh" && *openvpn {
+		errorLog.Fatalf("The \"-openvpn\" option can't be used with \"-key-encoding=openssh\"")
+	}
+	if *passOut != "" && *keyEncoding != "openssh" {
+		errorLog.Fatalf("The \"-pass-out\" option is only supported with \"-key-encoding=openssh\"")
+	}
+	certPerms := parseFileMode("cert-mode", *certMode)
+	keyPerms := parseFileMode("key-mode", *keyMode)
+	entryOwner := parseTarOwner(*owner, *ownerName)
+	if (*owner != "" || *ownerName != "") && *archiveFormat != "tgz" {
+		errorLog.Fatalf("The \"-owner\" and \"-owner-name\" options are only supported with \"-archive-format=tgz\" (zip files don't record ownership)")
+	}
+	if *archiveFormat != "tgz" && *archiveFormat != "zip" {
+		usageLog.Fatalf("Invalid archive format %s (must be tgz or zip)", *archiveFormat)
+	}
+	if *chainOrder != "leaf-first" && *chainOrder != "root-first" {
+		usageLog.Fatalf("Invalid chain order %s (must be leaf-first or root-first)", *chainOrder)
+	}
+	if *printDer && *chainOrder == "root-first" && *derFormat == "x5c" {
+		errorLog.Fatalf("The x5c format must be in leaf-first order")
+	}
 
-	tw := tar.NewWriter(gz)
-	defer func() {
-		if err = tw.Close(); err != nil {
-			errorLog.Fatalf("Failed to close tar file: %s", err)
+	// a pkcs12 file is extracted to a temporary tree and exported like a
+	// certificate in the tree, except that its private key is only kept
+	// in memory
+	p12In := ""
+	var p12Key []byte
+	if isPKCS12File(path) {
+		p12In = path
+		if noOpenssl {
+			errorLog.Fatalf("Reading the pkcs12 file %s needs openssl but \"-no-openssl\" was given (there is no native pkcs12 implementation)", p12In)
 		}
-	}()
-	if *p12 {
-		if *password == "" {
-			errorLog.Fatalf("A password is required to export to pkcs12 format")
+		if err := checkOpenssl(); err != nil {
+			errorLog.Fatalf("Reading the pkcs12 file %s needs openssl: %s", p12In, err)
 		}
-		infoLog.Print("Running openssl to create p12 file")
-		cmd := exec.Command("openssl", "pkcs12", "-export", "-in", filepath.Join(path, name+".crt"), "-inkey", filepath.Join(path, name+".key"), "-passout", "stdin")
-		stdin, err := cmd.StdinPipe()
+		if *forceChainRebuild {
+			errorLog.Fatalf("The \"-force-chain-rebuild\" option can't be used with a pkcs12 file")
+		}
+		if *treeOut != "" {
+			if _, err := os.Stat(*treeOut); err == nil {
+				errorLog.Fatalf("Skipping export of %s because %s already exists", p12In, *treeOut)
+			}
+			readP12Tree(p12In, *passIn).save(filepath.Clean(*treeOut))
+			infoLog.Printf("Finished Exporting Certificate %s to %s", p12In, *treeOut)
+			return
+		}
+		tree := readP12Tree(p12In, *passIn)
+		if tree.ca == nil && (*appendCa || *trustStore || *openvpn) {
+			errorLog.Fatalf("The \"-append-ca\", \"-trust-store\" and \"-openvpn\" options need the root certificate, which isn't in %s", p12In)
+		} else if tree.ca == nil && *ca {
+			infoLog.Printf("WARNING: %s has no root certificate so ca.pem isn't exported\n", p12In)
+			*ca = false
+		}
+		p12Key = tree.key
+		// the temporary directory is only readable by the current user
+		tempDir, err := ioutil.TempDir("", "certshop")
 		if err != nil {
-			errorLog.Fatalf("Failed to open stdin pipe to openssl: %s", err)
+			errorLog.Fatalf("Failed to create temporary directory: %s", err)
 		}
-		go func() {
+		defer func() {
+			if err := os.RemoveAll(tempDir); err != nil {
+				errorLog.Fatalf("Failed to remove temporary directory %s: %s", tempDir, err)
+			}
+		}()
+		path = filepath.Join(tempDir, sanitizeArchiveName(p12TreeName(p12In), "cert"))
+		tree.saveCerts(path)
+	} else if *treeOut != "" {
+		errorLog.Fatalf("The \"-tree-out\" option can only be used when the path is a pkcs12 file")
+	}
+	if *appendCa {
+		*ca = false
+	}
+	base := filepath.Base(path)
+	name := sanitizeArchiveName(base, "cert")
+	keyFile := filepath.Join(path, base+".key")
+	// only the private key is needed when nothing else is exported, ie.
+	// to hand over a key whose certificate is issued elsewhere
+	keyOnly := *key && !*crt && !*ca && !*p12 && !*p7b && !*openvpn && !*trustStore && !*appendCa && !*printDer && !*forceChainRebuild
+	if _, err := os.Stat(keyFile); p12In == "" && os.IsNotExist(err) && *key && !*p12 && !keyOnly && parseCert(path).IsCA {
+		// ie. a root ca whose key was moved offline by bootstrap, which
+		// is exported to distribute it as a trust anchor
+		infoLog.Printf("WARNING: %s has no private key so only the certificate is exported\n", path)
+		*key = false
+	}
+	// readKey returns the private key, which is never written to disk for
+	// a pkcs12 file
+	readKey := func() []byte {
+		if p12In != "" {
+			return p12Key
+		}
+		return []byte(readFile(keyFile))
+	}
+
+	// fail before anything is written to stdout rather than leaving a
+	// truncated archive
+	// (the key of a pkcs12 file was already matched to its certificate)
+	if p12In == "" {
+		checkExportFiles(path, !keyOnly, *key || *openvpn || (*p12 && *p12Append == ""), *ca || *appendCa || *trustStore || *openvpn)
+	}
+
+	certFile := filepath.Join(path, base+".crt")
+	var chain []byte
+	if *forceChainRebuild {
+		root := chainSearchRoot(path)
+		if chain = rebuildChain(root, path); chain == nil {
+			infoLog.Printf("WARNING: unable to rebuild the chain from key ids under %s, using %s", root, certFile)
+		}
+	}
+	if chain == nil && !keyOnly && (!*includeRoot || *chainOrder == "root-first" || *leafOnly || *appendCa) {
+		chain = []byte(readFile(certFile))
+	}
+	if chain != nil {
+		if *appendCa {
+			chain = appendCaCerts(chain, filepath.Join(path, "ca.pem"))
+		}
+		if *leafOnly {
+			chain = leafOfChain(chain)
+		}
+		if !*includeRoot {
+			if chain = stripRoot(string(chain)); len(chain) == 0 {
+				errorLog.Fatalf("Nothing is left of the certificate chain of %s without the root certificate; export a root ca without \"-include-root=false\"", fs.Arg(0))
+			}
+		}
+		if *chainOrder == "root-first" {
+			chain = reversePem(chain)
+		}
+		if *p12 {
+			// openssl reads the certificate chain from a file
+			certFile = writeTempFile(chain)
 			defer func() {
-				if err = stdin.Close(); err != nil {
-					errorLog.Fatalf("Failed to close stdin pipe to openssl: %s", err)
+				if err := os.Remove(certFile); err != nil {
+					errorLog.Fatalf("Failed to remove temporary file %s: %s", certFile, err)
 				}
 			}()
-			if _, err = io.WriteString(stdin, *password); err != nil {
-				errorLog.Fatalf("Failed to transfer password to openssl: %s", err)
-			}
-		}()
-		out, err := cmd.Output()
-		if err != nil {
-			errorLog.Fatalf("Error running openssl: %s", err)
 		}
-		header := &tar.Header{Name: name + ".p12", Mode: 0600, ModTime: time.Now().UTC(), Size: int64(len(out))}
-		if err = tw.WriteHeader(header); err != nil {
-			errorLog.Fatalf("Failed to write tar header: %s", err)
+	}
+
+	if *printDer {
+		certs := chain
+		if certs == nil {
+			certs = []byte(readFile(certFile))
+		}
+		printDerBase64(certs, *derFormat)
+		return
+	}
+
+	archive := newArchiveWriter(*archiveFormat, os.Stdout, entryOwner)
+	defer archive.close()
+	if *p12 {
+		infoLog.Print("Running openssl to create p12 file")
+		args := []string{"pkcs12", "-export", "-in", certFile, "-inkey", keyFile, "-passout", "stdin"}
+		input, env := []byte(*password), []string(nil)
+		if p12In != "" && *p12Append == "" {
+			// openssl reads the key from stdin before the certificates, so
+			// the password is passed in its environment
+			args = []string{"pkcs12", "-export", "-passout", "env:" + p12PasswordVar}
+			input = append(append([]byte{}, p12Key...), readFile(certFile)...)
+			env = []string{p12PasswordVar + "=" + *password}
+		} else if *p12Append != "" {
+			// stdin holds the contents of the pkcs12 file, so the password
+			// is passed in the environment of openssl
+			args, input = p12AppendArgs(*p12Append, *passIn, []byte(readFile(certFile)), base)
+			env = []string{p12PasswordVar + "=" + *password}
+		}
+		if *legacy {
+			// 3DES and SHA1 are understood by old systems and supported by
+			// both OpenSSL 1.x and 3.x (RC2 would need the 3.x legacy provider)
+			args = append(args, "-certpbe", "PBE-SHA1-3DES", "-keypbe", "PBE-SHA1-3DES", "-macalg", "sha1")
+		}
+		if *printOpenssl {
+			printOpensslCmd(append([]string{"openssl"}, args...)...)
 		}
-		if _, err = tw.Write(out); err != nil {
-			errorLog.Fatalf("Failed to write tar file: %s", err)
+		out, err := runOpensslInput(args, input, env)
+		if err != nil {
+			errorLog.Fatalf("Error running openssl: %s", err)
 		}
+		archive.appendData(out, name+".p12", "", keyPerms)
 		infoLog.Print("Finished running openssl")
 	}
-	if *crt {
-		tarAppendFile(tw, filepath.Join(path, name+".crt"), name+".crt", "cert.pem", 0644)
+	if *crt && chain != nil {
+		archive.appendData(chain, name+".crt", "cert.pem", certPerms)
+	} else if *crt {
+		archive.appendFile(filepath.Join(path, base+".crt"), name+".crt", "cert.pem", certPerms)
 	}
-	if *key {
-		tarAppendFile(tw, filepath.Join(path, name+".key"), name+".key", "key.pem", 0600)
+	if *key && *keyEncoding == "pkcs8" {
+		archive.appendData(pkcs8Key(keyFile, readKey()), name+".key", "key.pem", keyPerms)
+	} else if *key && *keyEncoding == "openssh" {
+		archive.appendData(opensshKey(keyFile, readKey(), *passOut), name+".key", "key.pem", keyPerms)
+	} else if *key && p12In != "" {
+		archive.appendData(p12Key, name+".key", "key.pem", keyPerms)
+	} else if *key {
+		archive.appendFile(keyFile, name+".key", "key.pem", keyPerms)
 	}
 	if *ca {
-		tarAppendFile(tw, filepath.Join(path, "ca.pem"), "ca.pem", "", 0644)
+		archive.appendFile(filepath.Join(path, "ca.pem"), "ca.pem", "", certPerms)
+	}
+	if *trustStore {
+		trust, trustName := trustStoreCert(filepath.Join(path, "ca.pem"))
+		archive.appendData(trust, trustName, "", certPerms)
+	}
+	if *p7b {
+		certs := chain
+		if certs == nil {
+			certs = []byte(readFile(filepath.Join(path, base+".crt")))
+		}
+		archive.appendData(marshalP7b(certs), name+".p7b", "", certPerms)
 	}
 	if *openvpn {
 		type config struct {
@@ -518,25 +1482,95 @@ func exportCertificate(args []string) {
 		if err != nil {
 			errorLog.Fatalf("Error parsing ovpn config template: %s", err)
 		}
+		cert := readFile(filepath.Join(path, base+".crt"))
+		if chain != nil {
+			cert = string(chain)
+		}
+		privateKey := string(readKey())
+		if *keyEncoding == "pkcs8" {
+			privateKey = string(pkcs8Key(keyFile, readKey()))
+		}
 		buf := new(bytes.Buffer)
 		if err = tmpl.Execute(buf,
 			config{Ca: readFile(filepath.Join(path, "ca.pem")),
-				Cert: readFile(filepath.Join(path, name+".crt")),
-				Key:  readFile(filepath.Join(path, name+".key"))}); err != nil {
+				Cert: cert,
+				Key:  privateKey}); err != nil {
 			errorLog.Fatalf("Error creating ovpn config: %s", err)
 		}
-		header := &tar.Header{Name: name + ".ovpn", Mode: 0600, ModTime: time.Now().UTC(), Size: int64(buf.Len())}
-		if err = tw.WriteHeader(header); err != nil {
-			errorLog.Fatalf("Failed to write tar header: %s", err)
+		archive.appendData(buf.Bytes(), name+".ovpn", "", keyPerms)
+	}
+	infoLog.Printf("Finished Exporting Certificate %s", fs.Arg(0))
+}
+
+// pkcs8Key returns the private key read from keyFile as a pkcs8 "PRIVATE
+// KEY" pem block, which some tools (ie. java) require instead of sec1
+func pkcs8Key(keyFile string, data []byte) []byte {
+	// keys extracted from pkcs12 files which aren't ecdsa are already pkcs8
+	if block, _ := pem.Decode(data); block != nil && block.Type == "PRIVATE KEY" {
+		return pem.EncodeToMemory(block)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(parseKeyData(keyFile, data, ""))
+	if err != nil {
+		errorLog.Fatalf("Failed to marshal private key %s: %s", keyFile, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// opensshKey returns the private key read from keyFile in openssh
+// format, encrypted with passOut when it is given
+func opensshKey(keyFile string, data []byte, passOut string) []byte {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		errorLog.Fatalf("Failed to decode private key %s", keyFile)
+	}
+	for format, blockType := range keyBlockTypes {
+		if block.Type == blockType {
+			return convertKey(keyFile, data, format, "openssh", "", passOut)
 		}
-		if _, err = tw.Write(buf.Bytes()); err != nil {
-			errorLog.Fatalf("Failed to write tar file: %s", err)
+	}
+	errorLog.Fatalf("Unsupported private key type %s in %s", block.Type, keyFile)
+	return nil
+}
+
+// checkExportFiles fails if path isn't a certificate directory or if
+// the certificate (when needCert), the private key (when needKey) or the
+// ca bundle (when needCa) can't be read and parsed
+func checkExportFiles(path string, needCert bool, needKey bool, needCa bool) {
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		errorLog.Fatalf("%s is not a certificate directory", path)
+	}
+	var cert *x509.Certificate
+	if needCert {
+		cert = parseCert(path)
+	}
+	if needKey {
+		keyFile := filepath.Join(path, filepath.Base(path)+".key")
+		block, _ := pem.Decode([]byte(readFile(keyFile)))
+		if block == nil {
+			errorLog.Fatalf("Failed to decode private key %s", keyFile)
 		}
+		// encrypted openssh keys are exported as they are
+		if block.Type != "OPENSSH PRIVATE KEY" {
+			key := parseKey(path)
+			if cert != nil && !publicKeysEqual(cert.PublicKey, key.Public()) {
+				errorLog.Fatalf("The private key %s doesn't match the certificate", keyFile)
+			}
+		}
+	}
+	if needCa && len(parseCertsPem([]byte(readFile(filepath.Join(path, "ca.pem"))))) == 0 {
+		errorLog.Fatalf("No certificates found in %s", filepath.Join(path, "ca.pem"))
 	}
-	infoLog.Printf("Finished Exporting Certificate %s", path)
 }
 
-func tarAppendFile(tw *tar.Writer, path string, tarPath string, altTarPath string, mode int64) {
+func parseFileMode(flagName string, mode string) int64 {
+	perms, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perms > 0777 {
+		usageLog.Fatalf("Invalid \"-%s\" value %s (must be an octal file mode such as 0600)", flagName, mode)
+	}
+	return int64(perms)
+}
+
+func tarAppendFile(tw *tar.Writer, owner tarOwner, path string, tarPath string, altTarPath string, mode int64) {
 	info, err := os.Stat(path)
 	if err != nil {
 		errorLog.Fatalf("Failed to read file metadata: %s", path)
@@ -550,19 +1584,165 @@ func tarAppendFile(tw *tar.Writer, path string, tarPath string, altTarPath strin
 			errorLog.Fatalf("Failed to close %s: %s", path, err)
 		}
 	}()
-	if err := tw.WriteHeader(&tar.Header{Name: tarPath, Mode: mode, ModTime: info.ModTime(), Size: info.Size()}); err != nil {
+	if err := tw.WriteHeader(owner.apply(&tar.Header{Name: tarPath, Mode: mode, ModTime: info.ModTime(), Size: info.Size()})); err != nil {
 		errorLog.Fatalf("Failed to write tar header: %s", path)
 	}
 	if _, err := io.Copy(tw, file); err != nil {
 		errorLog.Fatalf("Failed to write tar file: %s", path)
 	}
 	if altTarPath != "" {
-		if err := tw.WriteHeader(&tar.Header{Name: altTarPath, Mode: mode, ModTime: info.ModTime(), Linkname: tarPath, Typeflag: tar.TypeLink}); err != nil {
+		if err := tw.WriteHeader(owner.apply(&tar.Header{Name: altTarPath, Mode: mode, ModTime: info.ModTime(), Linkname: tarPath, Typeflag: tar.TypeLink})); err != nil {
 			errorLog.Fatalf("Failed to create hard links in tar file: %s", path)
 		}
 	}
 }
 
+func tarAppendData(tw *tar.Writer, owner tarOwner, data []byte, tarPath string, altTarPath string, mode int64) {
+	if err := tw.WriteHeader(owner.apply(&tar.Header{Name: tarPath, Mode: mode, ModTime: runTime, Size: int64(len(data))})); err != nil {
+		errorLog.Fatalf("Failed to write tar header: %s", tarPath)
+	}
+	if _, err := tw.Write(data); err != nil {
+		errorLog.Fatalf("Failed to write tar file: %s", tarPath)
+	}
+	if altTarPath != "" {
+		if err := tw.WriteHeader(owner.apply(&tar.Header{Name: altTarPath, Mode: mode, ModTime: runTime, Linkname: tarPath, Typeflag: tar.TypeLink})); err != nil {
+			errorLog.Fatalf("Failed to create hard links in tar file: %s", tarPath)
+		}
+	}
+}
+
+// isSelfSigned reports whether the certificate is a root certificate
+// (the issuer is the subject and it is signed by its own key)
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// leafOfChain returns the first pem block of the certificate chain
+func leafOfChain(chain []byte) []byte {
+	block, _ := pem.Decode(chain)
+	if block == nil {
+		errorLog.Fatalf("Failed to parse certificate chain: no pem data found")
+	}
+	return pem.EncodeToMemory(block)
+}
+
+// appendCaCerts adds the certificates in caFile which aren't already in
+// the pem encoded chain to the end of it
+func appendCaCerts(chain []byte, caFile string) []byte {
+	present := map[string]bool{}
+	for _, cert := range parseCertsPem(chain) {
+		present[string(cert.Raw)] = true
+	}
+	for _, cert := range parseCertsPem([]byte(readFile(caFile))) {
+		if !present[string(cert.Raw)] {
+			chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+		}
+	}
+	return chain
+}
+
+// stripRoot removes the root certificates from a pem encoded certificate
+// chain: self-signed certificates, and certificate authorities that
+// aren't issued by another certificate in the chain (ie. an imported
+// cross-signed ca at the top of the tree)
+func stripRoot(chain string) []byte {
+	certs := []*x509.Certificate{}
+	rest := []byte(chain)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			errorLog.Fatalf("Failed to parse certificate chain: %s", err)
+		}
+		certs = append(certs, cert)
+	}
+	stripped := []byte{}
+	for _, cert := range certs {
+		if !isChainTerminus(cert, certs) {
+			stripped = append(stripped, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+		}
+	}
+	return stripped
+}
+
+// trustStoreCert formats the ca certificate the way system trust
+// bundles do (a comment with the subject before the pem block) and
+// returns a file name suitable for update-ca-certificates, which
+// requires a .crt extension
+func trustStoreCert(caFile string) ([]byte, string) {
+	cert := parseCertChain(caFile)[0]
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "# Subject: %s\n# SHA256 Fingerprint: %x\n", formatDn(cert.Subject), sha256.Sum256(cert.Raw))
+	if err := pem.Encode(buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+		errorLog.Fatalf("Failed to marshall %s: %s", caFile, err)
+	}
+	return buf.Bytes(), sanitizeArchiveName(cert.Subject.CommonName, "ca") + ".crt"
+}
+
+// sanitizeArchiveName makes a name safe to use for tar entries on any
+// system by replacing path separators, control and other unusual
+// characters, and avoiding names reserved by windows (ie. con or lpt1)
+func sanitizeArchiveName(name string, fallback string) string {
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+	// no leading dots (hidden files, "..") or trailing dots (dropped by windows)
+	name = strings.Trim(name, ".")
+	if name == "" {
+		return fallback
+	}
+	switch base := strings.ToUpper(strings.SplitN(name, ".", 2)[0]); base {
+	case "CON", "PRN", "AUX", "NUL":
+		return "_" + name
+	default:
+		if len(base) == 4 && (strings.HasPrefix(base, "COM") || strings.HasPrefix(base, "LPT")) && base[3] >= '0' && base[3] <= '9' {
+			return "_" + name
+		}
+	}
+	return name
+}
+
+// reversePem reverses the order of the blocks in pem encoded data
+func reversePem(data []byte) []byte {
+	blocks := []*pem.Block{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		blocks = append([]*pem.Block{block}, blocks...)
+	}
+	reversed := []byte{}
+	for _, block := range blocks {
+		reversed = append(reversed, pem.EncodeToMemory(block)...)
+	}
+	return reversed
+}
+
+func writeTempFile(data []byte) string {
+	file, err := ioutil.TempFile("", "certshop")
+	if err != nil {
+		errorLog.Fatalf("Failed to create temporary file: %s", err)
+	}
+	defer func() {
+		if err = file.Close(); err != nil {
+			errorLog.Fatalf("Failed to close %s: %s", file.Name(), err)
+		}
+	}()
+	if _, err = file.Write(data); err != nil {
+		errorLog.Fatalf("Failed to write %s: %s", file.Name(), err)
+	}
+	return file.Name()
+}
+
 func copyFile(source string, dest string, perms os.FileMode) {
 	sourceFile, err := os.Open(source)
 	if err != nil {
@@ -573,7 +1753,7 @@ func copyFile(source string, dest string, perms os.FileMode) {
 			errorLog.Fatalf("Failed to close %s: %s", source, err)
 		}
 	}()
-	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE, perms)
+	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perms)
 	if err != nil {
 		errorLog.Fatalf("Failed to open %s for writing: %s", dest, err)
 	}
@@ -587,6 +1767,12 @@ func copyFile(source string, dest string, perms os.FileMode) {
 	}
 }
 
+func writeFile(fileName string, data []byte, perms os.FileMode) {
+	if err := ioutil.WriteFile(fileName, data, perms); err != nil {
+		errorLog.Fatalf("Failed to write %s: %s", fileName, err)
+	}
+}
+
 func readFile(path string) string {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -0,0 +1,905 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateDirectoryPermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions aren't enforced for root")
+	}
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0755)
+
+	res := runCertshop(t, dir, nil, "ca", "-dn=/CN=other", "other")
+	if res.code == 0 {
+		t.Fatal("creating a ca in a read-only folder succeeded")
+	}
+	if !strings.Contains(res.stderr, "Permission denied") || !strings.Contains(res.stderr, "write access") {
+		t.Errorf("the error doesn't explain the permission problem:\n%s", res.stderr)
+	}
+	// read-only commands still work
+	certshop(t, dir, "inspect", "ca/ca.crt")
+	certshop(t, dir, "verify", "ca")
+}
+
+func TestReadOnlyCommandsDontCreateFiles(t *testing.T) {
+	dir := newTree(t)
+	tests := [][]string{
+		{"inspect", "ca/ica/server/server.crt"},
+		{"verify", "ca/ica/server"},
+		{"describe", "ca"},
+		{"expiring", "ca"},
+		{"diff", "ca/ica/server/server.crt", "ca/ica/ica.crt"},
+		{"audit-keys", "ca"},
+		{"lint", "ca"},
+		{"export", "ca/ica/server"},
+		{"selftest"},
+		{"unknown-command"},
+	}
+	for _, args := range tests {
+		t.Run(args[0], func(t *testing.T) {
+			before := strings.Join(listTree(t, dir), "\n")
+			runCertshop(t, dir, nil, args...)
+			if after := strings.Join(listTree(t, dir), "\n"); after != before {
+				t.Errorf("the tree changed from:\n%s\nto:\n%s", before, after)
+			}
+		})
+	}
+
+	empty := t.TempDir()
+	for _, command := range []string{"describe", "expiring", "lint", "audit-keys"} {
+		runCertshop(t, empty, nil, command)
+	}
+	if paths := listTree(t, empty); len(paths) != 1 {
+		t.Errorf("read-only commands created %s in an empty folder", strings.Join(paths[1:], ", "))
+	}
+}
+
+func TestParseIPRanges(t *testing.T) {
+	tests := []struct {
+		ranges string
+		want   []string
+	}{
+		{"", nil},
+		{"10.0.0.0/8", []string{"10.0.0.0/8"}},
+		{"10.1.2.3/16", []string{"10.1.0.0/16"}},
+		{"192.168.1.1", []string{"192.168.1.1/32"}},
+		{"2001:db8::/32,2001:db8::1", []string{"2001:db8::/32", "2001:db8::1/128"}},
+	}
+	for _, tt := range tests {
+		got := []string{}
+		for _, ipNet := range parseIPRanges(tt.ranges) {
+			got = append(got, ipNet.String())
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("parseIPRanges(%q) = %v, want %v", tt.ranges, got, tt.want)
+		}
+	}
+}
+
+func TestPermittedIPConstraint(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root", "-permitted-ip=10.0.0.0/24")
+	root := readCert(t, filepath.Join(dir, "ca/ca.crt"))
+	if len(root.PermittedIPRanges) != 1 || root.PermittedIPRanges[0].String() != "10.0.0.0/24" {
+		t.Fatalf("got permitted ip ranges %v, want 10.0.0.0/24", root.PermittedIPRanges)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	tests := []struct {
+		ip string
+		ok bool
+	}{
+		{"10.0.0.1", true},
+		{"10.0.0.254", true},
+		{"10.0.1.1", false},
+		{"192.168.0.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			path := "ca/" + strings.ReplaceAll(tt.ip, ".", "-")
+			certshop(t, dir, "server", "-dn=/CN=server", "-san="+tt.ip, path)
+			cert := readCert(t, filepath.Join(dir, path, filepath.Base(path)+".crt"))
+			_, err := cert.Verify(x509.VerifyOptions{Roots: roots})
+			if tt.ok && err != nil {
+				t.Errorf("verification failed for the permitted ip: %s", err)
+			} else if !tt.ok && err == nil {
+				t.Error("verification succeeded for an ip outside the permitted range")
+			}
+		})
+	}
+}
+
+func TestShortLivedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	tests := []struct {
+		name      string
+		validFor  string
+		clockSkew string
+		validity  time.Duration
+		skew      time.Duration
+	}{
+		{"ten minutes", "10m", "", 10 * time.Minute, defaultClockSkew},
+		{"two hours without skew", "2h", "0s", 2 * time.Hour, 0},
+		{"ninety seconds", "90s", "1m", 90 * time.Second, time.Minute},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fmt.Sprintf("ca/short%d", i)
+			args := []string{"server", "-dn=/CN=short", "-valid-for=" + tt.validFor}
+			if tt.clockSkew != "" {
+				args = append(args, "-clock-skew="+tt.clockSkew)
+			}
+			args = append(args, path)
+			before := time.Now().Truncate(time.Second)
+			certshop(t, dir, args...)
+			after := time.Now()
+			cert := readCert(t, filepath.Join(dir, path, filepath.Base(path)+".crt"))
+			if got := cert.NotAfter.Sub(cert.NotBefore); got != tt.validity+tt.skew {
+				t.Errorf("got a validity window of %s, want %s", got, tt.validity+tt.skew)
+			}
+			if cert.NotAfter.Before(before.Add(tt.validity)) || cert.NotAfter.After(after.Add(tt.validity)) {
+				t.Errorf("not after %s isn't %s after the run time", cert.NotAfter, tt.validity)
+			}
+		})
+	}
+
+	for _, validFor := range []string{"-10m", "ten minutes"} {
+		if res := runCertshop(t, dir, nil, "server", "-valid-for="+validFor, "ca/invalid"); res.code == 0 {
+			t.Errorf("the invalid \"-valid-for=%s\" was accepted", validFor)
+		}
+	}
+}
+
+func TestSubjectAlternativeNameProfile(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	tests := []struct {
+		name    string
+		args    []string
+		warning string
+	}{
+		{"server", []string{"server", "-san=www.example.com"}, ""},
+		{"server with email", []string{"server", "-san=www.example.com,admin@example.com"}, "email subject alternative names"},
+		{"server without names", []string{"server", "-san="}, "no dns or ip subject alternative names"},
+		{"signature with dns", []string{"signature", "-san=www.example.com"}, "aren't used for digital signatures"},
+		{"smime without email", []string{"client", "-ext-key-usage=emailProtection"}, "no email subject alternative names"},
+		{"smime", []string{"client", "-ext-key-usage=emailProtection", "-dn=/CN=Admin", "-san=admin@example.com"}, ""},
+		{"smime with email in cn", []string{"client", "-ext-key-usage=emailProtection", "-dn=/CN=admin@example.com", "-san=admin@example.com"}, "email address admin@example.com in the common name"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, strict := range []bool{false, true} {
+				path := fmt.Sprintf("ca/profile%d-%t", i, strict)
+				args := append(append([]string{}, tt.args...), fmt.Sprintf("-strict=%t", strict), path)
+				res := runCertshop(t, dir, nil, args...)
+				switch {
+				case tt.warning == "" && res.code != 0:
+					t.Errorf("strict=%t: failed with %s", strict, res.stderr)
+				case tt.warning == "" && strings.Contains(res.stderr, "WARNING"):
+					t.Errorf("strict=%t: unexpected warning %s", strict, res.stderr)
+				case tt.warning != "" && !strings.Contains(res.stderr, tt.warning):
+					t.Errorf("strict=%t: %q isn't reported in %s", strict, tt.warning, res.stderr)
+				case tt.warning != "" && strict && res.code == 0:
+					t.Error("strict=true: the problem isn't an error")
+				case tt.warning != "" && !strict && res.code != 0:
+					t.Errorf("strict=false: the problem isn't just a warning: %s", res.stderr)
+				}
+			}
+		})
+	}
+}
+
+func TestPrivateKeyPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions aren't supported on windows")
+	}
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	certshop(t, dir, "server", "-key-out=out/server.key", "-cert-out=out/server.crt", "ca/server")
+	keyFile := filepath.Join(dir, "ca/server/server.key")
+	// an overwritten key doesn't keep looser permissions
+	if err := os.Chmod(keyFile, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "out/server.key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	certshop(t, dir, "server", "-overwrite", "-overwrite-keys", "-yes", "-key-out=out/server.key", "ca/server")
+
+	for _, fileName := range []string{"ca/ca.key", "ca/server/server.key", "out/server.key"} {
+		info, err := os.Stat(filepath.Join(dir, fileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != privatePerms {
+			t.Errorf("%s has mode %04o, want %04o", fileName, mode, privatePerms)
+		}
+	}
+}
+
+func TestStrictPem(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	data, err := os.ReadFile(filepath.Join(dir, "ca/ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	junk := []byte{0x8f, 0x01, 'j', 'u', 'n', 'k', 0xff}
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"clean", data, true},
+		{"surrounding whitespace", append(append([]byte("\n\n"), data...), "\n  \n"...), true},
+		{"trailing bytes", append(append([]byte{}, data...), junk...), false},
+		{"leading text", append([]byte("subject=/CN=root\n"), data...), false},
+		{"bytes between blocks", append(append(append([]byte{}, data...), junk...), data...), false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fmt.Sprintf("copy%d", i)
+			if err := os.MkdirAll(filepath.Join(dir, path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, path, path+".crt"), tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			certshop(t, dir, "verify", "-ca-only", path)
+			res := runCertshop(t, dir, nil, "verify", "-ca-only", "-strict-pem", path)
+			if tt.ok && res.code != 0 {
+				t.Errorf("\"-strict-pem\" rejected the file: %s", res.stderr)
+			} else if !tt.ok && (res.code == 0 || !strings.Contains(res.stderr, "not part of a pem block")) {
+				t.Errorf("\"-strict-pem\" didn't reject the file: %s", res.stderr)
+			}
+		})
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		args []string
+		path string
+		skew time.Duration
+	}{
+		{[]string{"ca", "-dn=/CN=root", "-maxPathLength=1"}, "ca", defaultClockSkew},
+		{[]string{"ica", "-clock-skew=1h"}, "ca/ica", time.Hour},
+		{[]string{"server"}, "ca/ica/server", defaultClockSkew},
+		{[]string{"client", "-clock-skew=5m"}, "ca/ica/client", 5 * time.Minute},
+		{[]string{"signature", "-clock-skew=0s"}, "ca/ica/sign", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			before := time.Now().Truncate(time.Second)
+			certshop(t, dir, append(tt.args, tt.path)...)
+			after := time.Now()
+			cert := readCert(t, filepath.Join(dir, tt.path, filepath.Base(tt.path)+".crt"))
+			if cert.NotBefore.Before(before.Add(-tt.skew)) || cert.NotBefore.After(after.Add(-tt.skew)) {
+				t.Errorf("not before %s isn't %s before the run time (%s)", cert.NotBefore, tt.skew, before)
+			}
+		})
+	}
+}
+
+func TestSubjectSerialNumber(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	tests := []struct {
+		path string
+		args []string
+		want string
+	}{
+		{"ca/flag", []string{"-dn=/CN=device", "-subject-serial=DEV-0042"}, "DEV-0042"},
+		{"ca/dn", []string{"-dn=/CN=device/serialNumber=DEV-0043"}, "DEV-0043"},
+		{"ca/numeric", []string{"-dn=/CN=device", "-subject-serial=12345"}, "12345"},
+		{"ca/none", []string{"-dn=/CN=device"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			certshop(t, dir, append(append([]string{"client"}, tt.args...), tt.path)...)
+			cert := parseCert(filepath.Join(dir, tt.path))
+			if cert.Subject.SerialNumber != tt.want {
+				t.Errorf("got subject serial number %q, want %q", cert.Subject.SerialNumber, tt.want)
+			}
+			if tt.want != "" && (cert.SerialNumber.String() == tt.want || cert.SerialNumber.Text(16) == tt.want) {
+				t.Error("the certificate serial number is the subject serial number")
+			}
+		})
+	}
+}
+
+func TestCommonNameNotAddedToSubjectAlternativeNames(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	tests := []struct {
+		path string
+		args []string
+		want []string
+	}{
+		{"ca/server", []string{"server", "-dn=/CN=legacy.example.com", "-san=alt.example.com"}, []string{"alt.example.com"}},
+		{"ca/ip", []string{"server", "-dn=/CN=legacy.example.com", "-san=10.0.0.1"}, nil},
+		{"ca/client", []string{"client", "-dn=/CN=client.example.com"}, nil},
+		{"ca/both", []string{"server", "-dn=/CN=www.example.com", "-san=www.example.com,alt.example.com"}, []string{"www.example.com", "alt.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			certshop(t, dir, append(tt.args, tt.path)...)
+			names := parseCert(filepath.Join(dir, tt.path)).DNSNames
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got dns names %v, want %v", names, tt.want)
+			}
+		})
+	}
+
+	// signing the certificate again mustn't add the common name either
+	certshop(t, dir, "ca", "-dn=/CN=other root", "other")
+	certshop(t, dir, "cross-sign", "-cert=ca/server", "other/server")
+	if names := parseCert(filepath.Join(dir, "other/server")).DNSNames; strings.Join(names, ",") != "alt.example.com" {
+		t.Errorf("the cross-signed certificate has dns names %v", names)
+	}
+}
+
+func TestIPOnlyServerCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	tests := []struct {
+		path string
+		dn   string
+		san  string
+		ips  []string
+	}{
+		{"ca/ipv4", "/CN=10.0.0.5", "10.0.0.5", []string{"10.0.0.5"}},
+		{"ca/ipv6", "/CN=service", "[fd00::5]", []string{"fd00::5"}},
+		{"ca/both", "/CN=10.0.0.6", "10.0.0.6,fd00::6", []string{"10.0.0.6", "fd00::6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			certshop(t, dir, "server", "-dn="+tt.dn, "-san="+tt.san, tt.path)
+			cert := parseCert(filepath.Join(dir, tt.path))
+			if len(cert.DNSNames) != 0 {
+				t.Errorf("got dns names %v for an ip only certificate", cert.DNSNames)
+			}
+			if len(cert.IPAddresses) != len(tt.ips) {
+				t.Fatalf("got ip addresses %v, want %v", cert.IPAddresses, tt.ips)
+			}
+			for _, ip := range tt.ips {
+				if err := cert.VerifyHostname(ip); err != nil {
+					t.Errorf("the certificate isn't valid for %s: %s", ip, err)
+				}
+			}
+		})
+	}
+	for _, flag := range []string{"-strict", "-validate-sans"} {
+		if res := runCertshop(t, dir, nil, "server", flag, "-dn=/CN=10.0.0.7", "-san=", "ca/none"); res.code == 0 {
+			t.Errorf("a server certificate without subject alternative names was created with %s", flag)
+		}
+	}
+}
+
+func TestSanitizeArchiveName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"server", "server"},
+		{"www.example.com", "www.example.com"},
+		{"../../etc/passwd", "_.._etc_passwd"},
+		{`a/b\c`, "a_b_c"},
+		{"bad\x00name\n", "bad_name_"},
+		{"..", "cert"},
+		{"", "cert"},
+		{"trailing.", "trailing"},
+		{"CON", "_CON"},
+		{"lpt1.crt", "_lpt1.crt"},
+		{"console", "console"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeArchiveName(tt.name, "cert"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	certshop(t, dir, "client", "-dn=/CN=client", "ca/bad\x01name")
+	for name := range readTgz(t, certshop(t, dir, "export", "ca/bad\x01name")) {
+		if strings.ContainsAny(name, "\x01/") {
+			t.Errorf("unsafe archive entry %q", name)
+		}
+	}
+}
+
+func TestReuseKey(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	certshop(t, dir, "client", "-dn=/CN=first", "ca/first")
+	certshop(t, dir, "client", "-dn=/CN=openssh", "-key-format=openssh", "-pass-out=secret", "ca/openssh")
+	tests := []struct {
+		args     []string
+		path     string
+		original string
+	}{
+		{[]string{"client", "-dn=/CN=second", "-key-in=ca/first/first.key"}, "ca/second", "ca/first"},
+		{[]string{"server", "-dn=/CN=third", "-san=www.example.com", "-key-in=ca/first/first.key"}, "ca/third", "ca/first"},
+		{[]string{"ca", "-dn=/CN=other root", "-key-in=ca/first/first.key"}, "other", "ca/first"},
+		{[]string{"client", "-dn=/CN=decrypted", "-key-in=ca/openssh/openssh.key", "-pass-in=secret"}, "ca/decrypted", "ca/openssh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			certshop(t, dir, append(tt.args, tt.path)...)
+			reused := parseCert(filepath.Join(dir, tt.path)).PublicKey.(*ecdsa.PublicKey)
+			if !reused.Equal(parseCert(filepath.Join(dir, tt.original)).PublicKey) {
+				t.Errorf("%s doesn't have the public key of %s", tt.path, tt.original)
+			}
+		})
+	}
+	if res := runCertshop(t, dir, nil, "client", "-dn=/CN=wrong", "-key-in=ca/openssh/openssh.key", "-pass-in=wrong", "ca/wrong"); res.code == 0 {
+		t.Error("an encrypted key was used with the wrong passphrase")
+	}
+}
+
+func TestDebugTiming(t *testing.T) {
+	dir := newTree(t)
+	fakeOpenssl(t, "")
+	tests := []struct {
+		args   []string
+		phases []string
+	}{
+		// created twice, so the second time overwrites the first
+		{[]string{"ca", "-dn=/CN=other", "-overwrite", "-overwrite-keys", "-yes", "other"}, []string{"key generation", "signing", "marshaling and saving"}},
+		{[]string{"client", "-dn=/CN=client", "-overwrite", "-overwrite-keys", "-yes", "ca/client"}, []string{"key generation", "signing", "marshaling and saving"}},
+		{[]string{"export", "-p12", "-password=secret", "ca/ica/server"}, []string{"openssl pkcs12"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args[0], func(t *testing.T) {
+			for _, debug := range []bool{false, true} {
+				args := append([]string{tt.args[0], fmt.Sprintf("-debug=%t", debug)}, tt.args[1:]...)
+				res := runCertshop(t, dir, nil, args...)
+				if res.code != 0 {
+					t.Fatalf("certshop failed: %s", res.stderr)
+				}
+				for _, phase := range tt.phases {
+					if logged := strings.Contains(res.stderr, "DEBUG: "+phase+" took "); logged != debug {
+						t.Errorf("debug=%t: got %s timing %t in:\n%s", debug, phase, logged, res.stderr)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSubjectAltNameCritical(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	tests := []struct {
+		path     string
+		args     []string
+		critical bool
+	}{
+		{"ca/default", []string{"-dn=/CN=www"}, false},
+		{"ca/critical", []string{"-dn=/CN=www", "-subject-alt-name-critical=true"}, true},
+		{"ca/not-critical", []string{"-dn=/CN=www", "-subject-alt-name-critical=false"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			certshop(t, dir, append(append([]string{"server", "-san=www.example.com,10.0.0.1"}, tt.args...), tt.path)...)
+			cert := parseCert(filepath.Join(dir, tt.path))
+			found := 0
+			for _, extension := range cert.Extensions {
+				if extension.Id.Equal(oidSubjectAltName) {
+					found++
+					if extension.Critical != tt.critical {
+						t.Errorf("got critical %t, want %t", extension.Critical, tt.critical)
+					}
+				}
+			}
+			if found != 1 {
+				t.Errorf("got %d subject alternative name extensions, want 1", found)
+			}
+			if len(cert.DNSNames) != 1 || len(cert.IPAddresses) != 1 {
+				t.Errorf("got names %v %v, want www.example.com and 10.0.0.1", cert.DNSNames, cert.IPAddresses)
+			}
+		})
+	}
+	if res := runCertshop(t, dir, nil, "client", "-dn=/CN=client", "-subject-alt-name-critical=true", "ca/none"); res.code == 0 {
+		t.Error("a critical subject alternative name extension without names was accepted")
+	}
+}
+
+func TestStableSubjectEncoding(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	tests := []struct {
+		name     string
+		dns      []string
+		encoding string
+		want     string
+	}{
+		{"single ou", []string{"/C=US/O=Example/CN=host", "/CN=host/O=Example/C=US"}, "printable", "C=US,O=Example,CN=host"},
+		{"two ous", []string{"/O=Example/OU=Ops/OU=PKI/CN=host", "/CN=host/OU=Ops/OU=PKI/O=Example"}, "printable", "O=Example,OU=Ops,OU=PKI,CN=host"},
+		{"all", []string{"/CN=host/L=Town/ST=State/C=US/O=Example/serialNumber=42", "/serialNumber=42/C=US/ST=State/L=Town/O=Example/CN=host"}, "utf8", "C=US,ST=State,L=Town,O=Example,CN=host,SERIALNUMBER=42"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var first []byte
+			for j, dn := range tt.dns {
+				path := fmt.Sprintf("ca/subject%d-%d", i, j)
+				certshop(t, dir, "client", "-dn="+dn, "-dn-encoding="+tt.encoding, path)
+				cert := parseCert(filepath.Join(dir, path))
+				var rdns pkix.RDNSequence
+				if _, err := asn1.Unmarshal(cert.RawSubject, &rdns); err != nil {
+					t.Fatal(err)
+				}
+				order := []string{}
+				for _, rdn := range rdns {
+					if len(rdn) != 1 {
+						t.Errorf("%s has a multi-valued rdn", dn)
+					}
+					order = append(order, pkix.RDNSequence{rdn}.String())
+				}
+				if got := strings.Join(order, ","); got != tt.want {
+					t.Errorf("%s is encoded as %s, want %s", dn, got, tt.want)
+				}
+				if first == nil {
+					first = cert.RawSubject
+				} else if string(cert.RawSubject) != string(first) {
+					t.Errorf("%s and %s have different encodings", tt.dns[0], dn)
+				}
+			}
+		})
+	}
+}
+
+func TestInheritFromCA(t *testing.T) {
+	dir := t.TempDir()
+	policy := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	policies, err := asn1.Marshal([]struct{ Policy asn1.ObjectIdentifier }{{policy}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certshop(t, dir, "ca", "-dn=/CN=root/O=Example/C=US", "-extension=2.5.29.32:false:"+base64.StdEncoding.EncodeToString(policies))
+	tests := []struct {
+		args         []string
+		organization []string
+		country      []string
+		policies     int
+	}{
+		{[]string{"-dn=/CN=leaf"}, []string{"Example"}, []string{"US"}, 0},
+		{[]string{"-dn=/CN=leaf/O="}, nil, []string{"US"}, 0},
+		{[]string{"-dn=/CN=leaf/O=/O=Other"}, []string{"Other"}, []string{"US"}, 0},
+		{[]string{"-dn=/CN=leaf/O=Second"}, []string{"Example", "Second"}, []string{"US"}, 0},
+		{[]string{"-dn=/CN=leaf", "-inherit-policies"}, []string{"Example"}, []string{"US"}, 1},
+	}
+	for i, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			path := fmt.Sprintf("ca/leaf%d", i)
+			certshop(t, dir, append(append([]string{"client"}, tt.args...), path)...)
+			cert := parseCert(filepath.Join(dir, path))
+			if cert.Subject.CommonName != "leaf" {
+				t.Errorf("got common name %s, want leaf", cert.Subject.CommonName)
+			}
+			if fmt.Sprint(cert.Subject.Organization) != fmt.Sprint(tt.organization) || fmt.Sprint(cert.Subject.Country) != fmt.Sprint(tt.country) {
+				t.Errorf("got O=%v C=%v, want O=%v C=%v", cert.Subject.Organization, cert.Subject.Country, tt.organization, tt.country)
+			}
+			if len(cert.PolicyIdentifiers) != tt.policies || (tt.policies > 0 && !cert.PolicyIdentifiers[0].Equal(policy)) {
+				t.Errorf("got policies %v", cert.PolicyIdentifiers)
+			}
+		})
+	}
+}
+
+func TestOverwriteKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		ok      bool
+		newKey  bool
+		message string
+	}{
+		{"no overwrite", nil, false, false, "already exists"},
+		{"overwrite", []string{"-overwrite", "-yes"}, false, false, "-overwrite-keys"},
+		{"overwrite keys", []string{"-overwrite", "-overwrite-keys", "-yes"}, true, true, ""},
+		{"overwrite with the same key", []string{"-overwrite", "-yes", "-key-in=ca/server/server.key"}, true, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			certshop(t, dir, "ca", "-dn=/CN=root")
+			certshop(t, dir, "server", "-dn=/CN=server", "-san=www.example.com", "ca/server")
+			keyFile := filepath.Join(dir, "ca/server/server.key")
+			original := readFile(keyFile)
+
+			args := append(append([]string{"server", "-dn=/CN=server", "-san=www.example.com"}, tt.args...), "ca/server")
+			res := runCertshop(t, dir, nil, args...)
+			if ok := res.code == 0; ok != tt.ok {
+				t.Fatalf("got success %t, want %t: %s", ok, tt.ok, res.stderr)
+			}
+			if !strings.Contains(res.stderr, tt.message) {
+				t.Errorf("%q isn't reported in %s", tt.message, res.stderr)
+			}
+			if changed := readFile(keyFile) != original; changed != tt.newKey {
+				t.Errorf("got key replaced %t, want %t", changed, tt.newKey)
+			}
+			if !parseKey(filepath.Join(dir, "ca/server")).PublicKey.Equal(parseCert(filepath.Join(dir, "ca/server")).PublicKey) {
+				t.Error("the private key doesn't match the certificate")
+			}
+		})
+	}
+}
+
+func TestSignWithCAFiles(t *testing.T) {
+	dir := newTree(t)
+	ext := filepath.Join(dir, "ext")
+	if err := os.Mkdir(ext, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for from, to := range map[string]string{"ca/ica/ica.crt": "issuer.pem", "ca/ica/ica.key": "issuer-key.pem", "ca/ca.key": "other-key.pem"} {
+		data, err := os.ReadFile(filepath.Join(dir, from))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(ext, to), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		problem string
+	}{
+		{"cert and key", []string{"-ca-cert=ext/issuer.pem", "-ca-key=ext/issuer-key.pem"}, ""},
+		{"mismatched key", []string{"-ca-cert=ext/issuer.pem", "-ca-key=ext/other-key.pem"}, "doesn't match the public key"},
+		{"missing key", []string{"-ca-cert=ext/issuer.pem"}, "requires \"-ca-key\""},
+		{"missing cert", []string{"-ca-key=ext/issuer-key.pem"}, "requires \"-ca-cert\""},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the signing ca isn't in the tree so the path needn't be either
+			path := fmt.Sprintf("out/leaf%d", i)
+			res := runCertshop(t, dir, nil, append(append([]string{"server", "-dn=/CN=leaf"}, tt.args...), path)...)
+			if tt.problem != "" {
+				if res.code == 0 || !strings.Contains(res.stderr, tt.problem) {
+					t.Errorf("got status %d, want a failure reporting %q: %s", res.code, tt.problem, res.stderr)
+				}
+				return
+			}
+			if res.code != 0 {
+				t.Fatalf("signing with the ca files failed: %s", res.stderr)
+			}
+			cert := readCert(t, filepath.Join(dir, path, filepath.Base(path)+".crt"))
+			if cert.Issuer.CommonName != "ica" {
+				t.Errorf("got issuer %s, want ica", cert.Issuer.CommonName)
+			}
+			if root := readCert(t, filepath.Join(dir, path, "ca.pem")); root.Subject.CommonName != "root" {
+				t.Errorf("got ca.pem subject %s, want root", root.Subject.CommonName)
+			}
+			certshop(t, dir, "verify", path)
+		})
+	}
+}
+
+func TestValidateSubjectAlternativeNames(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	tests := []struct {
+		name    string
+		dn      string
+		san     string
+		ok      bool
+		warning bool
+	}{
+		{"valid", "/CN=www.example.com", "www.example.com,10.0.0.1", true, false},
+		{"wildcard", "/CN=*.example.com", "*.example.com", true, false},
+		{"underscore", "/CN=server", "bad_name.example.com", false, false},
+		{"leading hyphen", "/CN=server", "-bad.example.com", false, false},
+		{"unspecified ip", "/CN=server", "www.example.com,0.0.0.0", false, false},
+		{"multicast ip", "/CN=server", "www.example.com,224.0.0.1", false, false},
+		{"common name not in names", "/CN=other.example.com", "www.example.com", true, true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := runCertshop(t, dir, nil, "server", "-validate-sans", "-dn="+tt.dn, "-san="+tt.san, fmt.Sprintf("ca/san%d", i))
+			if (res.code == 0) != tt.ok {
+				t.Errorf("got status %d for -san=%s: %s", res.code, tt.san, res.stderr)
+			} else if !tt.ok && !strings.Contains(res.stderr, "Invalid") {
+				t.Errorf("the failure doesn't report the invalid name: %s", res.stderr)
+			}
+			if warned := strings.Contains(res.stderr, "isn't one of the subject alternative names"); warned != tt.warning {
+				t.Errorf("got common name warning %t, want %t: %s", warned, tt.warning, res.stderr)
+			}
+		})
+	}
+}
+
+func TestSubjectEncoding(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	oidCountryName := asn1.ObjectIdentifier{2, 5, 4, 6}
+	tests := []struct {
+		name     string
+		command  string
+		encoding string
+		tag      int
+	}{
+		{"printable ca", "ca", "printable", asn1.TagPrintableString},
+		{"utf8 ca", "ca", "utf8", asn1.TagUTF8String},
+		{"printable client", "client", "printable", asn1.TagPrintableString},
+		{"utf8 client", "client", "utf8", asn1.TagUTF8String},
+		{"utf8 server", "server", "utf8", asn1.TagUTF8String},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fmt.Sprintf("ca/encoding%d", i)
+			if tt.command == "ca" {
+				path = fmt.Sprintf("encoding%d", i)
+			}
+			certshop(t, dir, tt.command, "-dn=/C=US/O=Example Inc/OU=Ops/CN=host", "-dn-encoding="+tt.encoding, path)
+			cert := parseCert(filepath.Join(dir, path))
+			// the values are kept raw, since pkix.RDNSequence doesn't
+			// keep their string types
+			var rdns []asn1.RawValue
+			if _, err := asn1.Unmarshal(cert.RawSubject, &rdns); err != nil {
+				t.Fatal(err)
+			}
+			if len(rdns) != 4 {
+				t.Fatalf("got %d rdns, want 4", len(rdns))
+			}
+			for _, rdn := range rdns {
+				var atvs []struct {
+					Type  asn1.ObjectIdentifier
+					Value asn1.RawValue
+				}
+				if _, err := asn1.UnmarshalWithParams(rdn.FullBytes, &atvs, "set"); err != nil {
+					t.Fatal(err)
+				}
+				for _, atv := range atvs {
+					// the country is always a PrintableString
+					want := tt.tag
+					if atv.Type.Equal(oidCountryName) {
+						want = asn1.TagPrintableString
+					}
+					if atv.Value.Tag != want {
+						t.Errorf("%s is encoded with tag %d, want %d", atv.Type, atv.Value.Tag, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSubjectRaw(t *testing.T) {
+	// an order and string types certshop wouldn't produce from "-dn"
+	rdns := pkix.RDNSequence{
+		{{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte("host")}}},
+		{{Type: asn1.ObjectIdentifier{2, 5, 4, 10}, Value: asn1.RawValue{Tag: asn1.TagT61String, Bytes: []byte("Example")}}},
+		{{Type: asn1.ObjectIdentifier{2, 5, 4, 6}, Value: "US"}},
+	}
+	der, err := asn1.Marshal(rdns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := base64.StdEncoding.EncodeToString(der)
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root", "-maxPathLength=1")
+
+	tests := []struct {
+		name    string
+		command string
+		path    string
+		value   string
+		ok      bool
+	}{
+		{"root ca", "ca", "raw", raw, true},
+		{"ica", "ica", "ca/ica", raw, true},
+		{"client", "client", "ca/client", raw, true},
+		{"not base64", "client", "ca/bad1", "not base64!", false},
+		{"not a name", "client", "ca/bad2", base64.StdEncoding.EncodeToString([]byte{0x02, 0x01, 0x01}), false},
+		{"trailing data", "client", "ca/bad3", base64.StdEncoding.EncodeToString(append(append([]byte{}, der...), 0)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := runCertshop(t, dir, nil, tt.command, "-subject-raw="+tt.value, tt.path)
+			if !tt.ok {
+				if res.code == 0 || !strings.Contains(res.stderr, "Invalid \"-subject-raw\" value") {
+					t.Errorf("got status %d, want an invalid \"-subject-raw\" error: %s", res.code, res.stderr)
+				}
+				return
+			}
+			if res.code != 0 {
+				t.Fatalf("failed with \"-subject-raw\": %s", res.stderr)
+			}
+			cert := parseCert(filepath.Join(dir, tt.path))
+			if string(cert.RawSubject) != string(der) {
+				t.Error("the subject doesn't match the \"-subject-raw\" value byte for byte")
+			}
+			if tt.command == "ca" && string(cert.RawIssuer) != string(der) {
+				t.Error("the issuer of the self-signed ca doesn't match its subject byte for byte")
+			}
+		})
+	}
+}
+
+func TestCheckWildcard(t *testing.T) {
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"www.example.com", ""},
+		{"*.example.com", ""},
+		{"*.sub.example.com", ""},
+		{"*.*.example.com", "only the leftmost label"},
+		{"foo.*.example.com", "whole leftmost label"},
+		{"f*o.example.com", "whole leftmost label"},
+		{"*foo.example.com", "whole leftmost label"},
+		{"www.example.*", "whole leftmost label"},
+		{"*.com", "at least two labels"},
+		{"*", "at least two labels"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkWildcard(tt.name)
+			if tt.err == "" && err != nil {
+				t.Errorf("got %s", err)
+			} else if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("got %v, want an error with %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestWildcardNames(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	tests := []struct {
+		name string
+		dn   string
+		san  string
+		err  string
+	}{
+		{"valid", "/CN=*.example.com", "*.example.com,example.com", ""},
+		{"cn with spaces", "/CN=my * server", "www.example.com", ""},
+		{"multi level san", "/CN=server", "*.*.example.com", "Invalid wildcard subject alternative name *.*.example.com"},
+		{"inner san", "/CN=server", "www.example.com,foo.*.example.com", "Invalid wildcard subject alternative name foo.*.example.com"},
+		{"partial label cn", "/CN=w*.example.com", "www.example.com", "Invalid wildcard common name w*.example.com"},
+		{"top level cn", "/CN=*.com", "www.example.com", "Invalid wildcard common name *.com"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fmt.Sprintf("ca/wildcard%d", i)
+			res := runCertshop(t, dir, nil, "server", "-dn="+tt.dn, "-san="+tt.san, path)
+			if tt.err == "" && res.code != 0 {
+				t.Errorf("got status %d: %s", res.code, res.stderr)
+			} else if tt.err != "" {
+				if res.code == 0 || !strings.Contains(res.stderr, tt.err) {
+					t.Errorf("got status %d, want an error with %q: %s", res.code, tt.err, res.stderr)
+				}
+				if _, err := os.Stat(filepath.Join(dir, path, fmt.Sprintf("wildcard%d.crt", i))); err == nil {
+					t.Errorf("%s was created", path)
+				}
+			}
+		})
+	}
+}
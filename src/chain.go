@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+)
+
+// rebuildChain assembles the pem encoded chain of the certificate in
+// path by matching each authority key id to the subject key id of a
+// certificate found under root, so that it doesn't depend on the
+// directory nesting; the chain ends at a self-signed certificate or at
+// a certificate authority with no issuer under root (ie. an imported
+// cross-signed or bridge ca), and nil is returned when the key ids are
+// missing or no issuer is found for any other certificate
+func rebuildChain(root string, path string) []byte {
+	bySubjectKeyId := map[string][]*x509.Certificate{}
+	walkCertificates(root, func(_ string, cert *x509.Certificate) {
+		if len(cert.SubjectKeyId) > 0 {
+			bySubjectKeyId[string(cert.SubjectKeyId)] = append(bySubjectKeyId[string(cert.SubjectKeyId)], cert)
+		}
+	})
+
+	cert := parseCert(path)
+	chain := new(bytes.Buffer)
+	seen := map[string]bool{}
+	for {
+		if err := pem.Encode(chain, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			errorLog.Fatalf("Failed to encode certificate chain: %s", err)
+		}
+		if isSelfSigned(cert) {
+			return chain.Bytes()
+		}
+		seen[string(cert.Raw)] = true
+		var issuer *x509.Certificate
+		for _, candidate := range bySubjectKeyId[string(cert.AuthorityKeyId)] {
+			if !seen[string(candidate.Raw)] && cert.CheckSignatureFrom(candidate) == nil {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil && cert.IsCA {
+			infoLog.Printf("No issuer of %s found under %s, treating it as the trust anchor", formatDn(cert.Subject), root)
+			return chain.Bytes()
+		} else if len(cert.AuthorityKeyId) == 0 {
+			infoLog.Printf("%s has no authority key id", formatDn(cert.Subject))
+			return nil
+		} else if issuer == nil {
+			infoLog.Printf("No issuer of %s found under %s", formatDn(cert.Subject), root)
+			return nil
+		}
+		cert = issuer
+	}
+}
+
+// chainSearchRoot is the directory of the root ca above path, which
+// holds the whole certificate tree; it is found by going up while the
+// parent folder holds a certificate (so an absolute path stops at the
+// root ca rather than the file system root), and is path itself for a
+// new root ca
+func chainSearchRoot(path string) string {
+	dir := filepath.Clean(path)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		if _, err := os.Stat(filepath.Join(parent, filepath.Base(parent)+".crt")); err != nil {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// isChainTerminus reports whether cert ends the chain of certs: either
+// it is self-signed, or it is a certificate authority (other than the
+// first certificate) which none of the other certificates issued
+func isChainTerminus(cert *x509.Certificate, certs []*x509.Certificate) bool {
+	if isSelfSigned(cert) {
+		return true
+	}
+	if !cert.IsCA || cert == certs[0] {
+		return false
+	}
+	for _, candidate := range certs {
+		if candidate != cert && bytes.Equal(cert.RawIssuer, candidate.RawSubject) && cert.CheckSignatureFrom(candidate) == nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChainSearchRoot(t *testing.T) {
+	dir := newTree(t)
+	t.Chdir(dir)
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"ca/ica/server", "ca"},
+		{"ca/ica/new", "ca"},
+		{"ca", "ca"},
+		{"./ca/ica/", "ca"},
+		{"new", "new"},
+		{filepath.Join(dir, "ca/ica/server"), filepath.Join(dir, "ca")},
+		{filepath.Join(dir, "ca"), filepath.Join(dir, "ca")},
+		{filepath.Join(dir, "new"), filepath.Join(dir, "new")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := chainSearchRoot(tt.path); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForceChainRebuildAbsolutePath(t *testing.T) {
+	dir := newTree(t)
+	for _, path := range []string{"ca/ica/server", filepath.Join(dir, "ca/ica/server")} {
+		t.Run(path, func(t *testing.T) {
+			res := runCertshop(t, dir, nil, "export", "-force-chain-rebuild", path)
+			if res.code != 0 {
+				t.Fatalf("export failed: %s", res.stderr)
+			}
+			chain := parseCertsPem(readTgz(t, res.stdout)["server.crt"])
+			if len(chain) != 3 || !isSelfSigned(chain[2]) {
+				t.Errorf("got a chain of %d certificates, want the server, intermediate and root", len(chain))
+			}
+		})
+	}
+
+}
+
+// bridgeTree returns a tree whose top certificate authority "bridge" is
+// issued by a root outside of the tree, with an intermediate ca
+// "bridge/ica" and a server certificate "bridge/ica/server"
+func bridgeTree(t *testing.T) string {
+	t.Helper()
+	external := t.TempDir()
+	certshop(t, external, "ca", "-dn=/CN=external", "-maxPathLength=2")
+	certshop(t, external, "ica", "-dn=/CN=bridge", "ca/bridge")
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "bridge"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	chain := parseCertChain(filepath.Join(external, "ca/bridge/bridge.crt"))
+	files := map[string][]byte{
+		// only the bridge certificate itself, without the external root
+		"bridge.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain[0].Raw}),
+		"ca.pem":     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain[0].Raw}),
+	}
+	key, err := os.ReadFile(filepath.Join(external, "ca/bridge/bridge.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["bridge.key"] = key
+	for name, data := range files {
+		if err = os.WriteFile(filepath.Join(dir, "bridge", name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	certshop(t, dir, "ica", "-dn=/CN=ica", "bridge/ica")
+	certshop(t, dir, "server", "-dn=/CN=server", "-san=server.example.com", "bridge/ica/server")
+	return dir
+}
+
+func TestChainWithoutSelfSignedRoot(t *testing.T) {
+	dir := bridgeTree(t)
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"saved chain", nil, []string{"server", "ica", "bridge"}},
+		{"rebuilt chain", []string{"-force-chain-rebuild"}, []string{"server", "ica", "bridge"}},
+		{"without root", []string{"-include-root=false"}, []string{"server", "ica"}},
+		{"rebuilt without root", []string{"-force-chain-rebuild", "-include-root=false"}, []string{"server", "ica"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := runCertshop(t, dir, nil, append(append([]string{"export"}, tt.args...), "bridge/ica/server")...)
+			if res.code != 0 {
+				t.Fatalf("export failed: %s", res.stderr)
+			}
+			got := []string{}
+			for _, cert := range parseCertsPem(readTgz(t, res.stdout)["server.crt"]) {
+				got = append(got, cert.Subject.CommonName)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got chain %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsChainTerminus(t *testing.T) {
+	tree := parseCertChain(filepath.Join(newTree(t), "ca/ica/server/server.crt"))
+	server, ica, root := tree[0], tree[1], tree[2]
+	bridged := parseCertChain(filepath.Join(bridgeTree(t), "bridge/ica/server/server.crt"))
+	bridgeIca, bridge := bridged[1], bridged[2]
+	tests := []struct {
+		name  string
+		cert  *x509.Certificate
+		certs []*x509.Certificate
+		want  bool
+	}{
+		{"self-signed root", root, tree, true},
+		{"intermediate with issuer", ica, tree, false},
+		{"leaf", server, tree, false},
+		{"intermediate without issuer", ica, tree[:2], true},
+		{"first certificate", ica, tree[1:2], false},
+		{"bridge", bridge, bridged, true},
+		{"bridge intermediate", bridgeIca, bridged, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isChainTerminus(tt.cert, tt.certs); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
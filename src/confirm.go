@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// assumeYes skips the confirmation of destructive operations ("-yes")
+var assumeYes bool
+
+// confirm asks on the terminal before a destructive operation and fails
+// unless the answer is yes; without a terminal it fails rather than
+// waiting for an answer that can't come, unless "-yes" was given
+func confirm(prompt string, action string) {
+	if assumeYes {
+		return
+	}
+	if !isTerminal(os.Stdin) {
+		errorLog.Fatalf("Refusing to %s without confirmation because stdin is not a terminal.\nUse the \"-yes\" option to confirm.", action)
+	}
+	infoLog.Printf("%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		errorLog.Fatalf("Aborted: did not %s", action)
+	}
+}
+
+// confirmOverwrite asks before "-overwrite" replaces the files of an
+// existing certificate in path
+func confirmOverwrite(path string) {
+	existing := []string{}
+	fullPath := filepath.Join(path, filepath.Base(path))
+	for _, fileName := range []string{fullPath + ".crt", fullPath + ".key", filepath.Join(path, "ca.pem")} {
+		if _, err := os.Stat(fileName); err == nil {
+			existing = append(existing, fileName)
+		}
+	}
+	if len(existing) > 0 {
+		confirm("Overwrite "+strings.Join(existing, ", ")+"?", "overwrite "+path)
+	}
+}
+
+// isTerminal reports whether f is a character device other than the
+// null device (which is what stdin is in many scripts and cron jobs)
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfirmWithoutTerminal(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		// file which mustn't change without confirmation
+		file string
+	}{
+		{"overwrite", []string{"server", "-dn=/CN=new", "-overwrite", "-overwrite-keys", "ca/ica/server"}, "ca/ica/server/server.crt"},
+		{"overwrite ca", []string{"ica", "-dn=/CN=new", "-overwrite", "-overwrite-keys", "ca/ica"}, "ca/ica/ica.crt"},
+		{"key out", []string{"client", "-dn=/CN=client", "-overwrite", "-overwrite-keys", "-key-out=existing.pem", "ca/ica/client"}, "existing.pem"},
+		{"dhparam", []string{"dhparam", "-out=existing.pem", "-overwrite"}, "existing.pem"},
+		{"prune", []string{"prune", "ca"}, "ca/ica/expired/expired.crt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, confirm := range []string{"", "-yes", "-y"} {
+				dir := newTree(t)
+				writeCert(t, dir, "ca/ica/expired", time.Now().Add(-time.Hour), false)
+				if err := os.WriteFile(filepath.Join(dir, "existing.pem"), []byte("existing\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
+				before, err := os.ReadFile(filepath.Join(dir, tt.file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				args := append([]string{}, tt.args...)
+				if confirm != "" {
+					args = append(args[:1], append([]string{confirm}, args[1:]...)...)
+				}
+				res := runCertshop(t, dir, nil, args...)
+				after, _ := os.ReadFile(filepath.Join(dir, tt.file))
+				if confirm == "" {
+					if res.code == 0 || !strings.Contains(res.stderr, "stdin is not a terminal") {
+						t.Errorf("got status %d without a terminal or \"-yes\": %s", res.code, res.stderr)
+					}
+					if string(after) != string(before) {
+						t.Errorf("%s changed without confirmation", tt.file)
+					}
+				} else if res.code != 0 {
+					t.Errorf("failed with %s: %s", confirm, res.stderr)
+				} else if string(after) == string(before) {
+					t.Errorf("%s wasn't changed with %s", tt.file, confirm)
+				}
+			}
+		})
+	}
+}
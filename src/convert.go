@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// keyBlockTypes maps the private key formats of the convert command to
+// their pem block types
+var keyBlockTypes = map[string]string{
+	"sec1":    "EC PRIVATE KEY",
+	"pkcs8":   "PRIVATE KEY",
+	"openssh": "OPENSSH PRIVATE KEY",
+}
+
+// convertFile converts a certificate between pem and der, or a private
+// key between the sec1, pkcs8 and openssh formats (adding or removing
+// the passphrase of openssh keys), reading from the file argument or
+// stdin and writing to "-out" or stdout
+func convertFile(args []string) {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	addCommonFlags(fs)
+	inFormat := fs.String("in-format", "", "format of the input (pem or der for certificates, sec1, pkcs8 or openssh for private keys)")
+	outFormat := fs.String("out-format", "", "format of the output (pem or der for certificates, sec1, pkcs8 or openssh for private keys)")
+	passIn := fs.String("pass-in", "", "passphrase of an encrypted openssh input key")
+	passOut := fs.String("pass-out", "", "passphrase to encrypt an openssh output key with")
+	out := fs.String("out", "", "file to write the converted certificate or key to (default is stdout)")
+	overwrite := fs.Bool("overwrite", false, "overwrite an existing \"-out\" file")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	if len(fs.Args()) > 1 {
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+	}
+	inFile := fs.Arg(0)
+	if inFile == "" {
+		inFile = "-"
+	}
+	_, inKey := keyBlockTypes[*inFormat]
+	_, outKey := keyBlockTypes[*outFormat]
+	inCert := *inFormat == "pem" || *inFormat == "der"
+	outCert := *outFormat == "pem" || *outFormat == "der"
+	if !inKey && !inCert {
+		usageLog.Fatalf("Invalid \"-in-format\" %q (must be pem, der, sec1, pkcs8 or openssh)", *inFormat)
+	}
+	if !outKey && !outCert {
+		usageLog.Fatalf("Invalid \"-out-format\" %q (must be pem, der, sec1, pkcs8 or openssh)", *outFormat)
+	}
+	if inKey != outKey {
+		errorLog.Fatalf("Can't convert from %s to %s (certificates are pem or der and private keys are sec1, pkcs8 or openssh)", *inFormat, *outFormat)
+	}
+	if *passIn != "" && *inFormat != "openssh" {
+		errorLog.Fatalf("The \"-pass-in\" option is only supported with \"-in-format=openssh\"")
+	}
+	if *passOut != "" && *outFormat != "openssh" {
+		errorLog.Fatalf("The \"-pass-out\" option is only supported with \"-out-format=openssh\"")
+	}
+	if *out != "" {
+		if _, err := os.Stat(*out); err == nil && !*overwrite {
+			errorLog.Fatalf("Skipping creation of %s because it already exists.\nUse the \"-overwrite\" option to overwrite the existing file.", *out)
+		} else if err == nil {
+			confirm("Overwrite "+*out+"?", "overwrite "+*out)
+		}
+	}
+
+	var data []byte
+	if inFile == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(inFile)
+	}
+	if err != nil {
+		errorLog.Fatalf("Failed to read %s: %s", inFile, err)
+	}
+	infoLog.Printf("Converting %s from %s to %s\n", inFile, *inFormat, *outFormat)
+
+	var converted []byte
+	perms := publicPerms
+	if inKey {
+		converted = convertKey(inFile, data, *inFormat, *outFormat, *passIn, *passOut)
+		perms = privatePerms
+	} else {
+		converted = convertCert(inFile, data, *inFormat, *outFormat)
+	}
+
+	if *out == "" {
+		if _, err = os.Stdout.Write(converted); err != nil {
+			errorLog.Fatalf("Failed to write to stdout: %s", err)
+		}
+		return
+	}
+	writeFile(*out, converted, perms)
+	// WriteFile only applies perms to new files
+	if err = os.Chmod(*out, perms); err != nil {
+		errorLog.Fatalf("Failed to set permissions of %s: %s", *out, err)
+	}
+	infoLog.Printf("Saved %s\n", *out)
+}
+
+// convertCert converts pem certificates (all of the blocks, normalized)
+// or a single der certificate
+func convertCert(inFile string, data []byte, inFormat string, outFormat string) []byte {
+	var certs []*x509.Certificate
+	if inFormat == "der" {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			errorLog.Fatalf("Failed to parse der certificate %s: %s", inFile, err)
+		}
+		certs = []*x509.Certificate{cert}
+	} else {
+		checkPem(inFile, data)
+		if certs = parseCertsPem(data); len(certs) == 0 {
+			errorLog.Fatalf("No certificates found in %s", inFile)
+		}
+	}
+	if outFormat == "der" {
+		if len(certs) > 1 {
+			errorLog.Fatalf("%s has %d certificates but a der file holds a single certificate", inFile, len(certs))
+		}
+		return certs[0].Raw
+	}
+	converted := []byte{}
+	for _, cert := range certs {
+		converted = append(converted, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return converted
+}
+
+// convertKey re-encodes a private key, removing or adding the passphrase
+// of openssh keys
+func convertKey(inFile string, data []byte, inFormat string, outFormat string, passIn string, passOut string) []byte {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != keyBlockTypes[inFormat] {
+		errorLog.Fatalf("%s is not a %s private key (expected a %q pem block)", inFile, inFormat, keyBlockTypes[inFormat])
+	}
+	if passIn == "" && isEncryptedOpenSSHKey(data) {
+		errorLog.Fatalf("Failed to parse private key %s (use \"-pass-in\" for an encrypted key)", inFile)
+	}
+	key := parseKeyData(inFile, data, passIn)
+
+	var der []byte
+	var err error
+	switch outFormat {
+	case "sec1":
+		der, err = x509.MarshalECPrivateKey(key)
+	case "pkcs8":
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+	case "openssh":
+		converted, err := marshalOpenSSHKey(key, "", passOut)
+		if err != nil {
+			errorLog.Fatalf("Failed to marshal private key %s: %s", inFile, err)
+		}
+		return converted
+	}
+	if err != nil {
+		errorLog.Fatalf("Failed to marshal private key %s: %s", inFile, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: keyBlockTypes[outFormat], Bytes: der})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvertKey(t *testing.T) {
+	dir := newTree(t)
+	key := parseKey(filepath.Join(dir, "ca/ica/server"))
+	sec1, err := os.ReadFile(filepath.Join(dir, "ca/ica/server/server.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := marshalOpenSSHKey(key, "", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the decrypted key must only be kept in memory
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		args    []string
+		passOut string
+		err     string
+	}{
+		{"sec1 to pkcs8", sec1, []string{"-in-format=sec1", "-out-format=pkcs8"}, "", ""},
+		{"sec1 to openssh", sec1, []string{"-in-format=sec1", "-out-format=openssh"}, "", ""},
+		{"sec1 to encrypted openssh", sec1, []string{"-in-format=sec1", "-out-format=openssh", "-pass-out=other"}, "other", ""},
+		{"encrypted openssh to sec1", encrypted, []string{"-in-format=openssh", "-out-format=sec1", "-pass-in=secret"}, "", ""},
+		{"wrong passphrase", encrypted, []string{"-in-format=openssh", "-out-format=sec1", "-pass-in=wrong"}, "", "Failed to decrypt private key -"},
+		{"missing passphrase", encrypted, []string{"-in-format=openssh", "-out-format=sec1"}, "", "use \"-pass-in\""},
+		{"wrong format", sec1, []string{"-in-format=pkcs8", "-out-format=sec1"}, "", "is not a pkcs8 private key"},
+		{"key to certificate", sec1, []string{"-in-format=sec1", "-out-format=pem"}, "", "Can't convert from sec1 to pem"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := runCertshop(t, dir, tt.input, append([]string{"convert"}, tt.args...)...)
+			if tt.err != "" {
+				if res.code == 0 || !strings.Contains(res.stderr, tt.err) {
+					t.Errorf("got status %d, want an error with %q:\n%s", res.code, tt.err, res.stderr)
+				}
+			} else {
+				if res.code != 0 {
+					t.Fatalf("convert failed with status %d:\n%s", res.code, res.stderr)
+				}
+				if got := parseKeyData("converted", res.stdout, tt.passOut); !got.Equal(key) {
+					t.Errorf("the converted key is a different key")
+				}
+			}
+			if files, err := os.ReadDir(tmp); err != nil || len(files) > 0 {
+				t.Errorf("temporary files were left behind: %v", files)
+			}
+		})
+	}
+}
+
+func TestConvertOut(t *testing.T) {
+	dir := newTree(t)
+	certshop(t, dir, "convert", "-in-format=sec1", "-out-format=pkcs8", "-out=server.pk8", "ca/ica/server/server.key")
+	certshop(t, dir, "convert", "-in-format=pem", "-out-format=der", "-out=ca.der", "ca/ca.crt")
+	tests := []struct {
+		fileName string
+		perms    os.FileMode
+	}{
+		{"server.pk8", privatePerms},
+		{"ca.der", publicPerms},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			info, err := os.Stat(filepath.Join(dir, tt.fileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != tt.perms {
+				t.Errorf("permissions %v, want %v", info.Mode().Perm(), tt.perms)
+			}
+		})
+	}
+	der, err := os.ReadFile(filepath.Join(dir, "ca.der"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca := readCert(t, filepath.Join(dir, "ca/ca.crt")); !bytes.Equal(der, ca.Raw) {
+		t.Errorf("ca.der isn't the der ca certificate")
+	}
+	pk8, err := os.ReadFile(filepath.Join(dir, "server.pk8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block, _ := pem.Decode(pk8); block == nil || block.Type != "PRIVATE KEY" {
+		t.Errorf("server.pk8 isn't a pkcs8 private key")
+	}
+	if res := runCertshop(t, dir, nil, "convert", "-in-format=sec1", "-out-format=pkcs8", "-out=server.pk8", "ca/ica/server/server.key"); res.code == 0 {
+		t.Errorf("an existing \"-out\" file was overwritten")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/varasys/certshop/pki"
+)
+
+// crossSign issues a new certificate for the subject and public key of
+// an existing certificate, signed by the ca above path, so that the
+// same key is trusted by two different certificate authorities
+func crossSign(args []string) {
+	fs := flag.NewFlagSet("cross-sign", flag.ContinueOnError)
+	addCommonFlags(fs)
+	addDeterministicSeedFlag(fs)
+	certPath := fs.String("cert", "", "path of the existing certificate to cross-sign")
+	validity := fs.Int("validity", 0, "certificate validity in days (default is the validity of the existing certificate)")
+	clockSkew := fs.Duration("clock-skew", defaultClockSkew, "backdate the start of the validity period by this duration to tolerate clock skew (only used with \"-validity\")")
+	overwrite := fs.Bool("overwrite", false, "overwrite any existing files")
+	overwriteKeys := fs.Bool("overwrite-keys", false, "overwrite an existing private key (in addition to \"-overwrite\")")
+	signatureAlgorithm := fs.String("signature-algorithm", "", "signature algorithm (ie. ECDSA-SHA256 or ECDSA-SHA384), which must suit the ca signing key (default chosen by go for the key)")
+	kmsKeyArn := fs.String("kms-key-arn", "", "aws kms key (arn, id or alias) holding the signing ca's private key")
+	auditLog, operator := addAuditFlags(fs)
+	caPass := fs.String("ca-pass", "", "passphrase of the signing ca's private key (default $CERTSHOP_CA_PASS)")
+	addKeyPolicyFlags(fs)
+	issuerDn := fs.String("issuer-dn", "", "advanced: issuer name to use instead of the ca subject (ie. the ca's name before it was corrected)")
+	dnEncoding := fs.String("dn-encoding", "printable", "asn.1 string type of the \"-issuer-dn\" attributes, which must match the encoding of the original ca subject (printable or utf8)")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	if len(fs.Args()) != 1 {
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+	} else if *certPath == "" {
+		errorLog.Fatalf("The \"-cert\" flag is required")
+	}
+	path := fs.Arg(0)
+
+	infoLog.Printf("Cross-signing Certificate %s as %s\n", *certPath, path)
+
+	defer lockTree(path)()
+	if !*overwrite {
+		checkExisting(path)
+	} else {
+		if !*overwriteKeys {
+			checkExistingKey(path, "")
+		}
+		confirmOverwrite(path)
+	}
+
+	cert := parseCert(*certPath)
+	if err := checkKeyPolicy(cert.PublicKey); err != nil {
+		errorLog.Fatalf("Refusing to cross-sign %s: %s", *certPath, err)
+	}
+	ca := filepath.Dir(path)
+	caCert := parseCert(ca)
+	if !caCert.IsCA {
+		errorLog.Fatalf("Certificate %s is not a certificate authority", ca)
+	}
+	maxPathLength := cert.MaxPathLen
+	if cert.IsCA {
+		if !(caCert.MaxPathLen > 0) {
+			errorLog.Fatalf("Certificate Authority %s can't sign other certificate authorities (maxPathLength exceeded)", ca)
+		}
+		if maxPathLength < 0 || maxPathLength > caCert.MaxPathLen-1 {
+			maxPathLength = caCert.MaxPathLen - 1
+		}
+	}
+	caKey := caSigner(ca, caCert, *kmsKeyArn, caPassword(*caPass))
+	if *issuerDn != "" {
+		// CreateCertificate takes the issuer from the parent's RawSubject
+		// (encoded the same way as the subjects certshop creates, so the
+		// issuer matches the original ca subject byte for byte)
+		override := *caCert
+		override.RawSubject = rawSubject(*parseDn(nil, *issuerDn), *dnEncoding)
+		caCert = &override
+	}
+
+	serialNumber := newSerialNumber()
+
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		RawSubject:            cert.RawSubject,
+		NotBefore:             cert.NotBefore,
+		NotAfter:              cert.NotAfter,
+		BasicConstraintsValid: cert.BasicConstraintsValid,
+		IsCA:                  cert.IsCA,
+		MaxPathLen:            maxPathLength,
+		MaxPathLenZero:        cert.IsCA && maxPathLength == 0,
+		KeyUsage:              cert.KeyUsage,
+		ExtKeyUsage:           cert.ExtKeyUsage,
+		SubjectKeyId:          cert.SubjectKeyId,
+		DNSNames:              cert.DNSNames,
+		IPAddresses:           cert.IPAddresses,
+		EmailAddresses:        cert.EmailAddresses,
+		PermittedIPRanges:     cert.PermittedIPRanges,
+		ExcludedIPRanges:      cert.ExcludedIPRanges,
+	}
+	if *validity > 0 {
+		template.NotBefore, template.NotAfter = validityPeriod(*clockSkew, *validity)
+	}
+
+	template.SignatureAlgorithm = parseSignatureAlgorithm(*signatureAlgorithm, ca, caKey.Public())
+	derCert, err := pki.Sign(signingRandom(), &template, caCert, cert.PublicKey, caKey)
+	if err != nil {
+		errorLog.Fatalf("Failed to create Cross-signed Certificate %s: %s", path, err)
+	}
+
+	saveCert(path, derCert, nil)
+	// the private key belongs to the subject so it is shared by both
+	// certificates (this lets a cross-signed ca sign certificates)
+	keyFile := filepath.Join(*certPath, filepath.Base(*certPath)+".key")
+	if _, err := os.Stat(keyFile); err == nil {
+		copyFile(keyFile, filepath.Join(path, filepath.Base(path)+".key"), privatePerms)
+	}
+	copyFile(filepath.Join(ca, "ca.pem"), filepath.Join(path, "ca.pem"), publicPerms)
+	writeAuditLog(*auditLog, "cross-sign", *operator, path, derCert)
+	infoLog.Printf("Finished Cross-signing Certificate %s as %s\n", *certPath, path)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+)
+
+func TestCrossSignedLeafValidatesAgainstBothRoots(t *testing.T) {
+	dir := newTree(t)
+	certshop(t, dir, "ca", "-dn=/CN=other root", "-maxPathLength=1", "other")
+	certshop(t, dir, "cross-sign", "-cert=ca/ica", "other/ica")
+
+	leaf := readCert(t, filepath.Join(dir, "ca/ica/server/server.crt"))
+	ica := readCert(t, filepath.Join(dir, "ca/ica/ica.crt"))
+	cross := readCert(t, filepath.Join(dir, "other/ica/ica.crt"))
+	if string(cross.RawSubject) != string(ica.RawSubject) || string(cross.RawSubjectPublicKeyInfo) != string(ica.RawSubjectPublicKeyInfo) {
+		t.Fatal("the cross-signed certificate doesn't have the subject and public key of the original")
+	}
+	tests := []struct {
+		root         string
+		intermediate *x509.Certificate
+	}{
+		{"ca/ca.crt", ica},
+		{"other/other.crt", cross},
+	}
+	for _, tt := range tests {
+		t.Run(tt.root, func(t *testing.T) {
+			roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+			roots.AddCert(readCert(t, filepath.Join(dir, tt.root)))
+			intermediates.AddCert(tt.intermediate)
+			if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+				t.Errorf("the leaf doesn't validate: %s", err)
+			}
+		})
+	}
+}
+
+func TestCrossSignIssuerDn(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		encoding string
+	}{
+		{"printable", "printable"},
+		{"utf8", "utf8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the original ca, whose name the cross-signed certificate
+			// names as its issuer
+			dn := "/C=US/O=Example Inc/OU=Ops/OU=PKI/CN=Old Root"
+			certshop(t, dir, "ca", "-dn="+dn, "-dn-encoding="+tt.encoding, tt.name+"-old")
+			certshop(t, dir, "ca", "-dn=/CN=New Root", tt.name+"-new")
+			certshop(t, dir, "client", "-dn=/CN=client", tt.name+"-new/client")
+			certshop(t, dir, "cross-sign", "-cert="+tt.name+"-new/client", "-issuer-dn="+dn, "-dn-encoding="+tt.encoding, tt.name+"-new/cross")
+
+			old := readCert(t, filepath.Join(dir, tt.name+"-old", tt.name+"-old.crt"))
+			cross := readCert(t, filepath.Join(dir, tt.name+"-new/cross/cross.crt"))
+			if string(cross.RawIssuer) != string(old.RawSubject) {
+				t.Errorf("the issuer %s doesn't match the subject of the original ca byte for byte", formatDn(cross.Issuer))
+			}
+		})
+	}
+}
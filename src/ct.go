@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/varasys/certshop/pki"
+)
+
+// certificate transparency extensions (rfc 6962)
+var oidCTPoison = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+var oidCTSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// ctPoisonExtension marks a precertificate, which tls clients reject
+// because the extension is critical
+func ctPoisonExtension() pkix.Extension {
+	return pkix.Extension{Id: oidCTPoison, Critical: true, Value: asn1.NullBytes}
+}
+
+// embedSCTs replaces the precertificate in path with the final
+// certificate, which is identical except that the poison extension is
+// replaced by the signed certificate timestamps returned by the logs
+func embedSCTs(args []string) {
+	fs := flag.NewFlagSet("embed-scts", flag.ContinueOnError)
+	addCommonFlags(fs)
+	addDeterministicSeedFlag(fs)
+	sctList := fs.String("sct-list", "", "file with the tls encoded SignedCertificateTimestampList (binary or base64)")
+	auditLog, operator := addAuditFlags(fs)
+	caPass := fs.String("ca-pass", "", "passphrase of the signing ca's private key (default $CERTSHOP_CA_PASS)")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	if len(fs.Args()) != 1 {
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+	} else if *sctList == "" {
+		errorLog.Fatalf("The \"-sct-list\" flag is required")
+	}
+	path := fs.Arg(0)
+	infoLog.Printf("Embedding SCTs in Certificate %s\n", path)
+
+	defer lockTree(path)()
+	scts, err := ioutil.ReadFile(*sctList)
+	if err != nil {
+		errorLog.Fatalf("Failed to read %s: %s", *sctList, err)
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(scts))); err == nil {
+		scts = decoded
+	}
+	if len(scts) < 2 || int(binary.BigEndian.Uint16(scts)) != len(scts)-2 {
+		errorLog.Fatalf("Invalid SignedCertificateTimestampList in %s (the length prefix doesn't match the size)", *sctList)
+	}
+	sctValue, err := asn1.Marshal(scts)
+	if err != nil {
+		errorLog.Fatalf("Failed to marshal SCT list: %s", err)
+	}
+
+	precert := parseCert(path)
+	// the logs signed the precertificate without the poison extension,
+	// so the other extensions are copied in the same order (go doesn't
+	// add its own when they are in ExtraExtensions)
+	extensions := []pkix.Extension{}
+	poisoned := false
+	for _, extension := range precert.Extensions {
+		if extension.Id.Equal(oidCTPoison) {
+			extension = pkix.Extension{Id: oidCTSCTList, Value: sctValue}
+			poisoned = true
+		}
+		extensions = append(extensions, extension)
+	}
+	if !poisoned {
+		errorLog.Fatalf("Certificate %s is not a precertificate (create it with \"-precert\")", path)
+	}
+
+	ca := filepath.Dir(path)
+	caCert := parseCert(ca)
+	caKey := caSigner(ca, caCert, "", caPassword(*caPass))
+	template := x509.Certificate{
+		SerialNumber:       precert.SerialNumber,
+		RawSubject:         precert.RawSubject,
+		NotBefore:          precert.NotBefore,
+		NotAfter:           precert.NotAfter,
+		SignatureAlgorithm: precert.SignatureAlgorithm,
+		ExtraExtensions:    extensions,
+	}
+	derCert, err := pki.Sign(signingRandom(), &template, caCert, precert.PublicKey, caKey)
+	if err != nil {
+		errorLog.Fatalf("Failed to create Certificate %s: %s", path, err)
+	}
+
+	name := filepath.Join(path, filepath.Base(path))
+	copyFile(name+".crt", name+".precert.crt", publicPerms)
+	saveCert(path, derCert, nil)
+	writeAuditLog(*auditLog, "embed-scts", *operator, path, derCert)
+	infoLog.Printf("Finished Embedding SCTs in Certificate %s (the precertificate is in %s)\n", path, name+".precert.crt")
+}
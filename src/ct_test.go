@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEmbedSCTs(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	// a SignedCertificateTimestampList with a single (fake) sct
+	scts := []byte{0, 6, 0, 4, 's', 'c', 't', '1'}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"binary", scts},
+		{"base64", []byte(base64.StdEncoding.EncodeToString(scts) + "\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "ca/" + tt.name
+			certshop(t, dir, "server", "-dn=/CN=www", "-san=www.example.com", "-precert", path)
+			precert := parseCert(filepath.Join(dir, path))
+			if !hasExtension(precert, oidCTPoison, true) || hasExtension(precert, oidCTSCTList, false) {
+				t.Fatal("the precertificate doesn't have just the critical poison extension")
+			}
+
+			sctFile := filepath.Join(dir, tt.name+".sct")
+			if err := os.WriteFile(sctFile, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			certshop(t, dir, "embed-scts", "-sct-list="+sctFile, path)
+			cert := parseCert(filepath.Join(dir, path))
+			if hasExtension(cert, oidCTPoison, true) || !hasExtension(cert, oidCTSCTList, false) {
+				t.Fatal("the final certificate doesn't have the sct list instead of the poison extension")
+			}
+			for i, extension := range cert.Extensions {
+				if extension.Id.Equal(oidCTSCTList) {
+					var value []byte
+					if _, err := asn1.Unmarshal(extension.Value, &value); err != nil || string(value) != string(scts) {
+						t.Errorf("the sct list extension doesn't hold the sct list")
+					}
+				} else if !extension.Id.Equal(precert.Extensions[i].Id) {
+					t.Errorf("extension %d is %s, want %s", i, extension.Id, precert.Extensions[i].Id)
+				}
+			}
+			if cert.SerialNumber.Cmp(precert.SerialNumber) != 0 {
+				t.Error("the final certificate has a different serial number")
+			}
+			if saved := readCert(t, filepath.Join(dir, path, tt.name+".precert.crt")); !saved.Equal(precert) {
+				t.Error("the precertificate wasn't kept")
+			}
+		})
+	}
+	if res := runCertshop(t, dir, nil, "embed-scts", "-sct-list="+filepath.Join(dir, "binary.sct"), "ca/binary"); res.code == 0 {
+		t.Error("scts were embedded in a certificate that isn't a precertificate")
+	}
+}
+
+// hasExtension reports whether cert has the extension with the given
+// criticality
+func hasExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier, critical bool) bool {
+	for _, extension := range cert.Extensions {
+		if extension.Id.Equal(oid) && extension.Critical == critical {
+			return true
+		}
+	}
+	return false
+}
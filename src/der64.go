@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+)
+
+// printDerBase64 prints the certificate (format "line") or the whole
+// chain as a json web key "x5c" array (format "x5c") as base64 encoded
+// der without pem headers, for pasting into json configs or web tools
+func printDerBase64(certsPEM []byte, format string) {
+	values := []string{}
+	for {
+		var block *pem.Block
+		block, certsPEM = pem.Decode(certsPEM)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			values = append(values, base64.StdEncoding.EncodeToString(block.Bytes))
+		}
+	}
+	if len(values) == 0 {
+		errorLog.Fatalf("No certificates found to print")
+	}
+	switch format {
+	case "line":
+		fmt.Println(values[0])
+	case "x5c":
+		data, err := json.Marshal(values)
+		if err != nil {
+			errorLog.Fatalf("Failed to marshal x5c array: %s", err)
+		}
+		fmt.Println(string(data))
+	default:
+		usageLog.Fatalf("Invalid format %s (must be line or x5c)", format)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrintDerBase64(t *testing.T) {
+	dir := newTree(t)
+	chain := parseCertsPem([]byte(readFile(filepath.Join(dir, "ca/ica/server/server.crt"))))
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"line", nil, 1},
+		{"x5c", []string{"-format=x5c"}, len(chain)},
+		{"x5c without root", []string{"-format=x5c", "-include-root=false"}, len(chain) - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := strings.TrimSpace(string(certshop(t, dir, append(append([]string{"export", "-print-der-base64"}, tt.args...), "ca/ica/server")...)))
+			values := []string{out}
+			if strings.HasPrefix(out, "[") {
+				if err := json.Unmarshal([]byte(out), &values); err != nil {
+					t.Fatalf("the x5c output isn't a json array: %s", err)
+				}
+			}
+			if len(values) != tt.want {
+				t.Fatalf("got %d certificates, want %d", len(values), tt.want)
+			}
+			for i, value := range values {
+				der, err := base64.StdEncoding.DecodeString(value)
+				if err != nil {
+					t.Fatalf("certificate %d isn't base64: %s", i, err)
+				}
+				if string(der) != string(chain[i].Raw) {
+					t.Errorf("certificate %d doesn't decode to the original der", i)
+				}
+			}
+		})
+	}
+	if res := runCertshop(t, dir, nil, "export", "-print-der-base64", "-format=x5c", "-chain-order=root-first", "ca/ica/server"); res.code == 0 {
+		t.Error("a root-first x5c array was printed")
+	}
+}
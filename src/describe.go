@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// treeSummary is the output of the describe command
+type treeSummary struct {
+	Path          string   `json:"path"`
+	Subject       string   `json:"subject"`
+	NotAfter      string   `json:"notAfter"`
+	Intermediates int      `json:"intermediates"`
+	Leaves        int      `json:"leaves"`
+	Expired       []string `json:"expired"`
+}
+
+func describeTree(args []string) {
+	fs := flag.NewFlagSet("describe", flag.ContinueOnError)
+	addCommonFlags(fs)
+	jsonOutput := fs.Bool("json", false, "output the summary as json")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	path := "ca"
+	if len(fs.Args()) > 1 {
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+	} else if len(fs.Args()) == 1 {
+		path = fs.Arg(0)
+	}
+
+	top := parseCert(path)
+	summary := treeSummary{
+		Path:     path,
+		Subject:  formatDn(top.Subject),
+		NotAfter: top.NotAfter.UTC().Format(time.RFC3339),
+		Expired:  []string{},
+	}
+	walkCertificates(path, func(p string, cert *x509.Certificate) {
+		if cert.NotAfter.Before(runTime) {
+			summary.Expired = append(summary.Expired, p)
+		}
+		if p == path {
+			return
+		} else if cert.IsCA {
+			summary.Intermediates++
+		} else {
+			summary.Leaves++
+		}
+	})
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(summary); err != nil {
+			errorLog.Fatalf("Failed to write json: %s", err)
+		}
+		return
+	}
+	fmt.Printf("Certificate Authority: %s\n", summary.Path)
+	fmt.Printf("Subject:               %s\n", summary.Subject)
+	fmt.Printf("Expires:               %s\n", summary.NotAfter)
+	fmt.Printf("Intermediates:         %d\n", summary.Intermediates)
+	fmt.Printf("Leaf Certificates:     %d\n", summary.Leaves)
+	fmt.Printf("Expired Certificates:  %d\n", len(summary.Expired))
+	for _, p := range summary.Expired {
+		fmt.Printf("    %s\n", p)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDescribeTree(t *testing.T) {
+	dir := newTree(t)
+	certshop(t, dir, "client", "-dn=/CN=client", "ca/ica/client")
+	certshop(t, dir, "ica", "-dn=/CN=ica2", "ca/ica2")
+	writeCert(t, dir, "ca/ica2/old", time.Now().Add(-time.Hour), false)
+
+	summary := treeSummary{}
+	if err := json.Unmarshal(certshop(t, dir, "describe", "-json"), &summary); err != nil {
+		t.Fatalf("Failed to parse the json summary: %s", err)
+	}
+	root := parseCert(filepath.Join(dir, "ca"))
+	want := treeSummary{
+		Path:          "ca",
+		Subject:       "/CN=root",
+		NotAfter:      root.NotAfter.UTC().Format(time.RFC3339),
+		Intermediates: 2,
+		Leaves:        3,
+		Expired:       []string{"ca/ica2/old"},
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("got summary %+v, want %+v", summary, want)
+	}
+
+	text := string(certshop(t, dir, "describe", "ca/ica"))
+	for _, line := range []string{
+		"Subject:               /CN=ica",
+		"Intermediates:         0",
+		"Leaf Certificates:     2",
+		"Expired Certificates:  0",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("%q isn't in the summary:\n%s", line, text)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/asn1"
+	"encoding/pem"
+	"flag"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ffdheGroups are the finite field diffie-hellman groups of RFC 7919
+// (with generator 2), which are preferred over custom parameters
+// because clients can recognize and check them
+var ffdheGroups = map[string]string{
+	"ffdhe2048": "FFFFFFFFFFFFFFFFADF85458A2BB4A9AAFDC5620273D3CF1D8B9C583CE2D3695" +
+		"A9E13641146433FBCC939DCE249B3EF97D2FE363630C75D8F681B202AEC4617A" +
+		"D3DF1ED5D5FD65612433F51F5F066ED0856365553DED1AF3B557135E7F57C935" +
+		"984F0C70E0E68B77E2A689DAF3EFE8721DF158A136ADE73530ACCA4F483A797A" +
+		"BC0AB182B324FB61D108A94BB2C8E3FBB96ADAB760D7F4681D4F42A3DE394DF4" +
+		"AE56EDE76372BB190B07A7C8EE0A6D709E02FCE1CDF7E2ECC03404CD28342F61" +
+		"9172FE9CE98583FF8E4F1232EEF28183C3FE3B1B4C6FAD733BB5FCBC2EC22005" +
+		"C58EF1837D1683B2C6F34A26C1B2EFFA886B423861285C97FFFFFFFFFFFFFFFF",
+	"ffdhe3072": "FFFFFFFFFFFFFFFFADF85458A2BB4A9AAFDC5620273D3CF1D8B9C583CE2D3695" +
+		"A9E13641146433FBCC939DCE249B3EF97D2FE363630C75D8F681B202AEC4617A" +
+		"D3DF1ED5D5FD65612433F51F5F066ED0856365553DED1AF3B557135E7F57C935" +
+		"984F0C70E0E68B77E2A689DAF3EFE8721DF158A136ADE73530ACCA4F483A797A" +
+		"BC0AB182B324FB61D108A94BB2C8E3FBB96ADAB760D7F4681D4F42A3DE394DF4" +
+		"AE56EDE76372BB190B07A7C8EE0A6D709E02FCE1CDF7E2ECC03404CD28342F61" +
+		"9172FE9CE98583FF8E4F1232EEF28183C3FE3B1B4C6FAD733BB5FCBC2EC22005" +
+		"C58EF1837D1683B2C6F34A26C1B2EFFA886B4238611FCFDCDE355B3B6519035B" +
+		"BC34F4DEF99C023861B46FC9D6E6C9077AD91D2691F7F7EE598CB0FAC186D91C" +
+		"AEFE130985139270B4130C93BC437944F4FD4452E2D74DD364F2E21E71F54BFF" +
+		"5CAE82AB9C9DF69EE86D2BC522363A0DABC521979B0DEADA1DBF9A42D5C4484E" +
+		"0ABCD06BFA53DDEF3C1B20EE3FD59D7C25E41D2B66C62E37FFFFFFFFFFFFFFFF",
+	"ffdhe4096": "FFFFFFFFFFFFFFFFADF85458A2BB4A9AAFDC5620273D3CF1D8B9C583CE2D3695" +
+		"A9E13641146433FBCC939DCE249B3EF97D2FE363630C75D8F681B202AEC4617A" +
+		"D3DF1ED5D5FD65612433F51F5F066ED0856365553DED1AF3B557135E7F57C935" +
+		"984F0C70E0E68B77E2A689DAF3EFE8721DF158A136ADE73530ACCA4F483A797A" +
+		"BC0AB182B324FB61D108A94BB2C8E3FBB96ADAB760D7F4681D4F42A3DE394DF4" +
+		"AE56EDE76372BB190B07A7C8EE0A6D709E02FCE1CDF7E2ECC03404CD28342F61" +
+		"9172FE9CE98583FF8E4F1232EEF28183C3FE3B1B4C6FAD733BB5FCBC2EC22005" +
+		"C58EF1837D1683B2C6F34A26C1B2EFFA886B4238611FCFDCDE355B3B6519035B" +
+		"BC34F4DEF99C023861B46FC9D6E6C9077AD91D2691F7F7EE598CB0FAC186D91C" +
+		"AEFE130985139270B4130C93BC437944F4FD4452E2D74DD364F2E21E71F54BFF" +
+		"5CAE82AB9C9DF69EE86D2BC522363A0DABC521979B0DEADA1DBF9A42D5C4484E" +
+		"0ABCD06BFA53DDEF3C1B20EE3FD59D7C25E41D2B669E1EF16E6F52C3164DF4FB" +
+		"7930E9E4E58857B6AC7D5F42D69F6D187763CF1D5503400487F55BA57E31CC7A" +
+		"7135C886EFB4318AED6A1E012D9E6832A907600A918130C46DC778F971AD0038" +
+		"092999A333CB8B7A1A1DB93D7140003C2A4ECEA9F98D0ACC0A8291CDCEC97DCF" +
+		"8EC9B55A7F88A46B4DB5A851F44182E1C68A007E5E655F6AFFFFFFFFFFFFFFFF",
+}
+
+// dhParameters is the PKCS #3 DHParameter structure used by openssl's
+// "DH PARAMETERS" pem blocks
+type dhParameters struct {
+	P *big.Int
+	G *big.Int
+}
+
+// generateDHParams writes diffie-hellman parameters for tls servers
+// which need them (ie. for DHE cipher suites): one of the RFC 7919
+// groups natively, or custom parameters of "-bits" size with openssl
+func generateDHParams(args []string) {
+	fs := flag.NewFlagSet("dhparam", flag.ContinueOnError)
+	addCommonFlags(fs)
+	// searching for a safe prime takes much longer than other openssl commands
+	opensslTimeout = 10 * time.Minute
+	addOpensslFlags(fs)
+	group := fs.String("group", "ffdhe2048", "RFC 7919 group (ffdhe2048, ffdhe3072 or ffdhe4096)")
+	bits := fs.Int("bits", 0, "generate custom parameters of this size with openssl instead of using \"-group\"")
+	out := fs.String("out", "", "file to write the parameters to (default is stdout)")
+	overwrite := fs.Bool("overwrite", false, "overwrite an existing \"-out\" file")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+	if len(fs.Args()) > 0 {
+		errorLog.Fatalf("Unexpected arguments %s", strings.Join(fs.Args(), ","))
+	}
+	if *out != "" {
+		if _, err := os.Stat(*out); err == nil && !*overwrite {
+			errorLog.Fatalf("Skipping creation of %s because it already exists.\nUse the \"-overwrite\" option to overwrite the existing file.", *out)
+		} else if err == nil {
+			confirm("Overwrite "+*out+"?", "overwrite "+*out)
+		}
+	}
+
+	var params []byte
+	if *bits > 0 {
+		if *bits < 2048 {
+			usageLog.Fatalf("Invalid \"-bits\" value %d (must be at least 2048)", *bits)
+		}
+		infoLog.Printf("Running openssl to generate %d bit dh parameters (this can take several minutes)\n", *bits)
+		if params, err = runOpenssl([]string{"dhparam", "-outform", "PEM", strconv.Itoa(*bits)}, ""); err != nil {
+			errorLog.Fatalf("Error running openssl: %s", err)
+		}
+		if block, _ := pem.Decode(params); block == nil || block.Type != "DH PARAMETERS" {
+			errorLog.Fatalf("Unexpected output from openssl dhparam")
+		}
+	} else {
+		prime, ok := ffdheGroups[*group]
+		if !ok {
+			errorLog.Fatalf("Unknown group %s (must be ffdhe2048, ffdhe3072 or ffdhe4096)", *group)
+		}
+		p, _ := new(big.Int).SetString(prime, 16)
+		der, err := asn1.Marshal(dhParameters{P: p, G: big.NewInt(2)})
+		if err != nil {
+			errorLog.Fatalf("Failed to marshal dh parameters: %s", err)
+		}
+		params = pem.EncodeToMemory(&pem.Block{Type: "DH PARAMETERS", Bytes: der})
+	}
+
+	if *out == "" {
+		if _, err = os.Stdout.Write(params); err != nil {
+			errorLog.Fatalf("Failed to write dh parameters: %s", err)
+		}
+		return
+	}
+	writeFile(*out, params, publicPerms)
+	infoLog.Printf("Saved dh parameters to %s\n", *out)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parseDHParams returns the single "DH PARAMETERS" pem block of data
+func parseDHParams(t *testing.T, data []byte) dhParameters {
+	t.Helper()
+	block, rest := pem.Decode(data)
+	if block == nil || block.Type != "DH PARAMETERS" || len(rest) > 0 {
+		t.Fatalf("not a single dh parameters pem block:\n%s", data)
+	}
+	var params dhParameters
+	if rest, err := asn1.Unmarshal(block.Bytes, &params); err != nil || len(rest) > 0 {
+		t.Fatalf("invalid dh parameters: %v", err)
+	}
+	return params
+}
+
+func TestDHParamGroups(t *testing.T) {
+	tests := []struct {
+		group string
+		bits  int
+	}{
+		{"", 2048},
+		{"ffdhe2048", 2048},
+		{"ffdhe3072", 3072},
+		{"ffdhe4096", 4096},
+	}
+	for _, tt := range tests {
+		t.Run(tt.group, func(t *testing.T) {
+			args := []string{"dhparam"}
+			if tt.group != "" {
+				args = append(args, "-group="+tt.group)
+			}
+			params := parseDHParams(t, certshop(t, t.TempDir(), args...))
+			if params.P.BitLen() != tt.bits {
+				t.Errorf("%d bit prime, want %d", params.P.BitLen(), tt.bits)
+			}
+			if params.G.Cmp(big.NewInt(2)) != 0 {
+				t.Errorf("generator %v, want 2", params.G)
+			}
+			// RFC 7919 primes are safe primes
+			q := new(big.Int).Rsh(params.P, 1)
+			if !params.P.ProbablyPrime(4) || !q.ProbablyPrime(4) {
+				t.Errorf("%s isn't a safe prime", tt.group)
+			}
+		})
+	}
+}
+
+func TestDHParamOut(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "dhparam", "-group=ffdhe3072", "-out=dhparams.pem")
+	data, err := os.ReadFile(filepath.Join(dir, "dhparams.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params := parseDHParams(t, data); params.P.BitLen() != 3072 {
+		t.Errorf("%d bit prime, want 3072", params.P.BitLen())
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"existing out", []string{"-out=dhparams.pem"}, "already exists"},
+		{"unknown group", []string{"-group=modp2048"}, "Unknown group modp2048"},
+		{"small bits", []string{"-bits=1024"}, "must be at least 2048"},
+		{"arguments", []string{"dhparams.pem"}, "Unexpected arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := runCertshop(t, dir, nil, append([]string{"dhparam"}, tt.args...)...)
+			if res.code == 0 || !strings.Contains(res.stderr, tt.err) {
+				t.Errorf("status %d, want an error with %q:\n%s", res.code, tt.err, res.stderr)
+			}
+		})
+	}
+	if after, err := os.ReadFile(filepath.Join(dir, "dhparams.pem")); err != nil || string(after) != string(data) {
+		t.Errorf("dhparams.pem changed")
+	}
+}
+
+func TestDHParamBits(t *testing.T) {
+	params := pem.EncodeToMemory(&pem.Block{Type: "DH PARAMETERS", Bytes: []byte{0x30, 0x06, 0x02, 0x01, 0x17, 0x02, 0x01, 0x05}})
+	argsFile := filepath.Join(t.TempDir(), "args")
+	installOpenssl(t, "echo \"$@\" > '"+argsFile+"'\ncat > /dev/null\nprintf '%s' '"+string(params)+"'\n")
+	if got := certshop(t, t.TempDir(), "dhparam", "-bits=3072"); string(got) != string(params) {
+		t.Errorf("got\n%s\nwant the openssl output\n%s", got, params)
+	}
+	if args, err := os.ReadFile(argsFile); err != nil || strings.TrimSpace(string(args)) != "dhparam -outform PEM 3072" {
+		t.Errorf("openssl was run with %q", args)
+	}
+
+	installOpenssl(t, "cat > /dev/null\necho 'not parameters'\n")
+	if res := runCertshop(t, t.TempDir(), nil, "dhparam", "-bits=2048"); res.code == 0 || !strings.Contains(res.stderr, "Unexpected output from openssl dhparam") {
+		t.Errorf("status %d for unexpected openssl output:\n%s", res.code, res.stderr)
+	}
+}
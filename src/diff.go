@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// certDiff is one field which differs between two certificates; Added
+// and Removed are only populated for list fields (SANs and usages)
+type certDiff struct {
+	Field   string   `json:"field"`
+	Old     string   `json:"old"`
+	New     string   `json:"new"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+func diffCertificates(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	addCommonFlags(fs)
+	jsonOutput := fs.Bool("json", false, "output the differences as json")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	if len(fs.Args()) != 2 {
+		errorLog.Fatalf("Expected two certificate paths but got %s", strings.Join(fs.Args(), ","))
+	}
+	infoLog.Printf("Comparing Certificate %s to %s", fs.Arg(0), fs.Arg(1))
+
+	diffs := compareCertificates(parseCert(fs.Arg(0)), parseCert(fs.Arg(1)))
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(diffs); err != nil {
+			errorLog.Fatalf("Failed to write json: %s", err)
+		}
+		return
+	}
+	for _, diff := range diffs {
+		if diff.Added != nil || diff.Removed != nil {
+			// SANs and extended key usages are the usual culprits so
+			// show exactly what changed
+			fmt.Printf("! %s:\n", diff.Field)
+			for _, value := range diff.Removed {
+				fmt.Printf("    - %s\n", value)
+			}
+			for _, value := range diff.Added {
+				fmt.Printf("    + %s\n", value)
+			}
+		} else {
+			fmt.Printf("%s:\n    - %s\n    + %s\n", diff.Field, diff.Old, diff.New)
+		}
+	}
+	infoLog.Printf("Found %d differences", len(diffs))
+}
+
+func compareCertificates(before *x509.Certificate, after *x509.Certificate) []certDiff {
+	diffs := []certDiff{}
+	compare := func(field string, beforeValue string, afterValue string) {
+		if beforeValue != afterValue {
+			diffs = append(diffs, certDiff{Field: field, Old: beforeValue, New: afterValue})
+		}
+	}
+	compareList := func(field string, beforeValues []string, afterValues []string) {
+		added, removed := diffLists(beforeValues, afterValues)
+		if len(added) > 0 || len(removed) > 0 {
+			diffs = append(diffs, certDiff{Field: field,
+				Old: strings.Join(beforeValues, ","), New: strings.Join(afterValues, ","),
+				Added: added, Removed: removed})
+		}
+	}
+	compare("Subject", formatDn(before.Subject), formatDn(after.Subject))
+	compare("Issuer", formatDn(before.Issuer), formatDn(after.Issuer))
+	compare("Serial Number", before.SerialNumber.Text(16), after.SerialNumber.Text(16))
+	compare("Not Before", before.NotBefore.UTC().Format(time.RFC3339), after.NotBefore.UTC().Format(time.RFC3339))
+	compare("Not After", before.NotAfter.UTC().Format(time.RFC3339), after.NotAfter.UTC().Format(time.RFC3339))
+	compareList("Subject Alternative Names", subjectAlternativeNames(before), subjectAlternativeNames(after))
+	compareList("Key Usage", keyUsageNames(before.KeyUsage), keyUsageNames(after.KeyUsage))
+	compareList("Extended Key Usage", extKeyUsageNames(before.ExtKeyUsage), extKeyUsageNames(after.ExtKeyUsage))
+	compare("CA", fmt.Sprint(before.IsCA), fmt.Sprint(after.IsCA))
+	compare("Public Key", publicKeyFingerprint(before), publicKeyFingerprint(after))
+	return diffs
+}
+
+func subjectAlternativeNames(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return append(names, cert.EmailAddresses...)
+}
+
+// publicKeyFingerprint is the sha256 hash of the SubjectPublicKeyInfo
+func publicKeyFingerprint(cert *x509.Certificate) string {
+	return spkiFingerprint(cert.RawSubjectPublicKeyInfo)
+}
+
+func spkiFingerprint(spki []byte) string {
+	hash := sha256.Sum256(spki)
+	return "SHA256:" + hex.EncodeToString(hash[:])
+}
+
+func diffLists(oldValues []string, newValues []string) (added []string, removed []string) {
+	contains := func(values []string, value string) bool {
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+	for _, value := range newValues {
+		if !contains(oldValues, value) {
+			added = append(added, value)
+		}
+	}
+	for _, value := range oldValues {
+		if !contains(newValues, value) {
+			removed = append(removed, value)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffLists(t *testing.T) {
+	tests := []struct {
+		old, new       []string
+		added, removed []string
+	}{
+		{[]string{"a", "b"}, []string{"a", "b"}, nil, nil},
+		{[]string{"a"}, []string{"a", "b"}, []string{"b"}, nil},
+		{[]string{"a", "b"}, []string{"b"}, nil, []string{"a"}},
+		{[]string{"a"}, []string{"b"}, []string{"b"}, []string{"a"}},
+		{nil, nil, nil, nil},
+	}
+	for _, tt := range tests {
+		added, removed := diffLists(tt.old, tt.new)
+		if !reflect.DeepEqual(added, tt.added) || !reflect.DeepEqual(removed, tt.removed) {
+			t.Errorf("diffLists(%v, %v) = %v, %v, want %v, %v", tt.old, tt.new, added, removed, tt.added, tt.removed)
+		}
+	}
+}
+
+func TestDiffRenewedCertificate(t *testing.T) {
+	dir := newTree(t)
+	old := filepath.Join(dir, "old")
+	if err := os.Mkdir(old, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "ca/ica/server/server.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(old, "old.crt"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// renew the certificate with the same key but a changed SAN
+	certshop(t, dir, "server", "-dn=/CN=server", "-san=www.example.com,10.0.0.1", "-overwrite", "-yes",
+		"-key-in=ca/ica/server/server.key", "ca/ica/server")
+
+	diffs := []certDiff{}
+	if err = json.Unmarshal(certshop(t, dir, "diff", "-json", "old", "ca/ica/server"), &diffs); err != nil {
+		t.Fatalf("Failed to parse the json diff: %s", err)
+	}
+	fields := map[string]certDiff{}
+	for _, diff := range diffs {
+		fields[diff.Field] = diff
+	}
+	for _, field := range []string{"Serial Number", "Subject Alternative Names"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("the %s change isn't reported", field)
+		}
+	}
+	for _, field := range []string{"Subject", "Issuer", "Public Key", "Key Usage", "Extended Key Usage", "CA"} {
+		if diff, ok := fields[field]; ok {
+			t.Errorf("the unchanged %s is reported as changed from %s to %s", field, diff.Old, diff.New)
+		}
+	}
+	san := fields["Subject Alternative Names"]
+	if !reflect.DeepEqual(san.Added, []string{"www.example.com"}) || !reflect.DeepEqual(san.Removed, []string{"server.example.com"}) {
+		t.Errorf("got added %v and removed %v subject alternative names", san.Added, san.Removed)
+	}
+}
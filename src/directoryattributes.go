@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var oidSubjectDirectoryAttributes = asn1.ObjectIdentifier{2, 5, 29, 9}
+
+// personal data attributes of rfc 3739 (qualified certificates)
+var (
+	oidDateOfBirth          = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 9, 1}
+	oidPlaceOfBirth         = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 9, 2}
+	oidGender               = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 9, 3}
+	oidCountryOfCitizenship = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 9, 4}
+	oidCountryOfResidence   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 9, 5}
+)
+
+type directoryAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// subjectDirectoryAttributes encodes the non-empty attributes as a
+// subject directory attributes extension (ie. for eidas certificates);
+// ok is false when there are none
+func subjectDirectoryAttributes(dateOfBirth, placeOfBirth, gender, citizenship, residence string) (extension pkix.Extension, ok bool, err error) {
+	attributes := []directoryAttribute{}
+	add := func(oid asn1.ObjectIdentifier, value interface{}, params string) error {
+		der, err := asn1.MarshalWithParams(value, params)
+		if err != nil {
+			return err
+		}
+		attributes = append(attributes, directoryAttribute{Type: oid, Values: []asn1.RawValue{{FullBytes: der}}})
+		return nil
+	}
+	if dateOfBirth != "" {
+		date, err := time.Parse("2006-01-02", dateOfBirth)
+		if err != nil {
+			return extension, false, fmt.Errorf("invalid date of birth %s (must be YYYY-MM-DD)", dateOfBirth)
+		}
+		// rfc 3739 requires generalized time at midnight gmt
+		if err = add(oidDateOfBirth, date, "generalized"); err != nil {
+			return extension, false, err
+		}
+	}
+	if placeOfBirth != "" {
+		if err = add(oidPlaceOfBirth, placeOfBirth, "utf8"); err != nil {
+			return extension, false, err
+		}
+	}
+	if gender != "" {
+		gender = strings.ToUpper(gender)
+		if gender != "M" && gender != "F" {
+			return extension, false, fmt.Errorf("invalid gender %s (must be M or F)", gender)
+		}
+		if err = add(oidGender, gender, "printable"); err != nil {
+			return extension, false, err
+		}
+	}
+	for _, countries := range []struct {
+		oid  asn1.ObjectIdentifier
+		list string
+	}{{oidCountryOfCitizenship, citizenship}, {oidCountryOfResidence, residence}} {
+		if countries.list == "" {
+			continue
+		}
+		for _, country := range strings.Split(countries.list, ",") {
+			if len(country) != 2 {
+				return extension, false, fmt.Errorf("invalid country %s (must be a two letter iso 3166 code)", country)
+			}
+			if err = add(countries.oid, strings.ToUpper(country), "printable"); err != nil {
+				return extension, false, err
+			}
+		}
+	}
+	if len(attributes) == 0 {
+		return extension, false, nil
+	}
+	value, err := asn1.Marshal(attributes)
+	if err != nil {
+		return extension, false, err
+	}
+	// the extension must not be critical
+	return pkix.Extension{Id: oidSubjectDirectoryAttributes, Value: value}, true, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/asn1"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSubjectDirectoryAttributes(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	tests := []struct {
+		name string
+		args []string
+		want map[string][]string
+	}{
+		{"none", nil, map[string][]string{}},
+		{"all", []string{"-date-of-birth=1980-02-29", "-place-of-birth=Zürich", "-gender=f", "-citizenship=ch,de", "-residence=AT"}, map[string][]string{
+			oidDateOfBirth.String():          {"1980-02-29"},
+			oidPlaceOfBirth.String():         {"Zürich"},
+			oidGender.String():               {"F"},
+			oidCountryOfCitizenship.String(): {"CH", "DE"},
+			oidCountryOfResidence.String():   {"AT"},
+		}},
+		{"citizenship", []string{"-citizenship=US"}, map[string][]string{oidCountryOfCitizenship.String(): {"US"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "ca/" + tt.name
+			certshop(t, dir, append(append([]string{"client", "-dn=/CN=person"}, tt.args...), path)...)
+			got := map[string][]string{}
+			for _, extension := range parseCert(filepath.Join(dir, path)).Extensions {
+				if !extension.Id.Equal(oidSubjectDirectoryAttributes) {
+					continue
+				}
+				if extension.Critical {
+					t.Error("the extension is critical")
+				}
+				var attributes []directoryAttribute
+				if rest, err := asn1.Unmarshal(extension.Value, &attributes); err != nil || len(rest) > 0 {
+					t.Fatalf("Failed to decode the extension: %v", err)
+				}
+				for _, attribute := range attributes {
+					for _, value := range attribute.Values {
+						var decoded interface{}
+						if _, err := asn1.Unmarshal(value.FullBytes, &decoded); err != nil {
+							t.Fatalf("Failed to decode %s: %s", attribute.Type, err)
+						}
+						if date, ok := decoded.(time.Time); ok {
+							if value.Tag != asn1.TagGeneralizedTime {
+								t.Errorf("the date of birth isn't a generalized time")
+							}
+							decoded = date.Format("2006-01-02")
+						}
+						got[attribute.Type.String()] = append(got[attribute.Type.String()], decoded.(string))
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got attributes %v, want %v", got, tt.want)
+			}
+		})
+	}
+	for _, args := range [][]string{{"-date-of-birth=29/02/1980"}, {"-gender=X"}, {"-citizenship=USA"}} {
+		if res := runCertshop(t, dir, nil, append(append([]string{"client", "-dn=/CN=person"}, args...), "ca/invalid")...); res.code == 0 {
+			t.Errorf("%s was accepted", args[0])
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+var oidPrimeField = asn1.ObjectIdentifier{1, 2, 840, 10045, 1, 1}
+
+// ecSpecifiedDomain is the explicit form of the curve parameters from
+// RFC 3279 (SpecifiedECDomain) which a few legacy systems need instead
+// of a named curve oid
+type ecSpecifiedDomain struct {
+	Version  int
+	FieldID  ecFieldID
+	Curve    ecCurve
+	Base     []byte
+	Order    *big.Int
+	Cofactor int
+}
+
+type ecFieldID struct {
+	FieldType asn1.ObjectIdentifier
+	Prime     *big.Int
+}
+
+type ecCurve struct {
+	A []byte
+	B []byte
+}
+
+type ecPrivateKeyExplicit struct {
+	Version    int
+	PrivateKey []byte
+	Parameters ecSpecifiedDomain `asn1:"explicit,tag:0"`
+	PublicKey  asn1.BitString    `asn1:"explicit,tag:1"`
+}
+
+// marshalECPrivateKeyExplicit encodes the key like
+// x509.MarshalECPrivateKey but with explicit curve parameters
+func marshalECPrivateKeyExplicit(key *ecdsa.PrivateKey) ([]byte, error) {
+	params := key.Curve.Params()
+	size := (params.BitSize + 7) / 8
+	pub, err := key.PublicKey.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	a := new(big.Int).Sub(params.P, big.NewInt(3)) // a = -3 for the NIST curves
+	base := append([]byte{4}, params.Gx.FillBytes(make([]byte, size))...)
+	base = append(base, params.Gy.FillBytes(make([]byte, size))...)
+	return asn1.Marshal(ecPrivateKeyExplicit{
+		Version:    1,
+		PrivateKey: key.D.FillBytes(make([]byte, size)),
+		Parameters: ecSpecifiedDomain{
+			Version: 1,
+			FieldID: ecFieldID{FieldType: oidPrimeField, Prime: params.P},
+			Curve: ecCurve{
+				A: a.FillBytes(make([]byte, size)),
+				B: params.B.FillBytes(make([]byte, size)),
+			},
+			Base:     base,
+			Order:    params.N,
+			Cofactor: 1,
+		},
+		PublicKey: asn1.BitString{Bytes: pub.Bytes(), BitLength: 8 * len(pub.Bytes())},
+	})
+}
+
+// parseECPrivateKeyExplicit decodes a key written by
+// marshalECPrivateKeyExplicit, matching the explicit curve parameters
+// against the named curves go supports
+func parseECPrivateKeyExplicit(der []byte) (*ecdsa.PrivateKey, error) {
+	var explicit ecPrivateKeyExplicit
+	if rest, err := asn1.Unmarshal(der, &explicit); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after the private key")
+	}
+	domain := explicit.Parameters
+	for _, curve := range []elliptic.Curve{elliptic.P224(), elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		params := curve.Params()
+		if !domain.FieldID.FieldType.Equal(oidPrimeField) || domain.FieldID.Prime.Cmp(params.P) != 0 ||
+			new(big.Int).SetBytes(domain.Curve.B).Cmp(params.B) != 0 || domain.Order.Cmp(params.N) != 0 {
+			continue
+		}
+		return ecdsa.ParseRawPrivateKey(curve, explicit.PrivateKey)
+	}
+	return nil, errors.New("the explicit curve parameters don't match a supported curve")
+}
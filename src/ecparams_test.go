@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestExplicitCurveParameters(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	tests := []struct {
+		path     string
+		explicit bool
+	}{
+		{"ca/named", false},
+		{"ca/explicit", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			certshop(t, dir, "client", "-dn=/CN=client", fmt.Sprintf("-ec-explicit-params=%t", tt.explicit), tt.path)
+			keyFile := filepath.Join(dir, tt.path, filepath.Base(tt.path)+".key")
+			block, _ := pem.Decode([]byte(readFile(keyFile)))
+			if block == nil || block.Type != "EC PRIVATE KEY" {
+				t.Fatalf("%s isn't a pem ec private key", keyFile)
+			}
+			// the parameters are an oid for a named curve or a sequence
+			// (SpecifiedECDomain) for explicit parameters
+			var key struct {
+				Version    int
+				PrivateKey []byte
+				Parameters asn1.RawValue
+			}
+			var params asn1.RawValue
+			if _, err := asn1.Unmarshal(block.Bytes, &key); err != nil {
+				t.Fatalf("Failed to decode %s: %s", keyFile, err)
+			} else if _, err = asn1.Unmarshal(key.Parameters.Bytes, &params); err != nil {
+				t.Fatalf("Failed to decode the curve parameters of %s: %s", keyFile, err)
+			}
+			if explicit := params.Tag == asn1.TagSequence; explicit != tt.explicit {
+				t.Errorf("got explicit parameters %t, want %t", explicit, tt.explicit)
+			}
+			if tt.explicit {
+				var domain ecSpecifiedDomain
+				if _, err := asn1.Unmarshal(params.FullBytes, &domain); err != nil {
+					t.Fatalf("Failed to decode the explicit parameters: %s", err)
+				}
+				if params := elliptic.P384().Params(); domain.FieldID.Prime.Cmp(params.P) != 0 || domain.Order.Cmp(params.N) != 0 {
+					t.Error("the explicit parameters aren't the P-384 curve")
+				}
+			}
+
+			// the key can still be read back, ie. to export it
+			cert := parseCert(filepath.Join(dir, tt.path))
+			if !parseKeyFile(keyFile, "").PublicKey.Equal(cert.PublicKey) {
+				t.Error("the private key doesn't match the certificate")
+			}
+			certshop(t, dir, "export", tt.path)
+		})
+	}
+}
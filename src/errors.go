@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// jsonError is written to stderr for each error when "-error-format"
+// is json, so that wrappers can parse failures reliably
+type jsonError struct {
+	Code    string           `json:"code"`
+	Message string           `json:"message"`
+	Context jsonErrorContext `json:"context"`
+}
+
+type jsonErrorContext struct {
+	Command string `json:"command"`
+	Source  string `json:"source,omitempty"`
+}
+
+// errorFormat is the format of error messages set by "-error-format"
+var errorFormat = "text"
+
+// jsonErrorWriter converts the lines written by errorLog or usageLog
+// (prefix, source file and message) to json with the code of the logger
+type jsonErrorWriter struct {
+	w    io.Writer
+	code string
+}
+
+func (j jsonErrorWriter) Write(p []byte) (int, error) {
+	message := strings.TrimPrefix(strings.TrimSuffix(string(p), "\n"), "ERROR: ")
+	source := ""
+	if i := strings.Index(message, ": "); i > 0 && strings.Contains(message[:i], ".go:") {
+		source, message = message[:i], message[i+2:]
+	}
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	data, err := json.Marshal(jsonError{Code: j.code, Message: message, Context: jsonErrorContext{Command: command, Source: source}})
+	if err != nil {
+		return 0, err
+	}
+	if _, err = j.w.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// setErrorFormat switches errorLog and usageLog between text and json
+// output
+func setErrorFormat(format string) error {
+	switch format {
+	case "text":
+		errorLog.SetOutput(os.Stderr)
+		usageLog.SetOutput(os.Stderr)
+	case "json":
+		errorLog.SetOutput(jsonErrorWriter{w: os.Stderr, code: "error"})
+		usageLog.SetOutput(jsonErrorWriter{w: os.Stderr, code: "usage"})
+	default:
+		return fmt.Errorf("must be text or json")
+	}
+	errorFormat = format
+	return nil
+}
+
+// errorFormatArg returns the "-error-format" value among the flags in args
+// (the command followed by its arguments), or else $CERTSHOP_ERROR_FORMAT,
+// so that main can apply it before the flags are parsed
+func errorFormatArg(args []string) string {
+	format := os.Getenv("CERTSHOP_ERROR_FORMAT")
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if value := strings.TrimPrefix(name, "error-format="); value != name {
+			format = value
+		} else if name == "error-format" && i+1 < len(args) {
+			format = args[i+1]
+			i++
+		}
+	}
+	return format
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONErrorFormat(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		name    string
+		args    []string
+		env     string
+		code    string
+		message string
+	}{
+		{"unknown flag", []string{"server", "-error-format=json", "-no-such-flag"}, "", "usage", "flag provided but not defined: -no-such-flag"},
+		{"format after the unknown flag", []string{"server", "-no-such-flag", "-error-format=json"}, "", "usage", "flag provided but not defined: -no-such-flag"},
+		{"separate format value", []string{"server", "-dn", "/CN=server", "-no-such-flag", "--error-format", "json"}, "", "usage", "flag provided but not defined: -no-such-flag"},
+		{"environment", []string{"server", "-no-such-flag"}, "json", "usage", "flag provided but not defined: -no-such-flag"},
+		{"invalid path", []string{"verify", "-error-format=json", "a", "b"}, "", "usage", "Invalid path"},
+		{"missing ca", []string{"client", "-error-format=json", "-dn=/CN=client", "missing/client"}, "", "error", "missing/missing.crt"},
+		// a message starting with "Invalid" is only a usage error if it is about the command line
+		{"invalid sct list", []string{"embed-scts", "-error-format=json", "-sct-list=ca/ca.crt", "ca/ica/server"}, "", "error", "Invalid SignedCertificateTimestampList"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CERTSHOP_ERROR_FORMAT", tt.env)
+			res := runCertshop(t, dir, nil, tt.args...)
+			if res.code == 0 {
+				t.Fatal("certshop succeeded")
+			}
+			// informational messages are still text, the error is the last line
+			lines := strings.Split(strings.TrimSpace(res.stderr), "\n")
+			var e jsonError
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &e); err != nil {
+				t.Fatalf("the error isn't json: %s\n%s", err, res.stderr)
+			}
+			if e.Code != tt.code || !strings.Contains(e.Message, tt.message) || e.Context.Command != tt.args[0] {
+				t.Errorf("got %+v, want code %s, command %s and a message containing %q", e, tt.code, tt.args[0], tt.message)
+			}
+			if strings.Contains(res.stderr, "Usage of") {
+				t.Errorf("the flag usage is printed as text:\n%s", res.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// exit codes for the expiring command follow the nagios plugin
+// convention so the command can be used directly as a monitoring check
+const (
+	expiringOK       = 0
+	expiringWarning  = 1
+	expiringCritical = 2
+)
+
+func expiringCertificates(args []string) int {
+	fs := flag.NewFlagSet("expiring", flag.ContinueOnError)
+	addCommonFlags(fs)
+	warnDays := fs.Int("warn-days", 30, "warn when a certificate expires within this many days")
+	criticalDays := fs.Int("critical-days", 7, "critical when a certificate expires within this many days")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	path := "ca"
+	if len(fs.Args()) > 1 {
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+	} else if len(fs.Args()) == 1 {
+		path = fs.Arg(0)
+	}
+	if *criticalDays > *warnDays {
+		errorLog.Fatalf("The \"-critical-days\" value (%d) can't be greater than the \"-warn-days\" value (%d)", *criticalDays, *warnDays)
+	}
+
+	status := expiringOK
+	walkCertificates(path, func(path string, cert *x509.Certificate) {
+		certStatus := expiringStatus(cert, *warnDays, *criticalDays)
+		if certStatus == expiringOK {
+			return
+		}
+		label := "WARNING"
+		if certStatus == expiringCritical {
+			label = "CRITICAL"
+		}
+		days := int(cert.NotAfter.Sub(runTime).Hours() / 24)
+		fmt.Printf("%s: %s expires %s (%d days)\n", label, path, cert.NotAfter.UTC().Format(time.RFC3339), days)
+		if certStatus > status {
+			status = certStatus
+		}
+	})
+	if status == expiringOK {
+		fmt.Printf("OK: no certificates expire within %d days\n", *warnDays)
+	}
+	return status
+}
+
+// expiringStatus compares the certificate expiry to runTime
+func expiringStatus(cert *x509.Certificate, warnDays int, criticalDays int) int {
+	if cert.NotAfter.Before(runTime.AddDate(0, 0, criticalDays)) {
+		return expiringCritical
+	} else if cert.NotAfter.Before(runTime.AddDate(0, 0, warnDays)) {
+		return expiringWarning
+	}
+	return expiringOK
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpiringStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		notAfter time.Time
+		want     int
+	}{
+		{"expired", runTime.AddDate(0, 0, -1), expiringCritical},
+		{"within critical days", runTime.AddDate(0, 0, 6), expiringCritical},
+		{"at critical days", runTime.AddDate(0, 0, 7), expiringWarning},
+		{"within warn days", runTime.AddDate(0, 0, 29), expiringWarning},
+		{"at warn days", runTime.AddDate(0, 0, 30), expiringOK},
+		{"after warn days", runTime.AddDate(1, 0, 0), expiringOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expiringStatus(&x509.Certificate{NotAfter: tt.notAfter}, 30, 7); got != tt.want {
+				t.Errorf("got status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiringExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	tests := []struct {
+		name     string
+		validity string
+		code     int
+		label    string
+	}{
+		{"ok", "365", expiringOK, "OK"},
+		{"warning", "20", expiringWarning, "WARNING"},
+		{"critical", "3", expiringCritical, "CRITICAL"},
+	}
+	// each certificate makes the tree at least as bad as the one before
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certshop(t, dir, "server", "-dn=/CN="+tt.name, "-validity="+tt.validity, "ca/"+tt.name)
+			res := runCertshop(t, dir, nil, "expiring", "-warn-days=30", "-critical-days=7")
+			if res.code != tt.code {
+				t.Errorf("got exit status %d, want %d", res.code, tt.code)
+			}
+			if !strings.HasPrefix(string(res.stdout), tt.label+": ") {
+				t.Errorf("got output %q, want a %s line", res.stdout, tt.label)
+			}
+			if tt.code != expiringOK && !strings.Contains(string(res.stdout), "ca/"+tt.name+" expires") {
+				t.Errorf("ca/%s isn't listed in %q", tt.name, res.stdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,684 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"encoding/pem"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExportFormats(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		name    string
+		args    []string
+		entries []string
+		openssl bool
+	}{
+		{"pem", nil, []string{"ca.pem", "cert.pem", "key.pem", "server.crt", "server.key"}, false},
+		{"pem and p7b", []string{"-p7b"}, []string{"ca.pem", "cert.pem", "key.pem", "server.crt", "server.key", "server.p7b"}, false},
+		{"pem and p12", []string{"-p12", "-password=secret"}, []string{"ca.pem", "cert.pem", "key.pem", "server.crt", "server.key", "server.p12"}, true},
+		{"p12 only", []string{"-p12", "-password=secret", "-crt=false", "-key=false", "-ca=false"}, []string{"server.p12"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := exec.LookPath("openssl"); err != nil && tt.openssl {
+				t.Skip("openssl isn't installed")
+			}
+			entries := readTgz(t, certshop(t, dir, append(append([]string{"export"}, tt.args...), "ca/ica/server")...))
+			names := []string{}
+			for name := range entries {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if got, want := strings.Join(names, ","), strings.Join(tt.entries, ","); got != want {
+				t.Errorf("got entries %s, want %s", got, want)
+			}
+			if data, ok := entries["server.p12"]; ok {
+				p12File := filepath.Join(t.TempDir(), "server.p12")
+				if err := os.WriteFile(p12File, data, 0600); err != nil {
+					t.Fatal(err)
+				}
+				if !isPKCS12File(p12File) {
+					t.Error("server.p12 isn't a pkcs12 file")
+				}
+			}
+		})
+	}
+}
+
+func TestExportIncludeRoot(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		name  string
+		args  []string
+		count int
+		root  bool
+	}{
+		{"include", nil, 3, true},
+		{"exclude", []string{"-include-root=false"}, 2, false},
+		{"exclude root-first", []string{"-include-root=false", "-chain-order=root-first"}, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := readTgz(t, certshop(t, dir, append(append([]string{"export"}, tt.args...), "ca/ica/server")...))
+			certs := parseCertsPem(entries["server.crt"])
+			if len(certs) != tt.count {
+				t.Fatalf("got %d certificates in the chain, want %d", len(certs), tt.count)
+			}
+			hasRoot := false
+			for _, cert := range certs {
+				hasRoot = hasRoot || isSelfSigned(cert)
+			}
+			if hasRoot != tt.root {
+				t.Errorf("got root in chain %t, want %t", hasRoot, tt.root)
+			}
+		})
+	}
+}
+
+func TestExportIncludeRootOfRoot(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"certificate", nil},
+		{"p7b", []string{"-crt=false", "-p7b"}},
+		{"leaf only", []string{"-leaf-only"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"export", "-include-root=false"}, tt.args...)
+			res := runCertshop(t, dir, nil, append(args, "ca")...)
+			if res.code == 0 || !strings.Contains(res.stderr, "Nothing is left of the certificate chain of ca") {
+				t.Errorf("got status %d, want an error for the empty chain:\n%s", res.code, res.stderr)
+			}
+			if len(res.stdout) > 0 {
+				t.Errorf("%d bytes were written to stdout", len(res.stdout))
+			}
+		})
+	}
+	// the root is only left out of the chains below it
+	if certs := parseCertsPem(readTgz(t, certshop(t, dir, "export", "-include-root=false", "ca/ica"))["ica.crt"]); len(certs) != 1 {
+		t.Errorf("got %d certificates in the chain of ca/ica, want 1", len(certs))
+	}
+}
+
+// tgzModes returns the file modes of the entries of a tgz archive
+func tgzModes(t *testing.T, data []byte) map[string]int64 {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	modes := map[string]int64{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return modes
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		modes[header.Name] = header.Mode
+	}
+}
+
+func TestExportFileModes(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		name              string
+		args              []string
+		certMode, keyMode int64
+	}{
+		{"default", nil, 0644, 0600},
+		{"configured", []string{"-cert-mode=0640", "-key-mode=0400"}, 0640, 0400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modes := tgzModes(t, certshop(t, dir, append(append([]string{"export", "-openvpn"}, tt.args...), "ca/ica/server")...))
+			want := map[string]int64{
+				"server.crt": tt.certMode, "cert.pem": tt.certMode, "ca.pem": tt.certMode,
+				"server.key": tt.keyMode, "key.pem": tt.keyMode, "server.ovpn": tt.keyMode,
+			}
+			for name, mode := range want {
+				if modes[name] != mode {
+					t.Errorf("%s has mode %04o, want %04o", name, modes[name], mode)
+				}
+			}
+		})
+	}
+
+	for _, mode := range []string{"-key-mode=abc", "-cert-mode=01000"} {
+		if res := runCertshop(t, dir, nil, "export", mode, "ca/ica/server"); res.code == 0 {
+			t.Errorf("the invalid %s was accepted", mode)
+		}
+	}
+}
+
+func TestExportZipKeyMode(t *testing.T) {
+	dir := newTree(t)
+	data := certshop(t, dir, "export", "-archive-format=zip", "ca/ica/server")
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to read the zip archive: %s", err)
+	}
+	for _, file := range zr.File {
+		want := os.FileMode(0644)
+		if strings.HasSuffix(file.Name, ".key") || file.Name == "key.pem" {
+			want = 0600
+		}
+		if mode := file.Mode().Perm(); mode != want {
+			t.Errorf("%s has mode %04o, want %04o", file.Name, mode, want)
+		}
+	}
+}
+
+func TestExportChainOrder(t *testing.T) {
+	dir := newTree(t)
+	leafFirst := parseCertsPem(readTgz(t, certshop(t, dir, "export", "ca/ica/server"))["server.crt"])
+	rootFirst := parseCertsPem(readTgz(t, certshop(t, dir, "export", "-chain-order=root-first", "ca/ica/server"))["server.crt"])
+	if len(leafFirst) != 3 || len(rootFirst) != 3 {
+		t.Fatalf("got chains of %d and %d certificates, want 3", len(leafFirst), len(rootFirst))
+	}
+	if leafFirst[0].Subject.CommonName != "server" || !isSelfSigned(leafFirst[2]) {
+		t.Error("the default chain isn't leaf first")
+	}
+	for i := range leafFirst {
+		if !leafFirst[i].Equal(rootFirst[len(rootFirst)-1-i]) {
+			t.Errorf("certificate %d of the root-first chain isn't certificate %d of the leaf-first chain", len(rootFirst)-1-i, i)
+		}
+	}
+	if res := runCertshop(t, dir, nil, "export", "-chain-order=sideways", "ca/ica/server"); res.code == 0 {
+		t.Error("an invalid chain order was accepted")
+	}
+}
+
+func TestExportTrustStore(t *testing.T) {
+	dir := newTree(t)
+	certshop(t, dir, "ca", "-dn=/CN=Example Root/O=Example Inc", "example")
+	tests := []struct {
+		path    string
+		entry   string
+		subject string
+	}{
+		{"ca/ica/server", "root.crt", "# Subject: /CN=root\n"},
+		{"example", "Example_Root.crt", "# Subject: /CN=Example Root/O=Example Inc\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			entries := readTgz(t, certshop(t, dir, "export", "-trust-store", tt.path))
+			data, ok := entries[tt.entry]
+			if !ok {
+				t.Fatalf("%s isn't in the archive", tt.entry)
+			}
+			if !bytes.HasPrefix(data, []byte(tt.subject)) {
+				t.Errorf("the comment header doesn't start with %q:\n%s", tt.subject, data)
+			}
+			certs := parseCertsPem(data)
+			if len(certs) != 1 || !isSelfSigned(certs[0]) {
+				t.Errorf("%s doesn't hold just the root certificate", tt.entry)
+			}
+		})
+	}
+}
+
+func TestExportKeyEncoding(t *testing.T) {
+	dir := newTree(t)
+	original := parseKey(filepath.Join(dir, "ca/ica/server"))
+	tests := []struct {
+		encoding string
+		pemType  string
+	}{
+		{"sec1", "EC PRIVATE KEY"},
+		{"pkcs8", "PRIVATE KEY"},
+		{"openssh", "OPENSSH PRIVATE KEY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			data := readTgz(t, certshop(t, dir, "export", "-key-encoding="+tt.encoding, "ca/ica/server"))["server.key"]
+			if block, _ := pem.Decode(data); block == nil || block.Type != tt.pemType {
+				t.Fatalf("the exported key isn't a %s pem block", tt.pemType)
+			}
+			keyFile := filepath.Join(t.TempDir(), "server.key")
+			if err := os.WriteFile(keyFile, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if !parseKeyFile(keyFile, "").Equal(original) {
+				t.Error("the exported key doesn't read back as the original key")
+			}
+			// and can be reused to issue a certificate
+			path := "ca/ica/" + tt.encoding
+			certshop(t, dir, "client", "-dn=/CN=reused", "-key-in="+keyFile, path)
+			if !parseCert(filepath.Join(dir, path)).PublicKey.(*ecdsa.PublicKey).Equal(&original.PublicKey) {
+				t.Error("the certificate issued with the exported key has a different public key")
+			}
+		})
+	}
+}
+
+func TestExportRootCA(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		offline bool
+		entries []string
+		warning bool
+	}{
+		{"with key", nil, false, []string{"ca.crt", "ca.key", "ca.pem", "cert.pem", "key.pem"}, false},
+		{"trust anchor", []string{"-key=false"}, false, []string{"ca.crt", "ca.pem", "cert.pem"}, false},
+		{"offline key", nil, true, []string{"ca.crt", "ca.pem", "cert.pem"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			certshop(t, dir, "ca", "-dn=/CN=root")
+			if tt.offline {
+				if err := os.Remove(filepath.Join(dir, "ca", "ca.key")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			res := runCertshop(t, dir, nil, append(append([]string{"export"}, tt.args...), "ca")...)
+			if res.code != 0 {
+				t.Fatalf("the export failed: %s", res.stderr)
+			}
+			entries := readTgz(t, res.stdout)
+			names := []string{}
+			for name := range entries {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if got, want := strings.Join(names, ","), strings.Join(tt.entries, ","); got != want {
+				t.Errorf("got entries %s, want %s", got, want)
+			}
+			if certs := parseCertsPem(entries["cert.pem"]); len(certs) != 1 || certs[0].Subject.CommonName != "root" {
+				t.Errorf("cert.pem doesn't hold just the root certificate")
+			}
+			if warned := strings.Contains(res.stderr, "has no private key"); warned != tt.warning {
+				t.Errorf("got warning %t, want %t: %s", warned, tt.warning, res.stderr)
+			}
+		})
+	}
+}
+
+func TestExportLeafOnly(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"leaf only", []string{"-leaf-only"}},
+		{"root first", []string{"-leaf-only", "-chain-order=root-first"}},
+		{"without root", []string{"-leaf-only", "-include-root=false"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := readTgz(t, certshop(t, dir, append(append([]string{"export"}, tt.args...), "ca/ica/server")...))
+			for _, name := range []string{"cert.pem", "server.crt"} {
+				if certs := parseCertsPem(entries[name]); len(certs) != 1 || certs[0].Subject.CommonName != "server" {
+					t.Errorf("%s doesn't hold just the server certificate", name)
+				}
+			}
+			if certs := parseCertsPem(entries["ca.pem"]); len(certs) != 1 || certs[0].Subject.CommonName != "root" {
+				t.Error("ca.pem doesn't hold the root certificate")
+			}
+		})
+	}
+}
+
+func TestExportZip(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"default", nil},
+		{"p7b", []string{"-p7b"}},
+		{"certificate only", []string{"-key=false", "-ca=false"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(append([]string{"export"}, tt.args...), "ca/ica/server")
+			want := readTgz(t, certshop(t, dir, args...))
+			data := certshop(t, dir, append([]string{"export", "-archive-format=zip"}, args[1:]...)...)
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("Failed to read the zip archive: %s", err)
+			}
+			got := map[string][]byte{}
+			for _, file := range zr.File {
+				rc, err := file.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got[file.Name], err = io.ReadAll(rc); err != nil {
+					t.Fatalf("Failed to read %s from the zip archive: %s", file.Name, err)
+				}
+				rc.Close()
+			}
+			if len(got) != len(want) {
+				t.Errorf("got %d zip entries, want the %d tgz entries", len(got), len(want))
+			}
+			for name, contents := range want {
+				if !bytes.Equal(got[name], contents) {
+					t.Errorf("the zip entry %s doesn't match the tgz entry", name)
+				}
+			}
+		})
+	}
+	if res := runCertshop(t, dir, nil, "export", "-archive-format=rar", "ca/ica/server"); res.code == 0 {
+		t.Error("an unknown archive format was accepted")
+	}
+}
+
+func TestExportCleanPem(t *testing.T) {
+	dir := newTree(t)
+	// a ca chain from elsewhere with comments, blank lines and no final
+	// newline
+	chain, err := os.ReadFile(filepath.Join(dir, "ca/ica/ica.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	messy := "# issuer\n\n" + strings.ReplaceAll(string(bytes.TrimSpace(chain)), "-----\n-----BEGIN", "-----\n\n# root\n\n-----BEGIN")
+	key, err := os.ReadFile(filepath.Join(dir, "ca/ica/ica.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "issuer.pem"), []byte(messy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "issuer-key.pem"), key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	certshop(t, dir, "server", "-dn=/CN=messy", "-ca-cert=issuer.pem", "-ca-key=issuer-key.pem", "messy")
+
+	// checkPem fails unless data is whole pem blocks each ending with
+	// exactly one newline
+	checkPem := func(t *testing.T, name string, data []byte, count int) {
+		t.Helper()
+		clean := []byte{}
+		rest := data
+		for len(rest) > 0 {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				t.Errorf("%s has leftover bytes %.20q", name, rest)
+				return
+			}
+			clean = append(clean, pem.EncodeToMemory(block)...)
+			count--
+		}
+		if !bytes.Equal(clean, data) {
+			t.Errorf("%s has extra whitespace between or after its pem blocks", name)
+		}
+		if count != 0 {
+			t.Errorf("%s has %d certificates too few", name, count)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		args  []string
+		count int
+	}{
+		{"tree", "ca/ica/server", nil, 3},
+		{"messy chain", "messy", nil, 3},
+		{"root first", "messy", []string{"-chain-order=root-first"}, 3},
+		{"without root", "messy", []string{"-include-root=false"}, 2},
+		{"leaf only", "messy", []string{"-leaf-only"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.args == nil {
+				data, err := os.ReadFile(filepath.Join(dir, tt.path, filepath.Base(tt.path)+".crt"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkPem(t, filepath.Base(tt.path)+".crt", data, tt.count)
+			}
+			entries := readTgz(t, certshop(t, dir, append(append([]string{"export"}, tt.args...), tt.path)...))
+			checkPem(t, "cert.pem", entries["cert.pem"], tt.count)
+			checkPem(t, "ca.pem", entries["ca.pem"], 1)
+		})
+	}
+}
+
+func TestExportFailsBeforeWriting(t *testing.T) {
+	dir := newTree(t)
+	certshop(t, dir, "client", "-dn=/CN=client", "ca/ica/client")
+	// broken copies of the server certificate folder
+	broken := func(name string, fileName string, data []byte) string {
+		path := filepath.Join("ca/ica", name)
+		if err := os.MkdirAll(filepath.Join(dir, path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, ext := range []string{".crt", ".key"} {
+			data, err := os.ReadFile(filepath.Join(dir, "ca/ica/server/server"+ext))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = os.WriteFile(filepath.Join(dir, path, name+ext), data, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ca, err := os.ReadFile(filepath.Join(dir, "ca/ica/server/ca.pem"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(dir, path, "ca.pem"), ca, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if fileName != "" {
+			if err = os.WriteFile(filepath.Join(dir, path, fileName), data, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return path
+	}
+	clientKey, err := os.ReadFile(filepath.Join(dir, "ca/ica/client/client.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"missing path", []string{"ca/ica/missing"}},
+		{"file", []string{"file"}},
+		{"corrupt certificate", []string{broken("badcrt", "badcrt.crt", []byte("not a certificate"))}},
+		{"corrupt key", []string{broken("badkey", "badkey.key", []byte("not a key"))}},
+		{"mismatched key", []string{broken("otherkey", "otherkey.key", clientKey)}},
+		{"mismatched key for p12", []string{"-p12", "-password=secret", "-key=false", broken("otherkey", "otherkey.key", clientKey)}},
+		{"empty ca", []string{broken("emptyca", "ca.pem", nil)}},
+		{"empty ca for trust store", []string{"-ca=false", "-trust-store", broken("emptyca", "ca.pem", nil)}},
+		{"zip", []string{"-archive-format=zip", broken("badkey", "badkey.key", []byte("not a key"))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := runCertshop(t, dir, nil, append([]string{"export"}, tt.args...)...)
+			if res.code == 0 {
+				t.Errorf("export succeeded")
+			}
+			if len(res.stdout) > 0 {
+				t.Errorf("%d bytes were written to stdout", len(res.stdout))
+			}
+		})
+	}
+}
+
+func TestExportAppendCa(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		name    string
+		args    []string
+		entries []string
+		chain   []string
+		err     string
+	}{
+		{"append", nil, []string{"cert.pem", "key.pem", "server.crt", "server.key"}, []string{"server", "ica", "root"}, ""},
+		{"without key", []string{"-key=false"}, []string{"cert.pem", "server.crt"}, []string{"server", "ica", "root"}, ""},
+		{"root first", []string{"-chain-order=root-first"}, []string{"cert.pem", "key.pem", "server.crt", "server.key"}, []string{"root", "ica", "server"}, ""},
+		{"leaf only", []string{"-leaf-only"}, nil, nil, "can't be used with"},
+		{"without root", []string{"-include-root=false"}, nil, nil, "can't be used with"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := runCertshop(t, dir, nil, append(append([]string{"export", "-append-ca"}, tt.args...), "ca/ica/server")...)
+			if tt.err != "" {
+				if res.code == 0 || !strings.Contains(res.stderr, tt.err) {
+					t.Errorf("got status %d, want an error with %q:\n%s", res.code, tt.err, res.stderr)
+				}
+				return
+			} else if res.code != 0 {
+				t.Fatalf("export failed with status %d:\n%s", res.code, res.stderr)
+			}
+			entries := readTgz(t, res.stdout)
+			names := []string{}
+			for name := range entries {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if strings.Join(names, ",") != strings.Join(tt.entries, ",") {
+				t.Errorf("got entries %v, want %v", names, tt.entries)
+			}
+			chain := []string{}
+			for _, cert := range parseCertsPem(entries["cert.pem"]) {
+				chain = append(chain, cert.Subject.CommonName)
+			}
+			if strings.Join(chain, ",") != strings.Join(tt.chain, ",") {
+				t.Errorf("got chain %v in cert.pem, want %v", chain, tt.chain)
+			}
+			// the certificate file has only certificates and the key file
+			// only the key
+			if strings.Contains(string(entries["cert.pem"]), "PRIVATE KEY") {
+				t.Errorf("cert.pem contains the private key")
+			}
+			if key, ok := entries["key.pem"]; ok {
+				if block, rest := pem.Decode(key); block == nil || block.Type != "EC PRIVATE KEY" || len(bytes.TrimSpace(rest)) > 0 {
+					t.Errorf("key.pem isn't just the private key:\n%s", key)
+				}
+			}
+		})
+	}
+}
+
+func TestExportKeyOnly(t *testing.T) {
+	dir := newTree(t)
+	// a key whose certificate hasn't been issued yet
+	key := parseKey(filepath.Join(dir, "ca/ica/server"))
+	if err := os.MkdirAll(filepath.Join(dir, "handoff"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "handoff/handoff.key"), []byte(readFile(filepath.Join(dir, "ca/ica/server/server.key"))), privatePerms); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		args     []string
+		pemType  string
+		password string
+	}{
+		{"sec1", nil, "EC PRIVATE KEY", ""},
+		{"pkcs8", []string{"-key-encoding=pkcs8"}, "PRIVATE KEY", ""},
+		{"openssh", []string{"-key-encoding=openssh"}, "OPENSSH PRIVATE KEY", ""},
+		{"encrypted openssh", []string{"-key-encoding=openssh", "-pass-out=secret"}, "OPENSSH PRIVATE KEY", "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"export", "-crt=false", "-ca=false"}, tt.args...)
+			entries := readTgz(t, certshop(t, dir, append(args, "handoff")...))
+			// key.pem is a link to the key
+			if _, ok := entries["key.pem"]; len(entries) != 2 || !ok {
+				t.Errorf("got %d entries, want only the key", len(entries))
+			}
+			data, ok := entries["handoff.key"]
+			if !ok {
+				t.Fatal("handoff.key isn't in the archive")
+			}
+			if block, _ := pem.Decode(data); block == nil || block.Type != tt.pemType {
+				t.Fatalf("the exported key isn't a %s pem block", tt.pemType)
+			}
+			if !parseKeyData("handoff.key", data, tt.password).Equal(key) {
+				t.Error("the exported key doesn't read back as the original key")
+			}
+		})
+	}
+
+	// the certificate is still needed when anything else is exported
+	if res := runCertshop(t, dir, nil, "export", "-ca=false", "handoff"); res.code == 0 {
+		t.Error("the certificate of handoff was exported without a certificate file")
+	}
+	if res := runCertshop(t, t.TempDir(), nil, "export", "-crt=false", "-ca=false", "handoff"); res.code == 0 {
+		t.Error("a missing key was exported")
+	}
+	if res := runCertshop(t, dir, nil, "export", "-key=false", "-crt=false", "-ca=false", "ca/ica/server"); res.code == 0 || len(res.stdout) > 0 || !strings.Contains(res.stderr, "Nothing to export") {
+		t.Errorf("export with every part disabled didn't fail with nothing to export: status %d\n%s", res.code, res.stderr)
+	}
+}
+
+func TestExportOwner(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		name         string
+		args         []string
+		uid, gid     int
+		uname, gname string
+	}{
+		{"default", nil, 0, 0, "", ""},
+		{"owner", []string{"-owner=1000:1001"}, 1000, 1001, "", ""},
+		{"owner name", []string{"-owner-name=www-data:ssl-cert"}, 0, 0, "www-data", "ssl-cert"},
+		{"both", []string{"-owner=33:110", "-owner-name=www-data:ssl-cert"}, 33, 110, "www-data", "ssl-cert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gz, err := gzip.NewReader(bytes.NewReader(certshop(t, dir, append(append([]string{"export", "-p7b"}, tt.args...), "ca/ica/server")...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr := tar.NewReader(gz)
+			entries := 0
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				entries++
+				if header.Uid != tt.uid || header.Gid != tt.gid || header.Uname != tt.uname || header.Gname != tt.gname {
+					t.Errorf("%s is owned by %d:%d (%s:%s), want %d:%d (%s:%s)", header.Name, header.Uid, header.Gid, header.Uname, header.Gname, tt.uid, tt.gid, tt.uname, tt.gname)
+				}
+			}
+			if entries == 0 {
+				t.Error("the archive is empty")
+			}
+		})
+	}
+
+	for _, args := range [][]string{
+		{"-owner=root:root"},
+		{"-owner=1000"},
+		{"-owner=-1:0"},
+		{"-owner-name=www-data"},
+		{"-owner-name=:ssl-cert"},
+		{"-owner=0:0", "-archive-format=zip"},
+	} {
+		if res := runCertshop(t, dir, nil, append(append([]string{"export"}, args...), "ca/ica/server")...); res.code == 0 || len(res.stdout) > 0 {
+			t.Errorf("the invalid %s was accepted", strings.Join(args, " "))
+		}
+	}
+}
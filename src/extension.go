@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// addExtensionFlag adds the repeatable "-extension" flag, which also
+// accepts a comma separated list (ie. from a spec file)
+func addExtensionFlag(fs *flag.FlagSet, extensions *[]pkix.Extension) {
+	fs.Func("extension", "custom extension as oid:critical:base64 der value (repeatable)", func(value string) error {
+		for _, v := range strings.Split(value, ",") {
+			extension, err := parseExtension(v)
+			if err != nil {
+				return err
+			}
+			*extensions = append(*extensions, extension)
+		}
+		return nil
+	})
+}
+
+// parseExtension parses an "oid:critical:base64" extension where the
+// value is the base64 encoded der contents of the extension
+func parseExtension(value string) (pkix.Extension, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return pkix.Extension{}, fmt.Errorf("%s must be in the form oid:critical:base64", value)
+	}
+	oid := asn1.ObjectIdentifier{}
+	for _, arc := range strings.Split(parts[0], ".") {
+		n, err := strconv.Atoi(arc)
+		if err != nil || n < 0 {
+			return pkix.Extension{}, fmt.Errorf("invalid oid %s", parts[0])
+		}
+		oid = append(oid, n)
+	}
+	if len(oid) < 2 || oid[0] > 2 || (oid[0] < 2 && oid[1] > 39) {
+		return pkix.Extension{}, fmt.Errorf("invalid oid %s", parts[0])
+	}
+	critical, err := strconv.ParseBool(parts[1])
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("invalid critical flag %s (must be true or false)", parts[1])
+	}
+	der, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("invalid base64 value for %s: %s", parts[0], err)
+	}
+	var raw asn1.RawValue
+	if rest, err := asn1.Unmarshal(der, &raw); err != nil || len(rest) > 0 {
+		return pkix.Extension{}, fmt.Errorf("the value for %s is not a single der encoded asn.1 value", parts[0])
+	}
+	return pkix.Extension{Id: oid, Critical: critical, Value: der}, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/asn1"
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseExtension(t *testing.T) {
+	utf8 := base64.StdEncoding.EncodeToString([]byte{asn1.TagUTF8String, 2, 'h', 'i'})
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"1.3.6.1.4.1.99999.1:false:" + utf8, true},
+		{"2.999.1:true:" + utf8, true},
+		{"1.3.6.1.4.1.99999.1:false", false},
+		{"1.3.x.1:false:" + utf8, false},
+		{"1:false:" + utf8, false},
+		{"3.1:false:" + utf8, false},
+		{"1.40:false:" + utf8, false},
+		{"1.3.6.1.4.1.99999.1:maybe:" + utf8, false},
+		{"1.3.6.1.4.1.99999.1:false:not base64!", false},
+		{"1.3.6.1.4.1.99999.1:false:" + base64.StdEncoding.EncodeToString([]byte("raw")), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if _, err := parseExtension(tt.value); (err == nil) != tt.ok {
+				t.Errorf("got error %v, want ok %t", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCustomExtension(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	first := []byte{asn1.TagUTF8String, 5, 'h', 'e', 'l', 'l', 'o'}
+	second := []byte{asn1.TagInteger, 1, 42}
+	certshop(t, dir, "client", "-dn=/CN=client",
+		"-extension=1.3.6.1.4.1.99999.1:false:"+base64.StdEncoding.EncodeToString(first),
+		"-extension=1.3.6.1.4.1.99999.2:true:"+base64.StdEncoding.EncodeToString(second), "ca/client")
+	cert := parseCert(filepath.Join(dir, "ca/client"))
+	tests := []struct {
+		oid      asn1.ObjectIdentifier
+		critical bool
+		value    []byte
+	}{
+		{asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}, false, first},
+		{asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}, true, second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.oid.String(), func(t *testing.T) {
+			for _, extension := range cert.Extensions {
+				if extension.Id.Equal(tt.oid) {
+					if extension.Critical != tt.critical || string(extension.Value) != string(tt.value) {
+						t.Errorf("got critical %t value %x, want %t %x", extension.Critical, extension.Value, tt.critical, tt.value)
+					}
+					return
+				}
+			}
+			t.Error("the extension isn't in the certificate")
+		})
+	}
+}
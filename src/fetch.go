@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fetchCertificates connects to a tls server and prints the certificate
+// chain it presents in pem format, optionally saving it to a folder so
+// that the other commands (ie. verify or diff) can use it
+func fetchCertificates(args []string) {
+	fs := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	addCommonFlags(fs)
+	serverName := fs.String("servername", "", "server name sent with sni and verified (default is the host)")
+	insecure := fs.Bool("insecure", false, "fetch the chain even if it can't be verified with the system roots")
+	timeout := fs.Duration("timeout", 10*time.Second, "connection and handshake timeout")
+	out := fs.String("out", "", "folder to save the chain in (as <folder name>.crt, plus ca.pem if the chain includes a root)")
+	overwrite := fs.Bool("overwrite", false, "overwrite any existing files")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	if len(fs.Args()) != 1 {
+		usageLog.Fatalf("Invalid address %s (must be host:port)", strings.Join(fs.Args(), ","))
+	}
+	address := fs.Arg(0)
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		usageLog.Fatalf("Invalid address %s (must be host:port): %s", address, err)
+	}
+	if *serverName == "" {
+		*serverName = host
+	}
+	if *out != "" && !*overwrite {
+		checkExisting(*out)
+	} else if *out != "" {
+		confirmOverwrite(*out)
+	}
+
+	infoLog.Printf("Fetching Certificates from %s (server name %s)\n", address, *serverName)
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: *timeout}, "tcp", address,
+		&tls.Config{ServerName: *serverName, InsecureSkipVerify: *insecure})
+	if err != nil {
+		errorLog.Fatalf("Failed to fetch certificates from %s: %s", address, err)
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	if err = conn.Close(); err != nil {
+		infoLog.Printf("WARNING: failed to close connection to %s: %s\n", address, err)
+	}
+
+	chain := new(bytes.Buffer)
+	for i, cert := range certs {
+		infoLog.Printf("%d: %s (issuer %s, expires %s, %s)\n", i, formatDn(cert.Subject), formatDn(cert.Issuer),
+			cert.NotAfter.UTC().Format(time.RFC3339), publicKeyFingerprint(cert))
+		if err = pem.Encode(chain, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			errorLog.Fatalf("Failed to encode certificate: %s", err)
+		}
+	}
+	if _, err = os.Stdout.Write(chain.Bytes()); err != nil {
+		errorLog.Fatalf("Failed to write certificates: %s", err)
+	}
+
+	if *out != "" {
+		createDirectory(*out)
+		writeFile(filepath.Join(*out, filepath.Base(*out)+".crt"), chain.Bytes(), publicPerms)
+		if root := certs[len(certs)-1]; isSelfSigned(root) {
+			writeFile(filepath.Join(*out, "ca.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), publicPerms)
+		} else {
+			infoLog.Printf("The server didn't send its root certificate, so %s has no ca.pem\n", *out)
+		}
+	}
+	infoLog.Printf("Finished Fetching %d Certificates from %s\n", len(certs), address)
+}
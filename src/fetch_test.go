@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// tlsServer serves the certificate in path (with its chain) on a local
+// port until the test ends and returns the address
+func tlsServer(t *testing.T, path string) string {
+	t.Helper()
+	base := filepath.Join(path, filepath.Base(path))
+	cert, err := tls.LoadX509KeyPair(base+".crt", base+".key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// failed handshakes are reported by the client
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestFetch(t *testing.T) {
+	dir := newTree(t)
+	address := tlsServer(t, filepath.Join(dir, "ca/ica/server"))
+	tests := []struct {
+		name    string
+		args    []string
+		trusted bool
+		ok      bool
+	}{
+		{"insecure", []string{"-insecure"}, false, true},
+		{"saved", []string{"-insecure", "-out=fetched"}, false, true},
+		{"untrusted", nil, false, false},
+		{"trusted", []string{"-servername=server.example.com"}, true, true},
+		{"wrong server name", []string{"-servername=other.example.com"}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.trusted {
+				if runtime.GOOS != "linux" {
+					t.Skip("SSL_CERT_FILE only selects the trust store on linux")
+				}
+				t.Setenv("SSL_CERT_FILE", filepath.Join(dir, "ca/ca.pem"))
+			}
+			res := runCertshop(t, dir, nil, append(append([]string{"fetch"}, tt.args...), address)...)
+			if ok := res.code == 0; ok != tt.ok {
+				t.Fatalf("got success %t, want %t: %s", ok, tt.ok, res.stderr)
+			}
+			if !tt.ok {
+				return
+			}
+			chain := parseCertsPem(res.stdout)
+			if len(chain) != 3 || chain[0].Subject.CommonName != "server" || !isSelfSigned(chain[2]) {
+				t.Fatalf("got a chain of %d certificates, want the server, intermediate and root", len(chain))
+			}
+			if tt.name == "saved" {
+				if saved := parseCert(filepath.Join(dir, "fetched")); !saved.Equal(chain[0]) {
+					t.Error("the saved certificate isn't the server certificate")
+				}
+				if root := readCert(t, filepath.Join(dir, "fetched/ca.pem")); !root.Equal(chain[2]) {
+					t.Error("the saved ca.pem isn't the root")
+				}
+			}
+		})
+	}
+}
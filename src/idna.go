@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// domainToASCII converts an internationalized domain name to the
+// a-label (punycode) form required in dns subject alternative names by
+// rfc 5280; internationalized labels are lower cased but not otherwise
+// normalized (to avoid depending on golang.org/x/net/idna)
+func domainToASCII(domain string) (string, error) {
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		if !utf8.ValidString(label) {
+			return "", fmt.Errorf("invalid utf-8 in %q", domain)
+		}
+		for _, r := range label {
+			if r >= 0x80 {
+				encoded, err := punycode(strings.ToLower(label))
+				if err != nil {
+					return "", err
+				}
+				labels[i] = "xn--" + encoded
+				break
+			}
+		}
+		if len(labels[i]) > 63 {
+			return "", fmt.Errorf("label %s is longer than 63 characters", labels[i])
+		}
+	}
+	ascii := strings.Join(labels, ".")
+	if len(ascii) > 253 {
+		return "", fmt.Errorf("domain %s is longer than 253 characters", ascii)
+	}
+	return ascii, nil
+}
+
+// punycode encodes a label with the bootstring algorithm of rfc 3492
+func punycode(label string) (string, error) {
+	const base, tMin, tMax, skew, damp = 36, 1, 26, 38, 700
+	adapt := func(delta, numPoints int, first bool) int {
+		if first {
+			delta /= damp
+		} else {
+			delta /= 2
+		}
+		delta += delta / numPoints
+		k := 0
+		for delta > ((base-tMin)*tMax)/2 {
+			delta /= base - tMin
+			k += base
+		}
+		return k + (base-tMin+1)*delta/(delta+skew)
+	}
+	digit := func(d int) byte {
+		if d < 26 {
+			return byte('a' + d)
+		}
+		return byte('0' + d - 26)
+	}
+
+	runes := []rune(label)
+	output := []byte{}
+	for _, r := range runes {
+		if r < 0x80 {
+			output = append(output, byte(r))
+		}
+	}
+	basic := len(output)
+	handled := basic
+	if basic > 0 {
+		output = append(output, '-')
+	}
+	n, delta, bias := 0x80, 0, 72
+	for handled < len(runes) {
+		m := rune(0x7fffffff)
+		for _, r := range runes {
+			if int(r) >= n && r < m {
+				m = r
+			}
+		}
+		if (int(m)-n)*(handled+1) > 0x7fffffff-delta {
+			return "", fmt.Errorf("label %s is too long to encode", label)
+		}
+		delta += (int(m) - n) * (handled + 1)
+		n = int(m)
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) == n {
+				q := delta
+				for k := base; ; k += base {
+					t := k - bias
+					if t < tMin {
+						t = tMin
+					} else if t > tMax {
+						t = tMax
+					}
+					if q < t {
+						break
+					}
+					output = append(output, digit(t+(q-t)%(base-t)))
+					q = (q - t) / (base - t)
+				}
+				output = append(output, digit(q))
+				bias = adapt(delta, handled+1, handled == basic)
+				delta = 0
+				handled++
+			}
+		}
+		delta++
+		n++
+	}
+	return string(output), nil
+}
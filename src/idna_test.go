@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDomainToASCII(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"www.example.com", "www.example.com"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"Bücher.example", "xn--bcher-kva.example"},
+		{"münchen.de", "xn--mnchen-3ya.de"},
+		{"日本語.jp", "xn--wgv71a119e.jp"},
+		{"*.bücher.example", "*.xn--bcher-kva.example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			got, err := domainToASCII(tt.domain)
+			if err != nil {
+				t.Fatalf("domainToASCII failed: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if _, err := domainToASCII("bad\xffname.example"); err == nil {
+		t.Error("invalid utf-8 was accepted")
+	}
+}
+
+func TestInternationalizedSubjectAlternativeName(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	certshop(t, dir, "server", "-dn=/CN=bücher", "-san=bücher.example,www.example.com", "ca/idn")
+	cert := parseCert(filepath.Join(dir, "ca/idn"))
+	if len(cert.DNSNames) != 2 || cert.DNSNames[0] != "xn--bcher-kva.example" || cert.DNSNames[1] != "www.example.com" {
+		t.Errorf("got dns names %v", cert.DNSNames)
+	}
+	if err := cert.VerifyHostname("xn--bcher-kva.example"); err != nil {
+		t.Errorf("the certificate isn't valid for the a-label: %s", err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// inspectFile prints the fields of each certificate and certificate
+// request (csr) in a pem file or certificate folder and returns the exit
+// code, which is 1 if a csr isn't signed by its own key
+func inspectFile(args []string) int {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	addCommonFlags(fs)
+	utcOnly := fs.Bool("utc-only", false, "show dates in UTC only, without the local time and days remaining")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	if len(fs.Args()) != 1 {
+		errorLog.Fatalf("Expected a pem file or certificate path but got %s", strings.Join(fs.Args(), ","))
+	}
+	fileName := fs.Arg(0)
+	if info, err := os.Stat(fileName); err == nil && info.IsDir() {
+		fileName = filepath.Join(fileName, filepath.Base(fileName)+".crt")
+	}
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		errorLog.Fatalf("Failed to read %s: %s", fileName, err)
+	}
+	checkPem(fileName, data)
+
+	status, found := 0, 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				errorLog.Fatalf("Failed to parse certificate in %s: %s", fileName, err)
+			}
+			printCertificate(cert, *utcOnly)
+		case "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST":
+			csr, err := x509.ParseCertificateRequest(block.Bytes)
+			if err != nil {
+				errorLog.Fatalf("Failed to parse certificate request in %s: %s", fileName, err)
+			}
+			if !printCertificateRequest(csr) {
+				status = 1
+			}
+		default:
+			infoLog.Printf("Skipping %s block in %s\n", block.Type, fileName)
+			continue
+		}
+		found++
+	}
+	if found == 0 {
+		errorLog.Fatalf("No certificates or certificate requests found in %s", fileName)
+	}
+	return status
+}
+
+func printCertificate(cert *x509.Certificate, utcOnly bool) {
+	fmt.Println("Certificate:")
+	fmt.Printf("    Subject: %s\n", formatDn(cert.Subject))
+	fmt.Printf("    Issuer: %s\n", formatDn(cert.Issuer))
+	fmt.Printf("    Serial Number: %s\n", cert.SerialNumber.Text(16))
+	fmt.Printf("    Not Before: %s\n", formatValidityTime(cert.NotBefore, utcOnly))
+	fmt.Printf("    Not After: %s\n", formatValidityTime(cert.NotAfter, utcOnly))
+	if !utcOnly {
+		fmt.Printf("    Validity: %s\n", remainingValidity(cert))
+	}
+	fmt.Printf("    Subject Alternative Names: %s\n", strings.Join(subjectAlternativeNames(cert), ","))
+	fmt.Printf("    Key Usage: %s\n", strings.Join(keyUsageNames(cert.KeyUsage), ","))
+	fmt.Printf("    Extended Key Usage: %s\n", strings.Join(extKeyUsageNames(cert.ExtKeyUsage), ","))
+	fmt.Printf("    CA: %t\n", cert.IsCA)
+	fmt.Printf("    Public Key: %s %s\n", publicKeyAlgorithm(cert.PublicKey), publicKeyFingerprint(cert))
+	printOtherExtensions(cert.Extensions, oidSubjectAltName, oidKeyUsage, oidExtKeyUsage, oidBasicConstraints)
+}
+
+// printCertificateRequest prints the requested fields of a csr and
+// reports whether its self-signature is valid
+func printCertificateRequest(csr *x509.CertificateRequest) bool {
+	names := append([]string{}, csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		names = append(names, ip.String())
+	}
+	names = append(names, csr.EmailAddresses...)
+	for _, uri := range csr.URIs {
+		names = append(names, uri.String())
+	}
+	fmt.Println("Certificate Request:")
+	fmt.Printf("    Subject: %s\n", formatDn(csr.Subject))
+	fmt.Printf("    Subject Alternative Names: %s\n", strings.Join(names, ","))
+	fmt.Printf("    Public Key: %s %s\n", publicKeyAlgorithm(csr.PublicKey), spkiFingerprint(csr.RawSubjectPublicKeyInfo))
+	printOtherExtensions(csr.Extensions, oidSubjectAltName)
+	if err := csr.CheckSignature(); err != nil {
+		fmt.Printf("    Signature: INVALID (%s)\n", err)
+		return false
+	}
+	fmt.Printf("    Signature: OK (%s)\n", csr.SignatureAlgorithm)
+	return true
+}
+
+var (
+	oidKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtKeyUsage      = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+)
+
+// extensionNames names the common extensions which inspect doesn't show
+// as fields
+var extensionNames = map[string]string{
+	"2.5.29.9":                "subjectDirectoryAttributes",
+	"2.5.29.14":               "subjectKeyIdentifier",
+	"2.5.29.30":               "nameConstraints",
+	"2.5.29.31":               "cRLDistributionPoints",
+	"2.5.29.32":               "certificatePolicies",
+	"2.5.29.35":               "authorityKeyIdentifier",
+	"1.3.6.1.5.5.7.1.1":       "authorityInfoAccess",
+	"1.3.6.1.4.1.11129.2.4.2": "signedCertificateTimestampList",
+	"1.3.6.1.4.1.11129.2.4.3": "precertificatePoison",
+}
+
+// printOtherExtensions prints every extension except the ones shown as
+// fields, in the "oid:critical:base64" form of the "-extension" flag, so
+// that inspect never hides an extension certshop doesn't model
+func printOtherExtensions(extensions []pkix.Extension, shown ...asn1.ObjectIdentifier) {
+	others := []string{}
+	for _, extension := range extensions {
+		isShown := false
+		for _, oid := range shown {
+			isShown = isShown || extension.Id.Equal(oid)
+		}
+		if isShown {
+			continue
+		}
+		other := fmt.Sprintf("%s:%t:%s", extension.Id, extension.Critical, base64.StdEncoding.EncodeToString(extension.Value))
+		if name, ok := extensionNames[extension.Id.String()]; ok {
+			other += " (" + name + ")"
+		}
+		others = append(others, other)
+	}
+	if len(others) == 0 {
+		fmt.Println("    Other Extensions: none")
+		return
+	}
+	fmt.Println("    Other Extensions:")
+	for _, other := range others {
+		fmt.Printf("        %s\n", other)
+	}
+}
+
+// publicKeyAlgorithm names the key type and size (ie. "ECDSA P-384")
+func publicKeyAlgorithm(key interface{}) string {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return "unknown"
+}
+
+// formatValidityTime shows the time in UTC followed by the local time,
+// since operators often misread UTC offsets
+func formatValidityTime(t time.Time, utcOnly bool) string {
+	if utcOnly {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%s (%s local)", t.UTC().Format(time.RFC3339), t.Local().Format("2006-01-02 15:04:05 MST"))
+}
+
+// remainingValidity describes the validity period relative to runTime
+func remainingValidity(cert *x509.Certificate) string {
+	days := func(d time.Duration) int {
+		return int(d.Hours() / 24)
+	}
+	if runTime.Before(cert.NotBefore) {
+		return fmt.Sprintf("not valid yet (starts in %d days)", days(cert.NotBefore.Sub(runTime)))
+	} else if runTime.After(cert.NotAfter) {
+		return fmt.Sprintf("expired %d days ago", days(runTime.Sub(cert.NotAfter)))
+	}
+	return fmt.Sprintf("expires in %d days", days(cert.NotAfter.Sub(runTime)))
+}
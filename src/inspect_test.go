@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInspectCertificateRequest(t *testing.T) {
+	dir := newTree(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: "request", Organization: []string{"Example"}},
+		DNSNames:       []string{"www.example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.2")},
+		EmailAddresses: []string{"admin@example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, der...)
+	tampered[len(tampered)-1] ^= 0xff
+	cert, err := os.ReadFile(filepath.Join(dir, "ca/ica/server/server.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+
+	tests := []struct {
+		name   string
+		data   []byte
+		code   int
+		output []string
+	}{
+		{"csr", csr, 0, []string{"Certificate Request:", "Subject: /CN=request/O=Example",
+			"Subject Alternative Names: www.example.com,10.0.0.2,admin@example.com", "Public Key: ECDSA P-256", "Signature: OK"}},
+		{"new csr block", pem.EncodeToMemory(&pem.Block{Type: "NEW CERTIFICATE REQUEST", Bytes: der}), 0, []string{"Certificate Request:", "Signature: OK"}},
+		{"tampered signature", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: tampered}), 1, []string{"Signature: INVALID"}},
+		{"certificate and csr", append(append([]byte{}, cert...), csr...), 0, []string{"Certificate:", "Subject: /CN=server", "Certificate Request:", "Subject: /CN=request/O=Example"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "request.pem")
+			if err := os.WriteFile(fileName, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			res := runCertshop(t, dir, nil, "inspect", fileName)
+			if res.code != tt.code {
+				t.Errorf("got status %d, want %d: %s", res.code, tt.code, res.stderr)
+			}
+			for _, want := range tt.output {
+				if !strings.Contains(string(res.stdout), want) {
+					t.Errorf("%q isn't in the output:\n%s", want, res.stdout)
+				}
+			}
+		})
+	}
+}
+
+func TestInspectValidityTimes(t *testing.T) {
+	dir := newTree(t)
+	cert := readCert(t, filepath.Join(dir, "ca/ica/server/server.crt"))
+	// India has no daylight saving time, so the offset is always +05:30
+	t.Setenv("TZ", "Asia/Kolkata")
+	india, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip("no time zone database: ", err)
+	}
+	utc := "Not After: " + cert.NotAfter.UTC().Format(time.RFC3339)
+	local := "(" + cert.NotAfter.In(india).Format("2006-01-02 15:04:05") + " IST local)"
+	tests := []struct {
+		name   string
+		args   []string
+		want   []string
+		absent []string
+	}{
+		{"local", nil, []string{utc + " " + local, "Validity: expires in 369 days"}, nil},
+		{"utc only", []string{"-utc-only"}, []string{utc + "\n"}, []string{"local)", "Validity:"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(append([]string{"inspect"}, tt.args...), "ca/ica/server/server.crt")
+			out := string(certshop(t, dir, args...))
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("%q is missing:\n%s", want, out)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(out, absent) {
+					t.Errorf("%q is shown:\n%s", absent, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRemainingValidity(t *testing.T) {
+	defer func(saved time.Time) { runTime = saved }(runTime)
+	runTime = time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		notBefore time.Time
+		notAfter  time.Time
+		want      string
+	}{
+		{"valid", runTime.AddDate(0, 0, -1), runTime.AddDate(0, 0, 30), "expires in 30 days"},
+		{"last day", runTime.AddDate(0, 0, -1), runTime.Add(time.Hour), "expires in 0 days"},
+		{"expired", runTime.AddDate(-1, 0, 0), runTime.AddDate(0, 0, -3), "expired 3 days ago"},
+		{"not valid yet", runTime.AddDate(0, 0, 2), runTime.AddDate(1, 0, 0), "not valid yet (starts in 2 days)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := remainingValidity(&x509.Certificate{NotBefore: tt.notBefore, NotAfter: tt.notAfter}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// otherExtensions returns the lines of the "Other Extensions" sections of
+// the inspect output
+func otherExtensions(output []byte) []string {
+	others := []string{}
+	inSection := false
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "    Other Extensions:") {
+			inSection = true
+			if strings.HasSuffix(line, "none") {
+				others = append(others, "none")
+			}
+		} else if inSection && strings.HasPrefix(line, "        ") {
+			others = append(others, strings.TrimSpace(line))
+		} else {
+			inSection = false
+		}
+	}
+	return others
+}
+
+func TestInspectOtherExtensions(t *testing.T) {
+	dir := newTree(t)
+	certshop(t, dir, "server", "-san=web.example.com", "-extension=1.3.6.1.4.1.99999.1:false:BQA=,1.3.6.1.4.1.99999.2:true:AQH/", "ca/ica/web")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr := func(extensions ...pkix.Extension) []byte {
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:         pkix.Name{CommonName: "request"},
+			DNSNames:        []string{"www.example.com"},
+			ExtraExtensions: extensions,
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	}
+	readPem := func(fileName string) []byte {
+		data, err := os.ReadFile(filepath.Join(dir, fileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []string
+		notWant []string
+	}{
+		{"custom extensions", readPem("ca/ica/web/web.crt"),
+			[]string{"1.3.6.1.4.1.99999.1:false:BQA=", "1.3.6.1.4.1.99999.2:true:AQH/", "(authorityKeyIdentifier)"},
+			[]string{"2.5.29.17:", "2.5.29.15:", "2.5.29.37:", "2.5.29.19:"}},
+		{"csr with an extension", csr(pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 3}, Value: []byte{0x05, 0x00}}),
+			[]string{"1.3.6.1.4.1.99999.3:false:BQA="}, []string{"2.5.29.17:"}},
+		{"csr without extensions", csr(), []string{"none"}, []string{"2.5.29.17:"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "inspect.pem")
+			if err := os.WriteFile(fileName, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			others := strings.Join(otherExtensions(certshop(t, dir, "inspect", fileName)), "\n")
+			for _, want := range tt.want {
+				if !strings.Contains(others, want) {
+					t.Errorf("%q isn't in the other extensions:\n%s", want, others)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(others, notWant) {
+					t.Errorf("%q is shown as a field but is also in the other extensions:\n%s", notWant, others)
+				}
+			}
+		})
+	}
+}
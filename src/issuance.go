@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// issuancePolicyFile is saved in a ca folder to restrict when the ca
+// may sign certificates
+const issuancePolicyFile = "issuance-policy.json"
+
+// issuancePolicy limits issuance to before a cutoff date, to some days
+// of the week and to a daily time window (all in UTC), such as:
+//
+//	{"not-after": "2027-01-01", "days": ["Sat", "Sun"], "window": "22:00-02:00"}
+//
+// a window that ends before it starts crosses midnight, and the days
+// are those on which the window starts
+type issuancePolicy struct {
+	NotAfter string   `json:"not-after,omitempty"`
+	Days     []string `json:"days,omitempty"`
+	Window   string   `json:"window,omitempty"`
+}
+
+// validate returns an error if a field of the policy can't be parsed
+func (p issuancePolicy) validate() error {
+	if p.NotAfter != "" {
+		if _, err := parseCutoff(p.NotAfter); err != nil {
+			return err
+		}
+	}
+	if p.Window != "" {
+		if _, _, err := parseWindow(p.Window); err != nil {
+			return err
+		}
+	}
+	for _, name := range p.Days {
+		if _, err := parseWeekday(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check returns an error describing why t is outside the policy (or
+// why the policy is invalid)
+func (p issuancePolicy) check(t time.Time) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	t = t.UTC()
+	if p.NotAfter != "" {
+		cutoff, _ := parseCutoff(p.NotAfter)
+		if !t.Before(cutoff) {
+			return fmt.Errorf("issuance ended at %s", cutoff.Format(time.RFC3339))
+		}
+	}
+	start, end := 0, 24*60
+	if p.Window != "" {
+		start, end, _ = parseWindow(p.Window)
+	}
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	inWindow := minute >= start && minute < end
+	if start > end {
+		// the window crosses midnight so the early part belongs to the
+		// previous day
+		inWindow = minute >= start || minute < end
+		if minute < end {
+			day = (day + 6) % 7
+		}
+	}
+	if !inWindow {
+		return fmt.Errorf("issuance is only allowed from %s UTC", p.Window)
+	}
+	if len(p.Days) > 0 {
+		allowed := false
+		for _, name := range p.Days {
+			d, _ := parseWeekday(name)
+			allowed = allowed || d == day
+		}
+		if !allowed {
+			return fmt.Errorf("issuance is only allowed on %s (UTC)", strings.Join(p.Days, ","))
+		}
+	}
+	return nil
+}
+
+func parseCutoff(value string) (time.Time, error) {
+	if cutoff, err := time.Parse(time.RFC3339, value); err == nil {
+		return cutoff, nil
+	}
+	cutoff, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cutoff %s (must be a date such as 2027-01-01 or an RFC 3339 time)", value)
+	}
+	return cutoff, nil
+}
+
+// parseWindow returns the start and end of a "15:04-15:04" window in
+// minutes after midnight
+func parseWindow(window string) (int, int, error) {
+	parts := strings.Split(window, "-")
+	if len(parts) == 2 {
+		start, err1 := time.Parse("15:04", strings.TrimSpace(parts[0]))
+		end, err2 := time.Parse("15:04", strings.TrimSpace(parts[1]))
+		if err1 == nil && err2 == nil && start != end {
+			return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid window %s (must be a time range such as 22:00-02:00)", window)
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(name, d.String()) || strings.EqualFold(name, d.String()[:3]) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day %s (must be a day of the week such as Mon)", name)
+}
+
+// checkIssuancePolicy fails if the ca folder has an issuance policy
+// which doesn't allow signing at runTime
+func checkIssuancePolicy(ca string) {
+	if info, err := os.Stat(ca); err != nil || !info.IsDir() {
+		return
+	}
+	fileName := filepath.Join(ca, issuancePolicyFile)
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		errorLog.Fatalf("Failed to read issuance policy %s: %s", fileName, err)
+	}
+	policy := issuancePolicy{}
+	if err = json.Unmarshal(data, &policy); err != nil {
+		errorLog.Fatalf("Failed to parse issuance policy %s: %s", fileName, err)
+	}
+	if err = policy.check(runTime); err != nil {
+		errorLog.Fatalf("Certificate Authority %s can't sign at %s: %s", ca, runTime.Format(time.RFC3339), err)
+	}
+}
+
+// saveIssuancePolicy writes the issuance policy of a new ca, or does
+// nothing if no restrictions were given
+func saveIssuancePolicy(path string, policy issuancePolicy) {
+	if policy.NotAfter == "" && policy.Window == "" && len(policy.Days) == 0 {
+		return
+	}
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		errorLog.Fatalf("Failed to marshal issuance policy for %s: %s", path, err)
+	}
+	writeFile(filepath.Join(path, issuancePolicyFile), append(data, '\n'), publicPerms)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssuancePolicy(t *testing.T) {
+	// 2026-10-17 is a Saturday
+	at := func(value string) time.Time {
+		t.Helper()
+		ts, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	tests := []struct {
+		name    string
+		policy  issuancePolicy
+		time    string
+		problem string
+	}{
+		{"no policy", issuancePolicy{}, "2026-10-17T12:00:00Z", ""},
+		{"before cutoff", issuancePolicy{NotAfter: "2027-01-01"}, "2026-12-31T23:59:00Z", ""},
+		{"after cutoff", issuancePolicy{NotAfter: "2027-01-01"}, "2027-01-01T00:00:00Z", "issuance ended"},
+		{"inside window", issuancePolicy{Window: "09:00-17:00"}, "2026-10-17T09:00:00Z", ""},
+		{"outside window", issuancePolicy{Window: "09:00-17:00"}, "2026-10-17T17:00:00Z", "only allowed from 09:00-17:00"},
+		{"window in another zone", issuancePolicy{Window: "09:00-17:00"}, "2026-10-17T08:00:00-02:00", ""},
+		{"allowed day", issuancePolicy{Days: []string{"Sat", "Sun"}}, "2026-10-17T12:00:00Z", ""},
+		{"other day", issuancePolicy{Days: []string{"Sat", "Sun"}}, "2026-10-19T12:00:00Z", "only allowed on Sat,Sun"},
+		{"overnight window before midnight", issuancePolicy{Days: []string{"Sat"}, Window: "22:00-02:00"}, "2026-10-17T23:00:00Z", ""},
+		{"overnight window after midnight", issuancePolicy{Days: []string{"Sat"}, Window: "22:00-02:00"}, "2026-10-18T01:00:00Z", ""},
+		{"overnight window of another day", issuancePolicy{Days: []string{"Sat"}, Window: "22:00-02:00"}, "2026-10-17T01:00:00Z", "only allowed on Sat"},
+		{"invalid window", issuancePolicy{Window: "22:00"}, "2026-10-17T12:00:00Z", "invalid window"},
+		{"invalid day", issuancePolicy{Days: []string{"Someday"}}, "2026-10-17T12:00:00Z", "invalid day"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.check(at(tt.time))
+			if tt.problem == "" && err != nil {
+				t.Errorf("issuance at %s was refused: %s", tt.time, err)
+			} else if tt.problem != "" && (err == nil || !strings.Contains(err.Error(), tt.problem)) {
+				t.Errorf("got %v at %s, want an error reporting %q", err, tt.time, tt.problem)
+			}
+		})
+	}
+}
+
+func TestIssuancePolicyBlocksSigning(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name  string
+		until string
+		ok    bool
+	}{
+		{"before cutoff", runTime.AddDate(1, 0, 0).Format("2006-01-02"), true},
+		{"after cutoff", runTime.AddDate(0, 0, -1).Format("2006-01-02"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ca := strings.ReplaceAll(tt.name, " ", "-")
+			certshop(t, dir, "ca", "-dn=/CN=root", "-issue-until="+tt.until, ca)
+			res := runCertshop(t, dir, nil, "server", "-dn=/CN=server", ca+"/server")
+			if (res.code == 0) != tt.ok {
+				t.Errorf("got status %d signing with -issue-until=%s: %s", res.code, tt.until, res.stderr)
+			}
+			if !tt.ok && !strings.Contains(res.stderr, "issuance ended") {
+				t.Errorf("the failure doesn't report the issuance policy: %s", res.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// knownCurves are the curve names accepted by "-allowed-curves"
+var knownCurves = []string{"P-224", "P-256", "P-384", "P-521", "Ed25519"}
+
+// minRSABits and allowedCurves are the key strength policy for keys
+// certified but not generated by certshop (set by "-min-rsa-bits" and
+// "-allowed-curves")
+var minRSABits int
+var allowedCurves []string
+
+// addKeyPolicyFlags adds the "-min-rsa-bits" and "-allowed-curves" flags
+// to commands which certify an existing key
+func addKeyPolicyFlags(fs *flag.FlagSet) {
+	fs.IntVar(&minRSABits, "min-rsa-bits", 2048, "reject rsa keys smaller than this many bits")
+	allowedCurves = []string{"P-256", "P-384", "P-521", "Ed25519"}
+	fs.Func("allowed-curves", "comma separated curves which ecdsa and eddsa keys may use (default P-256,P-384,P-521,Ed25519)", func(curves string) error {
+		allowedCurves = []string{}
+		for _, curve := range strings.Split(curves, ",") {
+			curve = strings.TrimSpace(curve)
+			if !containsString(knownCurves, curve) {
+				return fmt.Errorf("unknown curve %q (must be %s)", curve, strings.Join(knownCurves, ", "))
+			}
+			allowedCurves = append(allowedCurves, curve)
+		}
+		return nil
+	})
+}
+
+// checkKeyPolicy returns an error if the public key is weaker than the
+// key strength policy, so that a ca doesn't certify weak keys submitted
+// by its users; dsa and other key types are always rejected
+func checkKeyPolicy(publicKey crypto.PublicKey) error {
+	curve := ""
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if bits := key.N.BitLen(); bits < minRSABits {
+			return fmt.Errorf("the %d bit rsa key is smaller than the minimum of %d bits (\"-min-rsa-bits\")", bits, minRSABits)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		curve = key.Curve.Params().Name
+	case ed25519.PublicKey:
+		curve = "Ed25519"
+	default:
+		return fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+	if !containsString(allowedCurves, curve) {
+		return fmt.Errorf("the %s curve isn't allowed (\"-allowed-curves\" is %s)", curve, strings.Join(allowedCurves, ","))
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
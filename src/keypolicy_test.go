@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckKeyPolicy(t *testing.T) {
+	rsaKey := func(bits int) crypto.PublicKey {
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key.Public()
+	}
+	ecKey := func(curve elliptic.Curve) crypto.PublicKey {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key.Public()
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		args []string
+		key  crypto.PublicKey
+		err  string
+	}{
+		{"rsa 1024", nil, rsaKey(1024), "the 1024 bit rsa key is smaller than the minimum of 2048 bits"},
+		{"rsa 2048", nil, rsaKey(2048), ""},
+		{"rsa 2048 below minimum", []string{"-min-rsa-bits=3072"}, rsaKey(2048), "smaller than the minimum of 3072 bits"},
+		{"rsa 1024 allowed", []string{"-min-rsa-bits=1024"}, rsaKey(1024), ""},
+		{"P-224", nil, ecKey(elliptic.P224()), "the P-224 curve isn't allowed"},
+		{"P-256", nil, ecKey(elliptic.P256()), ""},
+		{"P-384", nil, ecKey(elliptic.P384()), ""},
+		{"P-256 not allowed", []string{"-allowed-curves=P-384,P-521"}, ecKey(elliptic.P256()), "(\"-allowed-curves\" is P-384,P-521)"},
+		{"P-224 allowed", []string{"-allowed-curves=P-224"}, ecKey(elliptic.P224()), ""},
+		{"Ed25519", nil, edKey, ""},
+		{"Ed25519 not allowed", []string{"-allowed-curves=P-384"}, edKey, "the Ed25519 curve isn't allowed"},
+		{"unsupported", nil, "key", "unsupported public key type string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			addKeyPolicyFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			err := checkKeyPolicy(tt.key)
+			if tt.err == "" && err != nil {
+				t.Errorf("the key was rejected: %s", err)
+			} else if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("got %v, want an error with %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAllowedCurvesInvalid(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(new(strings.Builder))
+	addKeyPolicyFlags(fs)
+	if err := fs.Parse([]string{"-allowed-curves=P-384,secp256k1"}); err == nil || !strings.Contains(err.Error(), "unknown curve \"secp256k1\"") {
+		t.Errorf("got %v, want an unknown curve error", err)
+	}
+}
+
+func TestKeyInPolicy(t *testing.T) {
+	dir := newTree(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "p256.key")
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"allowed", nil, ""},
+		{"disallowed curve", []string{"-allowed-curves=P-384"}, "Refusing to certify the \"-key-in\" key"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := "web" + strconv.Itoa(i)
+			path := filepath.Join("ca/ica", name)
+			args := append([]string{"server", "-key-in=" + keyFile, "-san=web.example.com"}, tt.args...)
+			res := runCertshop(t, dir, nil, append(args, path)...)
+			if tt.err == "" {
+				if res.code != 0 {
+					t.Fatalf("the key was rejected with status %d:\n%s", res.code, res.stderr)
+				}
+				if cert := readCert(t, filepath.Join(dir, path, name+".crt")); !publicKeysEqual(cert.PublicKey, key.Public()) {
+					t.Errorf("the certificate isn't for the \"-key-in\" key")
+				}
+			} else {
+				if res.code == 0 || !strings.Contains(res.stderr, tt.err) {
+					t.Errorf("got status %d, want an error with %q:\n%s", res.code, tt.err, res.stderr)
+				}
+				if _, err := os.Stat(filepath.Join(dir, path)); !os.IsNotExist(err) {
+					t.Errorf("%s was created", path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+//go:build kms
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// kmsClient is the part of the aws kms api used for signing (implemented
+// by *kms.Client)
+type kmsClient interface {
+	GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+	Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+}
+
+// newKMSClient creates a kms client which takes credentials and the
+// region from the usual aws environment variables and config files (a
+// variable so that tests can replace it)
+var newKMSClient = func() (kmsClient, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the aws configuration: %s", err)
+	}
+	return kms.NewFromConfig(cfg), nil
+}
+
+// newKMSCASigner returns the signer for the aws kms key keyID, for
+// caSigner
+func newKMSCASigner(keyID string) (crypto.Signer, error) {
+	client, err := newKMSClient()
+	if err != nil {
+		return nil, err
+	}
+	return newKMSSigner(client, keyID)
+}
+
+// kmsSigner signs with an aws kms asymmetric key, so that the ca private
+// key never leaves kms
+type kmsSigner struct {
+	client kmsClient
+	keyID  string
+	public crypto.PublicKey
+}
+
+func newKMSSigner(client kmsClient, keyID string) (*kmsSigner, error) {
+	out, err := client.GetPublicKey(context.Background(), &kms.GetPublicKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		return nil, err
+	}
+	public, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %s", err)
+	}
+	return &kmsSigner{client: client, keyID: keyID, public: public}, nil
+}
+
+func (k *kmsSigner) Public() crypto.PublicKey {
+	return k.public
+}
+
+// Sign asks kms to sign the digest with the algorithm matching the key
+// type and the hash chosen by x509.CreateCertificate
+func (k *kmsSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hashes := map[crypto.Hash]string{crypto.SHA256: "SHA_256", crypto.SHA384: "SHA_384", crypto.SHA512: "SHA_512"}
+	hash, ok := hashes[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash %s for kms signing", opts.HashFunc())
+	}
+	var algorithm string
+	switch k.public.(type) {
+	case *ecdsa.PublicKey:
+		algorithm = "ECDSA_" + hash
+	case *rsa.PublicKey:
+		if _, pss := opts.(*rsa.PSSOptions); pss {
+			algorithm = "RSASSA_PSS_" + hash
+		} else {
+			algorithm = "RSASSA_PKCS1_V1_5_" + hash
+		}
+	default:
+		return nil, fmt.Errorf("unsupported kms key type %T", k.public)
+	}
+	infoLog.Printf("Signing with kms key %s (%s)\n", k.keyID, algorithm)
+	out, err := k.client.Sign(context.Background(), &kms.SignInput{
+		KeyId:            aws.String(k.keyID),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: types.SigningAlgorithmSpec(algorithm),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Signature, nil
+}
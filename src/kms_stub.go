@@ -0,0 +1,14 @@
+//go:build !kms
+
+package main
+
+import (
+	"crypto"
+	"errors"
+)
+
+// newKMSCASigner fails because the aws sdk is only linked into certshop
+// when it is built with "-tags kms"
+func newKMSCASigner(keyID string) (crypto.Signer, error) {
+	return nil, errors.New("certshop was built without kms support (rebuild it with \"go build -tags kms\")")
+}
@@ -0,0 +1,16 @@
+//go:build !kms
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKMSNotBuiltIn(t *testing.T) {
+	dir := newTree(t)
+	res := runCertshop(t, dir, nil, "client", "-dn=/CN=kms", "-kms-key-arn=arn:aws:kms:us-east-1:111122223333:key/test", "ca/ica/kms")
+	if res.code == 0 || !strings.Contains(res.stderr, "built without kms support") {
+		t.Errorf("got status %d, want an error saying certshop was built without kms support:\n%s", res.code, res.stderr)
+	}
+}
@@ -0,0 +1,143 @@
+//go:build kms
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// fakeKMS is a kmsClient holding a single key in memory, which records
+// the signing algorithms requested
+type fakeKMS struct {
+	keyID      string
+	key        crypto.Signer
+	algorithms []types.SigningAlgorithmSpec
+}
+
+func (f *fakeKMS) GetPublicKey(_ context.Context, params *kms.GetPublicKeyInput, _ ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+	if aws.ToString(params.KeyId) != f.keyID {
+		return nil, errors.New("NotFoundException")
+	}
+	der, err := x509.MarshalPKIXPublicKey(f.key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GetPublicKeyOutput{KeyId: params.KeyId, PublicKey: der}, nil
+}
+
+func (f *fakeKMS) Sign(_ context.Context, params *kms.SignInput, _ ...func(*kms.Options)) (*kms.SignOutput, error) {
+	if aws.ToString(params.KeyId) != f.keyID {
+		return nil, errors.New("NotFoundException")
+	} else if params.MessageType != types.MessageTypeDigest {
+		return nil, errors.New("the message isn't a digest")
+	}
+	f.algorithms = append(f.algorithms, params.SigningAlgorithm)
+	options := map[types.SigningAlgorithmSpec]crypto.SignerOpts{
+		types.SigningAlgorithmSpecEcdsaSha384:          crypto.SHA384,
+		types.SigningAlgorithmSpecRsassaPkcs1V15Sha256: crypto.SHA256,
+		types.SigningAlgorithmSpecRsassaPssSha512:      &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA512},
+	}
+	opts, ok := options[params.SigningAlgorithm]
+	if !ok {
+		return nil, errors.New("unexpected signing algorithm " + string(params.SigningAlgorithm))
+	}
+	signature, err := f.key.Sign(rand.Reader, params.Message, opts)
+	return &kms.SignOutput{KeyId: params.KeyId, Signature: signature, SigningAlgorithm: params.SigningAlgorithm}, err
+}
+
+func TestKMSSigner(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest256, digest384, digest512 := sha256.Sum256([]byte("tbs")), sha512.Sum384([]byte("tbs")), sha512.Sum512([]byte("tbs"))
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		digest    []byte
+		opts      crypto.SignerOpts
+		algorithm types.SigningAlgorithmSpec
+		verify    func(signature []byte) bool
+	}{
+		{"ecdsa", ecKey, digest384[:], crypto.SHA384, types.SigningAlgorithmSpecEcdsaSha384, func(signature []byte) bool {
+			return ecdsa.VerifyASN1(&ecKey.PublicKey, digest384[:], signature)
+		}},
+		{"rsa pkcs1", rsaKey, digest256[:], crypto.SHA256, types.SigningAlgorithmSpecRsassaPkcs1V15Sha256, func(signature []byte) bool {
+			return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest256[:], signature) == nil
+		}},
+		{"rsa pss", rsaKey, digest512[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA512}, types.SigningAlgorithmSpecRsassaPssSha512, func(signature []byte) bool {
+			return rsa.VerifyPSS(&rsaKey.PublicKey, crypto.SHA512, digest512[:], signature, nil) == nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeKMS{keyID: "alias/ca", key: tt.key}
+			signer, err := newKMSSigner(client, "alias/ca")
+			if err != nil {
+				t.Fatalf("newKMSSigner failed: %s", err)
+			}
+			if !publicKeysEqual(signer.Public(), tt.key.Public()) {
+				t.Error("the signer has a different public key")
+			}
+			signature, err := signer.Sign(rand.Reader, tt.digest, tt.opts)
+			if err != nil {
+				t.Fatalf("Sign failed: %s", err)
+			}
+			if len(client.algorithms) != 1 || client.algorithms[0] != tt.algorithm {
+				t.Errorf("kms was asked for %v, want %s", client.algorithms, tt.algorithm)
+			}
+			if !tt.verify(signature) {
+				t.Error("the signature doesn't verify")
+			}
+		})
+	}
+
+	if _, err := newKMSSigner(&fakeKMS{keyID: "alias/ca", key: ecKey}, "alias/other"); err == nil {
+		t.Error("newKMSSigner succeeded for an unknown key")
+	}
+	signer, err := newKMSSigner(&fakeKMS{keyID: "alias/ca", key: ecKey}, "alias/ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = signer.Sign(rand.Reader, digest256[:], crypto.SHA1); err == nil {
+		t.Error("Sign accepted sha1")
+	}
+}
+
+func TestKMSSignedCertificate(t *testing.T) {
+	dir := newTree(t)
+	t.Chdir(dir)
+	client := &fakeKMS{keyID: "arn:aws:kms:us-east-1:111122223333:key/test", key: parseKey("ca/ica")}
+	newClient := newKMSClient
+	newKMSClient = func() (kmsClient, error) { return client, nil }
+	t.Cleanup(func() {
+		newKMSClient = newClient
+		delete(signerCache, "ca/ica\x00"+client.keyID)
+	})
+
+	createCommands["client"]([]string{"-dn=/CN=kms", "-kms-key-arn=" + client.keyID, "ca/ica/kms"})
+	if len(client.algorithms) != 1 {
+		t.Fatalf("kms signed %d times, want 1", len(client.algorithms))
+	}
+	if err := parseCert("ca/ica/kms").CheckSignatureFrom(parseCert("ca/ica")); err != nil {
+		t.Errorf("the certificate isn't signed by the ca: %s", err)
+	}
+}
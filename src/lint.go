@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// weakSignatureAlgorithms are signature algorithms with broken hashes
+var weakSignatureAlgorithms = []x509.SignatureAlgorithm{
+	x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1,
+}
+
+// lintTree reports security problems with the certificates and keys at
+// or below the path and returns the exit code, which follows the
+// nagios convention of the expiring command (the worst severity found)
+func lintTree(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	addCommonFlags(fs)
+	addKeyPolicyFlags(fs)
+	warnDays := fs.Int("warn-days", 30, "warn when a certificate expires within this many days")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	path := "ca"
+	if len(fs.Args()) > 1 {
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+	} else if len(fs.Args()) == 1 {
+		path = fs.Arg(0)
+	}
+	infoLog.Printf("Linting %s", path)
+	if runtime.GOOS == "windows" {
+		infoLog.Printf("WARNING: file permissions aren't checked on windows\n")
+	}
+
+	status, found := expiringOK, 0
+	report := func(severity int, path string, format string, args ...interface{}) {
+		label := "WARNING"
+		if severity == expiringCritical {
+			label = "CRITICAL"
+		}
+		fmt.Printf("%s: %s: %s\n", label, path, fmt.Sprintf(format, args...))
+		if severity > status {
+			status = severity
+		}
+		found++
+	}
+	walkCertificates(path, func(path string, cert *x509.Certificate) {
+		keyFile := filepath.Join(path, filepath.Base(path)+".key")
+		if info, err := os.Stat(keyFile); err == nil {
+			if mode := info.Mode().Perm(); runtime.GOOS != "windows" && mode&^privatePerms != 0 {
+				severity := expiringWarning
+				if mode&0044 != 0 {
+					severity = expiringCritical
+				}
+				report(severity, path, "private key %s has permissions %04o which are more permissive than %04o", keyFile, mode, privatePerms)
+			}
+			if cert.IsCA {
+				if !isEncryptedOpenSSHKey([]byte(readFile(keyFile))) {
+					report(expiringWarning, path, "ca private key %s isn't encrypted (encrypt it with \"convert -out-format=openssh -pass-out\" or move it offline)", keyFile)
+				}
+			}
+		}
+		if err := checkKeyPolicy(cert.PublicKey); err != nil {
+			report(expiringCritical, path, "weak public key: %s", err)
+		}
+		for _, algorithm := range weakSignatureAlgorithms {
+			if cert.SignatureAlgorithm != algorithm {
+				continue
+			}
+			// the signature of a self-signed root isn't relied on
+			if isSelfSigned(cert) {
+				report(expiringWarning, path, "self-signed with the weak %s signature algorithm", algorithm)
+			} else {
+				report(expiringCritical, path, "signed with the weak %s signature algorithm", algorithm)
+			}
+		}
+		days := int(cert.NotAfter.Sub(runTime).Hours() / 24)
+		switch expiringStatus(cert, *warnDays, 0) {
+		case expiringCritical:
+			report(expiringCritical, path, "expired %s (%d days ago)", cert.NotAfter.UTC().Format(time.RFC3339), -days)
+		case expiringWarning:
+			report(expiringWarning, path, "expires %s (%d days)", cert.NotAfter.UTC().Format(time.RFC3339), days)
+		}
+	})
+	if found == 0 {
+		fmt.Printf("OK: no problems found in %s\n", path)
+	}
+	return status
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyMode os.FileMode
+		args    []string
+		code    int
+		output  string
+	}{
+		{"clean", privatePerms, []string{"ca/ica/server"}, expiringOK, "OK: no problems found in ca/ica/server"},
+		{"world readable key", 0644, []string{"ca/ica/server"}, expiringCritical, "CRITICAL: ca/ica/server: private key ca/ica/server/server.key has permissions 0644 which are more permissive than 0600"},
+		{"group writable key", 0620, []string{"ca/ica/server"}, expiringWarning, "WARNING: ca/ica/server: private key ca/ica/server/server.key has permissions 0620"},
+		{"unencrypted ca key", privatePerms, []string{"ca/ica"}, expiringWarning, "WARNING: ca/ica: ca private key ca/ica/ica.key isn't encrypted"},
+		{"expiring", privatePerms, []string{"-warn-days=10000", "ca/ica/server"}, expiringWarning, "WARNING: ca/ica/server: expires "},
+		{"weak key", privatePerms, []string{"-allowed-curves=P-256", "ca/ica/server"}, expiringCritical, "CRITICAL: ca/ica/server: weak public key: the P-384 curve isn't allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if runtime.GOOS == "windows" && tt.keyMode != privatePerms {
+				t.Skip("file permissions aren't checked on windows")
+			}
+			dir := newTree(t)
+			if err := os.Chmod(filepath.Join(dir, "ca/ica/server/server.key"), tt.keyMode); err != nil {
+				t.Fatal(err)
+			}
+			res := runCertshop(t, dir, nil, append([]string{"lint"}, tt.args...)...)
+			if res.code != tt.code {
+				t.Errorf("got status %d, want %d:\n%s", res.code, tt.code, res.stderr)
+			}
+			if !strings.Contains(string(res.stdout), tt.output) {
+				t.Errorf("%q isn't in the output:\n%s", tt.output, res.stdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// lockTree takes an exclusive lock on the root ca folder of path (see
+// chainSearchRoot) so that concurrent certshop processes creating or
+// removing certificates in the same tree are serialized (read-only
+// commands don't lock); the folder of a new root ca is created so that
+// two processes creating the same root are serialized too; the returned
+// function releases the lock
+func lockTree(path string) func() {
+	dir := chainSearchRoot(path)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		// only a new root ca (a top level folder) has no tree yet
+		if parent := filepath.Dir(dir); parent != "." {
+			errorLog.Fatalf("Failed to lock %s: the signing ca certificate %s doesn't exist", path, filepath.Join(parent, filepath.Base(parent)+".crt"))
+		}
+		createDirectory(dir)
+	}
+	return lockFolder(dir)
+}
+
+// lockFolder takes an exclusive lock on the existing folder dir; the
+// returned function releases the lock
+func lockFolder(dir string) func() {
+	lockPath := filepath.Join(dir, ".certshop.lock")
+	lock, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, privatePerms)
+	if err != nil {
+		errorLog.Fatalf("Failed to open lock file %s: %s", lockPath, err)
+	}
+	if err := lockFile(lock); err != nil {
+		errorLog.Fatalf("Failed to lock %s: %s", lockPath, err)
+	}
+	return func() {
+		if err := unlockFile(lock); err != nil {
+			errorLog.Fatalf("Failed to unlock %s: %s", lockPath, err)
+		}
+		if err := lock.Close(); err != nil {
+			errorLog.Fatalf("Failed to close lock file %s: %s", lockPath, err)
+		}
+	}
+}
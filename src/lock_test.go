@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLockTree(t *testing.T) {
+	dir := newTree(t)
+	t.Chdir(dir)
+	tests := []struct {
+		path string
+		lock string
+	}{
+		{"ca/ica/server", "ca/.certshop.lock"},
+		{"ca/ica/new", "ca/.certshop.lock"},
+		{filepath.Join(dir, "ca/ica/server"), "ca/.certshop.lock"},
+		{"newroot", "newroot/.certshop.lock"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			os.Remove(tt.lock)
+			unlock := lockTree(tt.path)
+			if _, err := os.Stat(tt.lock); err != nil {
+				t.Errorf("the lock file wasn't created: %s", err)
+			}
+			unlock()
+		})
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".certshop.lock")); err == nil {
+		t.Error("a lock file was created outside the tree")
+	}
+
+	res := runCertshop(t, dir, nil, "client", "-dn=/CN=client", "missing/client")
+	if res.code == 0 || !strings.Contains(res.stderr, "missing/missing.crt") {
+		t.Errorf("a certificate without a signing ca wasn't refused: %s", res.stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Error("a folder was created for the missing ca")
+	}
+}
+
+func TestConcurrentRootCreation(t *testing.T) {
+	dir := t.TempDir()
+	const processes = 6
+	codes := make([]int, processes)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = runCertshop(t, dir, nil, "ca", "-dn=/CN=root", "ca").code
+		}(i)
+	}
+	wg.Wait()
+	created := 0
+	for _, code := range codes {
+		if code == 0 {
+			created++
+		}
+	}
+	if created != 1 {
+		t.Errorf("the root ca was created %d times, want once", created)
+	}
+	if !parseKey(filepath.Join(dir, "ca")).PublicKey.Equal(parseCert(filepath.Join(dir, "ca")).PublicKey) {
+		t.Error("the root ca key doesn't match its certificate")
+	}
+}
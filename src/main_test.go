@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs main instead of the tests when the test binary is started
+// by runCertshop, so the commands can be tested end to end (errorLog
+// exits the process on failure)
+func TestMain(m *testing.M) {
+	if os.Getenv("CERTSHOP_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// result is the output and exit status of a certshop command
+type result struct {
+	stdout []byte
+	stderr string
+	code   int
+}
+
+// runCertshop runs the certshop command line args in dir with stdin as
+// its standard input
+func runCertshop(t *testing.T, dir string, stdin []byte, args ...string) result {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "CERTSHOP_TEST_MAIN=1")
+	cmd.Stdin = bytes.NewReader(stdin)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	res := result{stdout: stdout.Bytes(), stderr: stderr.String()}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		res.code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("Failed to run certshop %s: %s", strings.Join(args, " "), err)
+	}
+	return res
+}
+
+// certshop runs the certshop command line args in dir and fails the test
+// if it doesn't succeed
+func certshop(t *testing.T, dir string, args ...string) []byte {
+	t.Helper()
+	res := runCertshop(t, dir, nil, args...)
+	if res.code != 0 {
+		t.Fatalf("certshop %s failed with status %d:\n%s", strings.Join(args, " "), res.code, res.stderr)
+	}
+	return res.stdout
+}
+
+// newTree creates a root ca "ca", an intermediate ca "ca/ica" and a
+// server certificate "ca/ica/server" in a new temporary directory
+func newTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root", "-maxPathLength=1")
+	certshop(t, dir, "ica", "-dn=/CN=ica", "ca/ica")
+	certshop(t, dir, "server", "-dn=/CN=server", "-san=server.example.com,10.0.0.1", "ca/ica/server")
+	return dir
+}
+
+// listTree returns the relative paths of the files and folders in dir
+func listTree(t *testing.T, dir string) []string {
+	t.Helper()
+	paths := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		paths = append(paths, rel)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+// readTgz returns the contents of the entries of a tgz archive by name,
+// with hard links pointing at their target's contents
+func readTgz(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read the tgz archive: %s", err)
+	}
+	tr := tar.NewReader(gz)
+	entries := map[string][]byte{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		} else if err != nil {
+			t.Fatalf("Failed to read the tgz archive: %s", err)
+		}
+		if header.Typeflag == tar.TypeLink {
+			entries[header.Name] = entries[header.Linkname]
+			continue
+		}
+		if entries[header.Name], err = io.ReadAll(tr); err != nil {
+			t.Fatalf("Failed to read %s from the tgz archive: %s", header.Name, err)
+		}
+	}
+}
+
+// readCert parses the first certificate of a pem file
+func readCert(t *testing.T, fileName string) *x509.Certificate {
+	t.Helper()
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("No pem data found in %s", fileName)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %s", fileName, err)
+	}
+	return cert
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// manifest lists the files created by certshop for provisioning tools
+// (ie. terraform or ansible) with enough detail to check each of them
+type manifest struct {
+	Certificates []manifestEntry `json:"certificates"`
+}
+
+type manifestEntry struct {
+	Path        string `json:"path"`
+	Certificate string `json:"certificate"`
+	Key         string `json:"key,omitempty"`
+	CA          string `json:"ca"`
+	Subject     string `json:"subject"`
+	Issuer      string `json:"issuer"`
+	Serial      string `json:"serial"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"public_key"`
+	IsCA        bool   `json:"is_ca"`
+	NotBefore   string `json:"not_before"`
+	NotAfter    string `json:"not_after"`
+}
+
+// writeManifest adds the certificate created in path to the json
+// manifest (does nothing if manifestPath is empty); entries for other
+// paths are kept so a series of commands can build one manifest
+func writeManifest(manifestPath string, path string, derCert []byte) {
+	if manifestPath == "" {
+		return
+	}
+	cert, err := x509.ParseCertificate(derCert)
+	if err != nil {
+		errorLog.Fatalf("Failed to parse certificate for manifest: %s", err)
+	}
+	fingerprint := sha256.Sum256(cert.Raw)
+	base := filepath.Join(path, filepath.Base(path))
+	entry := manifestEntry{
+		Path:        path,
+		Certificate: base + ".crt",
+		CA:          filepath.Join(path, "ca.pem"),
+		Subject:     formatDn(cert.Subject),
+		Issuer:      formatDn(cert.Issuer),
+		Serial:      cert.SerialNumber.Text(16),
+		Fingerprint: "SHA256:" + hex.EncodeToString(fingerprint[:]),
+		PublicKey:   publicKeyFingerprint(cert),
+		IsCA:        cert.IsCA,
+		NotBefore:   cert.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:    cert.NotAfter.UTC().Format(time.RFC3339),
+	}
+	if _, err := os.Stat(base + ".key"); err == nil {
+		entry.Key = base + ".key"
+	}
+
+	m := manifest{}
+	if data, err := ioutil.ReadFile(manifestPath); err == nil {
+		if err = json.Unmarshal(data, &m); err != nil {
+			errorLog.Fatalf("Failed to parse existing manifest %s: %s", manifestPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		errorLog.Fatalf("Failed to read manifest %s: %s", manifestPath, err)
+	}
+	replaced := false
+	for i := range m.Certificates {
+		if m.Certificates[i].Path == path {
+			m.Certificates[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		m.Certificates = append(m.Certificates, entry)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		errorLog.Fatalf("Failed to marshal manifest: %s", err)
+	}
+	infoLog.Printf("Writing manifest entry to %s\n", manifestPath)
+	writeFile(manifestPath, append(data, '\n'), publicPerms)
+}
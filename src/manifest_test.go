@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readManifest returns the entries of the json manifest fileName by path
+func readManifest(t *testing.T, fileName string) map[string]manifestEntry {
+	t.Helper()
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifest
+	if err = json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	entries := map[string]manifestEntry{}
+	for _, entry := range m.Certificates {
+		if _, ok := entries[entry.Path]; ok {
+			t.Errorf("%s is listed more than once", entry.Path)
+		}
+		entries[entry.Path] = entry
+	}
+	return entries
+}
+
+func TestManifestOut(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root", "-maxPathLength=1", "-manifest-out=manifest.json")
+	certshop(t, dir, "ica", "-dn=/CN=ica", "-manifest-out=manifest.json", "ca/ica")
+	certshop(t, dir, "server", "-dn=/CN=server", "-san=server.example.com", "-manifest-out=manifest.json", "ca/ica/server")
+	// reissuing a certificate replaces its entry
+	certshop(t, dir, "server", "-dn=/CN=server", "-san=server.example.com", "-overwrite", "-overwrite-keys", "-yes", "-manifest-out=manifest.json", "ca/ica/server")
+
+	entries := readManifest(t, filepath.Join(dir, "manifest.json"))
+	tests := []struct {
+		path    string
+		subject string
+		issuer  string
+		isCA    bool
+	}{
+		{"ca", "/CN=root", "/CN=root", true},
+		{"ca/ica", "/CN=ica", "/CN=root", true},
+		{"ca/ica/server", "/CN=server", "/CN=ica", false},
+	}
+	if len(entries) != len(tests) {
+		t.Errorf("got %d entries, want %d", len(entries), len(tests))
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			entry, ok := entries[tt.path]
+			if !ok {
+				t.Fatalf("%s isn't listed", tt.path)
+			}
+			base := filepath.Join(tt.path, filepath.Base(tt.path))
+			cert := readCert(t, filepath.Join(dir, base+".crt"))
+			fingerprint := sha256.Sum256(cert.Raw)
+			want := manifestEntry{
+				Path:        tt.path,
+				Certificate: base + ".crt",
+				Key:         base + ".key",
+				CA:          filepath.Join(tt.path, "ca.pem"),
+				Subject:     tt.subject,
+				Issuer:      tt.issuer,
+				Serial:      cert.SerialNumber.Text(16),
+				Fingerprint: "SHA256:" + hex.EncodeToString(fingerprint[:]),
+				PublicKey:   publicKeyFingerprint(cert),
+				IsCA:        tt.isCA,
+				NotBefore:   cert.NotBefore.UTC().Format(time.RFC3339),
+				NotAfter:    cert.NotAfter.UTC().Format(time.RFC3339),
+			}
+			if entry != want {
+				t.Errorf("got  %+v\nwant %+v", entry, want)
+			}
+			for _, fileName := range []string{entry.Certificate, entry.Key, entry.CA} {
+				if _, err := os.Stat(filepath.Join(dir, fileName)); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestManifestOutInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res := runCertshop(t, dir, nil, "ca", "-manifest-out=manifest.json")
+	if res.code == 0 {
+		t.Errorf("an invalid manifest was overwritten")
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "manifest.json")); err != nil || string(data) != "not json" {
+		t.Errorf("the invalid manifest changed to %q", data)
+	}
+}
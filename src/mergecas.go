@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"os"
+	"path/filepath"
+)
+
+// mergeCAs prints a trust bundle with every ca certificate found in
+// the certificate trees or pem files given as arguments, keeping the
+// first of any certificates with the same fingerprint
+func mergeCAs(args []string) {
+	fs := flag.NewFlagSet("merge-cas", flag.ContinueOnError)
+	addCommonFlags(fs)
+	rootsOnly := fs.Bool("roots-only", false, "only include self-signed root certificates")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"ca"}
+	}
+
+	seen := map[[sha256.Size]byte]bool{}
+	bundle := []byte{}
+	duplicates := 0
+	add := func(cert *x509.Certificate) {
+		if !cert.IsCA || (*rootsOnly && !isSelfSigned(cert)) {
+			return
+		}
+		fingerprint := sha256.Sum256(cert.Raw)
+		if seen[fingerprint] {
+			duplicates++
+			return
+		}
+		seen[fingerprint] = true
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			errorLog.Fatalf("Failed to read %s: %s", path, err)
+		}
+		if !info.IsDir() {
+			for _, cert := range parseCertChain(path) {
+				add(cert)
+			}
+			continue
+		}
+		walkCertificates(path, func(path string, _ *x509.Certificate) {
+			for _, cert := range parseCertChain(filepath.Join(path, filepath.Base(path)+".crt")) {
+				add(cert)
+			}
+			if _, err := os.Stat(filepath.Join(path, "ca.pem")); err == nil {
+				for _, cert := range parseCertChain(filepath.Join(path, "ca.pem")) {
+					add(cert)
+				}
+			}
+		})
+	}
+	if len(seen) == 0 {
+		errorLog.Fatalf("No ca certificates found")
+	}
+	if _, err = os.Stdout.Write(bundle); err != nil {
+		errorLog.Fatalf("Failed to write trust bundle: %s", err)
+	}
+	infoLog.Printf("Merged %d ca certificates (skipped %d duplicates)\n", len(seen), duplicates)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/sha256"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMergeCAs(t *testing.T) {
+	dir := newTree(t)
+	certshop(t, dir, "ca", "-dn=/CN=other", "other")
+	certshop(t, dir, "ica", "-dn=/CN=ica2", "ca/ica2")
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"default tree", nil, []string{"ica", "ica2", "root"}},
+		{"overlapping chains", []string{"ca/ica/server/server.crt", "ca/ica/ica.crt", "ca/ca.pem"}, []string{"ica", "root"}},
+		{"overlapping trees", []string{"ca/ica", "ca", "other"}, []string{"ica", "ica2", "other", "root"}},
+		{"roots only", []string{"-roots-only", "ca", "other", "ca/ica"}, []string{"other", "root"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certs := parseCertsPem(certshop(t, dir, append([]string{"merge-cas"}, tt.args...)...))
+			names := []string{}
+			seen := map[[sha256.Size]byte]bool{}
+			for _, cert := range certs {
+				fingerprint := sha256.Sum256(cert.Raw)
+				if seen[fingerprint] {
+					t.Errorf("%s is in the bundle more than once", cert.Subject.CommonName)
+				}
+				seen[fingerprint] = true
+				names = append(names, cert.Subject.CommonName)
+			}
+			sort.Strings(names)
+			if got, want := strings.Join(names, ","), strings.Join(tt.want, ","); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestOpenSSHKeyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		curve    elliptic.Curve
+		password string
+	}{
+		{"P-384 unencrypted", elliptic.P384(), ""},
+		{"P-384 encrypted", elliptic.P384(), "secret"},
+		{"P-256 unencrypted", elliptic.P256(), ""},
+		{"P-256 encrypted", elliptic.P256(), "secret"},
+		{"P-521 unencrypted", elliptic.P521(), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ecdsa.GenerateKey(tt.curve, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := marshalOpenSSHKey(key, "test", tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var signer ssh.Signer
+			if tt.password == "" {
+				signer, err = ssh.ParsePrivateKey(data)
+			} else {
+				if _, err = ssh.ParsePrivateKey(data); err == nil {
+					t.Fatal("ssh.ParsePrivateKey parsed an encrypted key without its passphrase")
+				}
+				signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(tt.password))
+			}
+			if err != nil {
+				t.Fatalf("ssh failed to parse the key: %s", err)
+			}
+			public, err := ssh.NewPublicKey(&key.PublicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(signer.PublicKey().Marshal()) != string(public.Marshal()) {
+				t.Error("ssh parsed a different public key")
+			}
+			if isEncryptedOpenSSHKey(data) != (tt.password != "") {
+				t.Errorf("isEncryptedOpenSSHKey returned %t", tt.password == "")
+			}
+
+			decoded, err := parseOpenSSHKey(data, tt.password)
+			if err != nil {
+				t.Fatalf("parseOpenSSHKey failed: %s", err)
+			}
+			if !key.Equal(decoded) {
+				t.Error("parseOpenSSHKey returned a different key")
+			}
+		})
+	}
+}
+
+func TestParseOpenSSHKeyWrongPassword(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := marshalOpenSSHKey(key, "test", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, password := range []string{"wrong", ""} {
+		if _, err = parseOpenSSHKey(encrypted, password); err == nil {
+			t.Errorf("parseOpenSSHKey accepted the passphrase %q", password)
+		}
+	}
+}
+
+func TestOpenSSHKeyFormatOtherCurves(t *testing.T) {
+	sshKeygen, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen isn't installed")
+	}
+	dir := newTree(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyIn := filepath.Join(dir, "p256.key")
+	data, err := marshalOpenSSHKey(key, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyIn, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	certshop(t, dir, "server", "-key-in="+keyIn, "-key-format=openssh", "-san=web.example.com", "ca/ica/web")
+	out, err := exec.Command(sshKeygen, "-y", "-f", filepath.Join(dir, "ca/ica/web/web.key")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("ssh-keygen rejected the key: %s %s", err, out)
+	}
+	if !strings.HasPrefix(string(out), "ecdsa-sha2-nistp256 ") {
+		t.Errorf("ssh-keygen read a %s key", strings.Fields(string(out))[0])
+	}
+}
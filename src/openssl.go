@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// opensslTimeout limits how long openssl may run before it is killed
+// (set by "-openssl-timeout")
+var opensslTimeout = 30 * time.Second
+
+// noOpenssl makes runOpenssl and checkOpenssl fail instead of starting
+// openssl (set by "-no-openssl") for environments where it must never
+// run; openssl is the only program certshop runs, so no subprocess is
+// started at all
+var noOpenssl bool
+
+// quietOpenssl leaves openssl's error output out of error messages (set
+// by "-quiet-openssl")
+var quietOpenssl bool
+
+// minOpensslVersion is the oldest openssl version allowed to run (set by
+// "-validate-openssl-version")
+var minOpensslVersion []int
+
+// addOpensslFlags adds the "-openssl-timeout", "-quiet-openssl" and
+// "-validate-openssl-version" flags to commands which run openssl
+func addOpensslFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&opensslTimeout, "openssl-timeout", opensslTimeout, "kill openssl if it runs longer than this duration")
+	fs.BoolVar(&quietOpenssl, "quiet-openssl", false, "don't include openssl's error output in error messages")
+	fs.Func("validate-openssl-version", "fail unless openssl is at least this version (ie. 3.0)", func(minimum string) (err error) {
+		minOpensslVersion, err = parseVersionNumbers(minimum)
+		return err
+	})
+}
+
+// opensslRemedy explains the openssl dependency when it isn't available
+const opensslRemedy = `certshop runs openssl only for pkcs12 files (export "-p12" and "-p12-append", and "-ca" pkcs12 files) and dhparam "-bits"; everything else is native.
+Install openssl (ie. "apt install openssl", "dnf install openssl" or "brew install openssl"; see https://wiki.openssl.org/index.php/Binaries for windows) and make sure it is in the PATH,
+or use the native alternatives: export the pem files (or "-p7b") instead of "-p12", and dhparam "-group" instead of "-bits"`
+
+var opensslOnce sync.Once
+var opensslErr error
+var opensslVersion string
+
+// checkOpenssl makes sure openssl is installed and runs ("openssl
+// version") before it is needed, so a missing dependency gets a single
+// clear message instead of an error part way through a command
+func checkOpenssl() error {
+	if noOpenssl {
+		return errors.New("openssl is needed but \"-no-openssl\" was given")
+	}
+	opensslOnce.Do(func() {
+		fileName, err := exec.LookPath("openssl")
+		if err != nil {
+			opensslErr = errors.New("openssl was not found in the PATH")
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), opensslTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, fileName, "version").CombinedOutput()
+		if err != nil {
+			opensslErr = fmt.Errorf("%s was found but \"openssl version\" failed: %s %s", fileName, err, bytes.TrimSpace(out))
+			return
+		}
+		opensslVersion = string(bytes.TrimSpace(out))
+		if debug {
+			infoLog.Printf("DEBUG: using %s (%s)\n", fileName, opensslVersion)
+		}
+	})
+	if opensslErr != nil {
+		return fmt.Errorf("%s\n%s", opensslErr, opensslRemedy)
+	}
+	if minOpensslVersion != nil {
+		return checkOpensslVersion(opensslVersion, minOpensslVersion)
+	}
+	return nil
+}
+
+// checkOpensslVersion fails if the "openssl version" output isn't openssl
+// of at least the minimum version; LibreSSL (which macos installs as
+// openssl) numbers its versions separately so it never matches
+func checkOpensslVersion(output string, minimum []int) error {
+	fields := strings.Fields(output)
+	if len(fields) < 2 {
+		return fmt.Errorf("can't find the version in the \"openssl version\" output %q", output)
+	}
+	if fields[0] != "OpenSSL" {
+		return fmt.Errorf("\"-validate-openssl-version\" requires OpenSSL but found %s, whose version numbers aren't comparable", output)
+	}
+	version, err := parseVersionNumbers(fields[1])
+	if err != nil {
+		return fmt.Errorf("can't parse the version in the \"openssl version\" output %q: %s", output, err)
+	}
+	for i := 0; i < len(version) || i < len(minimum); i++ {
+		v, m := 0, 0
+		if i < len(version) {
+			v = version[i]
+		}
+		if i < len(minimum) {
+			m = minimum[i]
+		}
+		if v > m {
+			return nil
+		} else if v < m {
+			return fmt.Errorf("%s is older than the version required by \"-validate-openssl-version\" (OpenSSL 1.x and 3.x create pkcs12 files with different defaults)", output)
+		}
+	}
+	return nil
+}
+
+// parseVersionNumbers parses dotted version numbers, ignoring a letter
+// release (ie. 1.1.1w) or pre-release suffix (ie. 3.2.0-alpha1)
+func parseVersionNumbers(version string) ([]int, error) {
+	numeric := version
+	if end := strings.IndexFunc(version, func(r rune) bool { return r != '.' && (r < '0' || r > '9') }); end >= 0 {
+		numeric = version[:end]
+	}
+	numbers := []int{}
+	for _, part := range strings.Split(numeric, ".") {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %s", version)
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
+// runOpenssl runs openssl with the password written to stdin (so it
+// doesn't show up in the process list) and returns stdout; openssl's
+// output is never passed through to certshop's own stdout or stderr,
+// and stderr is only reported in the error if openssl fails
+func runOpenssl(args []string, password string) ([]byte, error) {
+	return runOpensslInput(args, []byte(password), nil)
+}
+
+// runOpensslInput runs openssl with input on its stdin and env added to
+// its environment, so that secrets such as private keys are passed in
+// memory rather than in temporary files
+func runOpensslInput(args []string, input []byte, env []string) ([]byte, error) {
+	if noOpenssl {
+		return nil, fmt.Errorf("openssl %s is needed but \"-no-openssl\" was given (there is no native implementation)", args[0])
+	}
+	if err := checkOpenssl(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opensslTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "openssl", args...)
+	// don't wait forever for output pipes held open by any child processes
+	cmd.WaitDelay = time.Second
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stdin pipe to openssl: %s", err)
+	}
+	go func() {
+		defer func() {
+			if err := stdin.Close(); err != nil && ctx.Err() == nil {
+				errorLog.Fatalf("Failed to close stdin pipe to openssl: %s", err)
+			}
+		}()
+		if _, err := stdin.Write(input); err != nil && ctx.Err() == nil {
+			errorLog.Fatalf("Failed to transfer input to openssl: %s", err)
+		}
+	}()
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	start := time.Now()
+	out, err := cmd.Output()
+	debugTiming("openssl "+args[0], start)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("openssl %s was killed after running for %s (use \"-openssl-timeout\" to allow longer)", args[0], opensslTimeout)
+	} else if err != nil {
+		return nil, &opensslError{err: err, stderr: strings.TrimSpace(stderr.String())}
+	}
+	return out, nil
+}
+
+// opensslError classifies common openssl failures so the user gets
+// actionable guidance instead of just an exit status
+type opensslError struct {
+	err    error
+	stderr string
+}
+
+func (e *opensslError) Error() string {
+	msg := e.err.Error()
+	if e.stderr != "" && !quietOpenssl {
+		msg += "\n" + e.stderr
+	}
+	if hint := e.hint(); hint != "" {
+		msg += "\n" + hint
+	}
+	return msg
+}
+
+func (e *opensslError) hint() string {
+	switch {
+	case errors.Is(e.err, exec.ErrNotFound):
+		return "openssl must be installed and included in the current PATH (check with \"which openssl\")"
+	case strings.Contains(e.stderr, "mac verify failure") || strings.Contains(e.stderr, "invalid password"):
+		return "the pkcs12 password is probably incorrect"
+	case strings.Contains(e.stderr, "unable to load private key") || strings.Contains(e.stderr, "Could not read private key"):
+		return "openssl can only read pem format private keys (create the certificate with \"-key-format=pem\")"
+	case e.unsupported():
+		return "OpenSSL 3.x doesn't enable legacy algorithms (such as RC2 and 3DES) by default; the pkcs12 file probably uses one of them (openssl needs the \"-legacy\" option to read it)"
+	case strings.Contains(e.stderr, "No certificate matches private key"):
+		return "the certificate and private key files don't match"
+	}
+	return ""
+}
+
+// unsupported is the OpenSSL 3.x "digital envelope routines::unsupported"
+// error which means an algorithm from the legacy provider was needed
+func (e *opensslError) unsupported() bool {
+	return (strings.Contains(e.stderr, "digital envelope routines") && strings.Contains(e.stderr, "unsupported")) ||
+		strings.Contains(e.stderr, "RC2-40-CBC")
+}
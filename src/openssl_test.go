@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpensslErrorHint(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		stderr string
+		hint   string
+	}{
+		{"not found", exec.ErrNotFound, "", "must be installed"},
+		{"wrong password", errors.New("exit status 1"), "Mac verify error: invalid password?", "password is probably incorrect"},
+		{"legacy algorithm", errors.New("exit status 1"), "error:0308010C:digital envelope routines::unsupported", "\"-legacy\""},
+		{"rc2", errors.New("exit status 1"), "Error outputting keys and certificates\nRC2-40-CBC", "\"-legacy\""},
+		{"mismatched key", errors.New("exit status 1"), "No certificate matches private key", "don't match"},
+		{"unknown", errors.New("exit status 1"), "something else went wrong", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &opensslError{err: tt.err, stderr: tt.stderr}
+			if hint := e.hint(); (tt.hint == "") != (hint == "") || !strings.Contains(hint, tt.hint) {
+				t.Errorf("got hint %q, want one containing %q", hint, tt.hint)
+			}
+			if !strings.Contains(e.Error(), tt.stderr) {
+				t.Errorf("the error %q doesn't include openssl's output", e.Error())
+			}
+		})
+	}
+}
+
+// fakeOpenssl puts a shell script named openssl first in the PATH, which
+// reports the version and otherwise records its arguments in the
+// returned file and fails with stderr as its output (or succeeds if
+// stderr is empty)
+func fakeOpenssl(t *testing.T, stderr string) string {
+	t.Helper()
+	argsFile := filepath.Join(t.TempDir(), "args")
+	script := "echo \"$@\" > '" + argsFile + "'\n" +
+		"cat > /dev/null\n"
+	if stderr == "" {
+		script += "echo fake\n"
+	} else {
+		script += "echo '" + stderr + "' >&2\nexit 1\n"
+	}
+	installOpenssl(t, script)
+	return argsFile
+}
+
+// installOpenssl puts a shell script named openssl, which reports the
+// version and otherwise runs script, first in the PATH
+func installOpenssl(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake openssl is a shell script")
+	}
+	dir := t.TempDir()
+	script = "#!/bin/sh\n" +
+		"if [ \"$1\" = version ]; then echo 'OpenSSL 3.0.2 15 Mar 2022'; exit 0; fi\n" +
+		script
+	if err := os.WriteFile(filepath.Join(dir, "openssl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestOpensslFailureGuidance(t *testing.T) {
+	dir := newTree(t)
+	fakeOpenssl(t, "error:0308010C:digital envelope routines::unsupported")
+	res := runCertshop(t, dir, nil, "export", "-p12", "-password=secret", "ca/ica/server")
+	if res.code == 0 {
+		t.Fatal("the export succeeded with a failing openssl")
+	}
+	for _, want := range []string{"digital envelope routines::unsupported", "\"-legacy\""} {
+		if !strings.Contains(res.stderr, want) {
+			t.Errorf("%q isn't in the error output:\n%s", want, res.stderr)
+		}
+	}
+	if len(res.stdout) != 0 {
+		t.Error("a partial archive was written to stdout")
+	}
+}
+
+func TestExportLegacyP12Options(t *testing.T) {
+	dir := newTree(t)
+	argsFile := fakeOpenssl(t, "")
+	legacy := "-certpbe PBE-SHA1-3DES -keypbe PBE-SHA1-3DES -macalg sha1"
+	for _, isLegacy := range []bool{false, true} {
+		certshop(t, dir, "export", "-p12", "-password=secret", fmt.Sprintf("-legacy=%t", isLegacy), "ca/ica/server")
+		args, err := os.ReadFile(argsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(args), "pkcs12 -export") {
+			t.Errorf("openssl was run with %s", args)
+		}
+		if strings.Contains(string(args), legacy) != isLegacy {
+			t.Errorf("-legacy=%t: openssl was run with %s", isLegacy, args)
+		}
+	}
+}
+
+func TestOpensslTimeout(t *testing.T) {
+	dir := newTree(t)
+	// exec replaces the shell so the kill reaches the sleeping process
+	installOpenssl(t, "exec sleep 30\n")
+	start := time.Now()
+	res := runCertshop(t, dir, nil, "export", "-p12", "-password=secret", "-openssl-timeout=200ms", "ca/ica/server")
+	if res.code == 0 {
+		t.Fatal("certshop succeeded although openssl never finished")
+	}
+	if !strings.Contains(res.stderr, "was killed after running for 200ms") {
+		t.Errorf("the timeout isn't reported in %s", res.stderr)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("certshop waited %s for openssl", elapsed)
+	}
+}
+
+func TestNoOpensslRunsNoSubprocess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake openssl is a shell script")
+	}
+	dir := newTree(t)
+	// the PATH only has an openssl which records any run, so starting
+	// openssl or any other program is detected
+	bin, ran := t.TempDir(), filepath.Join(t.TempDir(), "ran")
+	script := "#!/bin/sh\necho \"$@\" >> '" + ran + "'\necho 'OpenSSL 3.0.2 15 Mar 2022'\n"
+	if err := os.WriteFile(filepath.Join(bin, "openssl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	tests := []struct {
+		name string
+		args []string
+		ok   bool
+	}{
+		{"create", []string{"server", "-no-openssl", "-dn=/CN=other", "ca/ica/other"}, true},
+		{"export", []string{"export", "-no-openssl", "-key-encoding=openssh", "ca/ica/server"}, true},
+		{"p12", []string{"export", "-no-openssl", "-p12", "-password=secret", "ca/ica/server"}, false},
+		{"p12 append", []string{"export", "-no-openssl", "-p12-append=missing.p12", "ca/ica/server"}, false},
+		{"dhparam bits", []string{"dhparam", "-no-openssl", "-bits=2048"}, false},
+		{"dhparam group", []string{"dhparam", "-no-openssl", "-group=ffdhe2048"}, true},
+		{"selftest", []string{"selftest", "-no-openssl"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := runCertshop(t, dir, nil, tt.args...)
+			if (res.code == 0) != tt.ok {
+				t.Errorf("certshop %s exited with status %d:\n%s", strings.Join(tt.args, " "), res.code, res.stderr)
+			}
+			if !tt.ok && !strings.Contains(res.stderr, "-no-openssl") {
+				t.Errorf("the error doesn't mention \"-no-openssl\":\n%s", res.stderr)
+			}
+			if data, err := os.ReadFile(ran); err == nil {
+				t.Errorf("openssl was run with \"-no-openssl\": %s", data)
+			}
+		})
+	}
+}
+
+func TestOpensslOutputIsCaptured(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		name   string
+		script string
+		args   []string
+		ok     bool
+		shown  bool
+	}{
+		// the p12 file is openssl's stdout, and its chatter on stderr
+		// must neither reach certshop's stdout nor its stderr
+		{"success", "cat > /dev/null\necho 'openssl chatter' >&2\nprintf p12data\n", nil, true, false},
+		{"failure", "cat > /dev/null\necho 'openssl chatter' >&2\nexit 1\n", nil, false, true},
+		{"quiet failure", "cat > /dev/null\necho 'openssl chatter' >&2\nexit 1\n", []string{"-quiet-openssl"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installOpenssl(t, tt.script)
+			args := append(append([]string{"export", "-p12", "-password=secret"}, tt.args...), "ca/ica/server")
+			res := runCertshop(t, dir, nil, args...)
+			if (res.code == 0) != tt.ok {
+				t.Fatalf("got status %d:\n%s", res.code, res.stderr)
+			}
+			if shown := strings.Contains(res.stderr, "openssl chatter"); shown != tt.shown {
+				t.Errorf("openssl's stderr shown %t, want %t:\n%s", shown, tt.shown, res.stderr)
+			}
+			if !tt.ok {
+				if len(res.stdout) != 0 {
+					t.Errorf("%d bytes were written to stdout", len(res.stdout))
+				}
+				return
+			}
+			entries := readTgz(t, res.stdout)
+			if string(entries["server.p12"]) != "p12data" {
+				t.Errorf("server.p12 is %q, want openssl's output", entries["server.p12"])
+			}
+			for name, data := range entries {
+				if name != "server.p12" && strings.Contains(string(data), "openssl chatter") {
+					t.Errorf("openssl's output is in %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestOpensslMissing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the broken openssl is a shell script")
+	}
+	dir := newTree(t)
+	empty, broken := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(broken, "openssl"), []byte("#!/bin/sh\necho 'libcrypto.so.3: cannot open shared object file' >&2\nexit 127\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	paths := []struct {
+		name string
+		path string
+		err  string
+	}{
+		{"missing", empty, "openssl was not found in the PATH"},
+		{"broken", broken, "\"openssl version\" failed"},
+	}
+	commands := [][]string{
+		{"export", "-p12", "-password=secret", "ca/ica/server"},
+		{"export", "-p12-append=missing.p12", "-password=secret", "ca/ica/server"},
+		{"dhparam", "-bits=2048"},
+	}
+	for _, path := range paths {
+		for _, args := range commands {
+			t.Run(path.name+" "+strings.Join(args[:2], " "), func(t *testing.T) {
+				t.Setenv("PATH", path.path)
+				res := runCertshop(t, dir, nil, args...)
+				if res.code == 0 {
+					t.Fatalf("certshop succeeded without a working openssl")
+				}
+				for _, want := range []string{path.err, "Install openssl", "native alternatives"} {
+					if !strings.Contains(res.stderr, want) {
+						t.Errorf("%q isn't in the error output:\n%s", want, res.stderr)
+					}
+				}
+				if len(res.stdout) > 0 {
+					t.Errorf("%d bytes were written to stdout", len(res.stdout))
+				}
+			})
+		}
+	}
+}
+
+func TestCheckOpensslVersion(t *testing.T) {
+	tests := []struct {
+		output  string
+		minimum string
+		ok      bool
+	}{
+		{"OpenSSL 3.0.2 15 Mar 2022", "3.0", true},
+		{"OpenSSL 3.0.2 15 Mar 2022", "3.0.2", true},
+		{"OpenSSL 3.0.2 15 Mar 2022", "3.0.3", false},
+		{"OpenSSL 3.0.2 15 Mar 2022", "3.1", false},
+		{"OpenSSL 3.2.1 30 Jan 2024 (Library: OpenSSL 3.2.1 30 Jan 2024)", "3", true},
+		{"OpenSSL 1.1.1w  11 Sep 2023", "1.1.1", true},
+		{"OpenSSL 1.1.1w  11 Sep 2023", "3.0", false},
+		{"OpenSSL 1.0.2k-fips  26 Jan 2017", "1.0.2", true},
+		{"LibreSSL 3.3.6", "3.0", false},
+		{"LibreSSL 3.3.6", "1.0", false},
+		{"OpenSSL", "3.0", false},
+		{"OpenSSL unknown", "3.0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.output+" "+tt.minimum, func(t *testing.T) {
+			minimum, err := parseVersionNumbers(tt.minimum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = checkOpensslVersion(tt.output, minimum); (err == nil) != tt.ok {
+				t.Errorf("got %v, want ok %t", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateOpensslVersion(t *testing.T) {
+	// the fake openssl reports 3.0.2
+	fakeOpenssl(t, "")
+	tests := []struct {
+		minimum string
+		err     string
+	}{
+		{"3.0", ""},
+		{"3.0.2", ""},
+		{"3.1", "is older than the version required"},
+		{"three", "invalid version three"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.minimum, func(t *testing.T) {
+			res := runCertshop(t, newTree(t), nil, "export", "-p12", "-password=secret", "-validate-openssl-version="+tt.minimum, "ca/ica/server")
+			if tt.err == "" && res.code != 0 {
+				t.Errorf("the export failed with status %d:\n%s", res.code, res.stderr)
+			} else if tt.err != "" && (res.code == 0 || !strings.Contains(res.stderr, tt.err)) {
+				t.Errorf("got status %d, want an error with %q:\n%s", res.code, tt.err, res.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// printOpensslCmd prints a command line (quoted for a posix shell) to
+// stderr so that it doesn't mix with the export tarball on stdout
+func printOpensslCmd(args ...string) {
+	quoted := []string{}
+	for _, arg := range args {
+		if arg == "|" || strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=,") == "" {
+			quoted = append(quoted, arg)
+		} else {
+			quoted = append(quoted, "'"+strings.Replace(arg, "'", `'\''`, -1)+"'")
+		}
+	}
+	infoLog.Printf("openssl equivalent: %s", strings.Join(quoted, " "))
+}
+
+// printOpensslCreateCmds prints openssl commands (OpenSSL 3.x syntax)
+// which create an equivalent key and certificate; ca is empty for a
+// self-signed certificate
+func printOpensslCreateCmds(path string, ca string, template *x509.Certificate) {
+	keyFile := filepath.Join(path, filepath.Base(path)+".key")
+	certFile := filepath.Join(path, filepath.Base(path)+".crt")
+	days := fmt.Sprint(int(template.NotAfter.Sub(template.NotBefore).Hours()/24 + 0.5))
+
+	extensions := []string{}
+	if template.IsCA {
+		extensions = append(extensions, fmt.Sprintf("basicConstraints=critical,CA:true,pathlen:%d", template.MaxPathLen))
+	}
+	if template.KeyUsage != 0 {
+		usages := keyUsageNames(template.KeyUsage)
+		for i, usage := range usages {
+			if usage == "contentCommitment" {
+				usages[i] = "nonRepudiation"
+			}
+		}
+		extensions = append(extensions, "keyUsage=critical,"+strings.Join(usages, ","))
+	}
+	if len(template.ExtKeyUsage) > 0 {
+		usages := extKeyUsageNames(template.ExtKeyUsage)
+		for i, usage := range usages {
+			if usage == "any" {
+				usages[i] = "anyExtendedKeyUsage"
+			}
+		}
+		extensions = append(extensions, "extendedKeyUsage="+strings.Join(usages, ","))
+	}
+	sans := []string{}
+	for _, name := range template.DNSNames {
+		sans = append(sans, "DNS:"+name)
+	}
+	for _, ip := range template.IPAddresses {
+		sans = append(sans, "IP:"+ip.String())
+	}
+	for _, email := range template.EmailAddresses {
+		sans = append(sans, "email:"+email)
+	}
+	if len(sans) > 0 {
+		critical := ""
+		for _, extension := range template.ExtraExtensions {
+			if extension.Id.Equal(oidSubjectAltName) && extension.Critical {
+				critical = "critical,"
+			}
+		}
+		extensions = append(extensions, "subjectAltName="+critical+strings.Join(sans, ","))
+	}
+
+	printOpensslCmd("openssl", "ecparam", "-name", "secp384r1", "-genkey", "-noout", "-out", keyFile)
+	req := []string{"openssl", "req", "-new", "-key", keyFile, "-subj", formatDn(template.Subject)}
+	for _, extension := range extensions {
+		req = append(req, "-addext", extension)
+	}
+	if ca == "" {
+		printOpensslCmd(append(req, "-x509", "-sha384", "-days", days, "-out", certFile)...)
+		return
+	}
+	caName := filepath.Join(ca, filepath.Base(ca))
+	printOpensslCmd(append(req, "|", "openssl", "x509", "-req", "-CA", caName+".crt", "-CAkey", caName+".key",
+		"-sha384", "-days", days, "-copy_extensions", "copyall", "-out", certFile)...)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPrintOpensslCmd(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"ca", []string{"ca", "-dn=/CN=other root", "other"}, []string{
+			"openssl ecparam -name secp384r1 -genkey -noout -out other/other.key",
+			"openssl req -new -key other/other.key -subj '/CN=other root'",
+			"-addext basicConstraints=critical,CA:true",
+			"-x509 -sha384",
+		}},
+		{"server", []string{"server", "-dn=/CN=www", "-san=www.example.com,10.0.0.2", "ca/www"}, []string{
+			"openssl req -new -key ca/www/www.key -subj /CN=www",
+			"-addext subjectAltName=DNS:www.example.com,IP:10.0.0.2",
+			"| openssl x509 -req -CA ca/ca.crt -CAkey ca/ca.key",
+		}},
+		{"p12 export", []string{"export", "-p12", "-password=secret", "ca/ica/server"}, []string{
+			"openssl pkcs12 -export",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argsFile := fakeOpenssl(t, "")
+			args := append([]string{tt.args[0], "-print-openssl-cmd"}, tt.args[1:]...)
+			res := runCertshop(t, dir, nil, args...)
+			if res.code != 0 {
+				t.Fatalf("certshop failed: %s", res.stderr)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(res.stderr, want) {
+					t.Errorf("%q isn't printed in:\n%s", want, res.stderr)
+				}
+			}
+			if tt.args[0] != "export" {
+				return
+			}
+			// the printed command is the one that was run
+			ran, err := os.ReadFile(argsFile)
+			if err != nil {
+				t.Fatalf("openssl wasn't run: %s", err)
+			}
+			if want := "openssl equivalent: openssl " + strings.TrimSpace(string(ran)) + "\n"; !strings.Contains(res.stderr, want) {
+				t.Errorf("the printed command isn't %q:\n%s", want, res.stderr)
+			}
+		})
+	}
+}
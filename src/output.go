@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// checkOutputFiles fails if the "-key-out" or "-cert-out" files exist
+// and may not be overwritten; like the key in the tree, an existing key
+// file also needs "-overwrite-keys"
+func checkOutputFiles(keyOut string, certOut string, overwrite bool, overwriteKeys bool) {
+	for _, fileName := range []string{certOut, keyOut} {
+		if fileName == "" {
+			continue
+		}
+		if _, err := os.Stat(fileName); err != nil {
+			continue
+		}
+		if !overwrite {
+			errorLog.Fatalf("Skipping creation because file %s already exists.\nUse the \"-overwrite\" option to overwrite the existing file.", fileName)
+		} else if fileName == keyOut && !overwriteKeys {
+			errorLog.Fatalf("Skipping creation because the private key %s already exists.\nUse the \"-overwrite-keys\" option (as well as \"-overwrite\") to replace the existing key.", fileName)
+		}
+		confirm("Overwrite "+fileName+"?", "overwrite "+fileName)
+	}
+}
+
+// copyOutputFiles copies the certificate (with its chain) and private key
+// of path to the "-cert-out" and "-key-out" files for deployment tools
+// which expect them in separate locations (ie. /etc/ssl/certs and
+// /etc/ssl/private)
+func copyOutputFiles(path string, keyOut string, certOut string) {
+	base := filepath.Join(path, filepath.Base(path))
+	for _, output := range []struct {
+		source, dest string
+		perms        os.FileMode
+	}{{base + ".crt", certOut, publicPerms}, {base + ".key", keyOut, privatePerms}} {
+		if output.dest == "" {
+			continue
+		}
+		createDirectory(filepath.Dir(output.dest))
+		copyFile(output.source, output.dest, output.perms)
+		// OpenFile only applies perms to new files
+		if err := os.Chmod(output.dest, output.perms); err != nil {
+			errorLog.Fatalf("Failed to set permissions of %s: %s", output.dest, err)
+		}
+		infoLog.Printf("Saved %s\n", output.dest)
+	}
+}
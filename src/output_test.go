@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyCertOut(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		name    string
+		command []string
+		path    string
+	}{
+		{"server", []string{"server", "-san=web.example.com"}, "ca/ica/web"},
+		{"ica", []string{"ica"}, "ca/sub"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "etc/ssl")
+			keyOut := filepath.Join(out, "private", tt.name+".key")
+			certOut := filepath.Join(out, "certs", tt.name+".crt")
+			certshop(t, dir, append(tt.command, "-key-out="+keyOut, "-cert-out="+certOut, tt.path)...)
+			base := filepath.Join(dir, tt.path, filepath.Base(tt.path))
+			for _, file := range []struct {
+				source, dest string
+				perms        os.FileMode
+			}{{base + ".crt", certOut, publicPerms}, {base + ".key", keyOut, privatePerms}} {
+				info, err := os.Stat(file.dest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != file.perms {
+					t.Errorf("%s has permissions %v, want %v", file.dest, info.Mode().Perm(), file.perms)
+				}
+				want, err := os.ReadFile(file.source)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, err := os.ReadFile(file.dest); err != nil || !bytes.Equal(got, want) {
+					t.Errorf("%s isn't a copy of %s", file.dest, file.source)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyCertOutExisting(t *testing.T) {
+	dir := newTree(t)
+	keyOut := filepath.Join(dir, "web.key")
+	certOut := filepath.Join(dir, "web.crt")
+	for _, fileName := range []string{keyOut, certOut} {
+		if err := os.WriteFile(fileName, []byte("existing"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"certificate", []string{"-cert-out=" + certOut}, "Use the \"-overwrite\" option"},
+		{"key", []string{"-key-out=" + keyOut}, "Use the \"-overwrite\" option"},
+		{"key without overwrite-keys", []string{"-key-out=" + keyOut, "-overwrite", "-yes"}, "Use the \"-overwrite-keys\" option"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := runCertshop(t, dir, nil, append(append([]string{"server"}, tt.args...), "ca/ica/web")...)
+			if res.code == 0 || !strings.Contains(res.stderr, tt.err) {
+				t.Errorf("got status %d, want an error with %q:\n%s", res.code, tt.err, res.stderr)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "ca/ica/web")); !os.IsNotExist(err) {
+				t.Errorf("ca/ica/web was created")
+			}
+		})
+	}
+
+	certshop(t, dir, "server", "-cert-out="+certOut, "-key-out="+keyOut, "-overwrite", "-overwrite-keys", "-yes", "ca/ica/web")
+	if info, err := os.Stat(keyOut); err != nil || info.Mode().Perm() != privatePerms {
+		t.Errorf("the overwritten key file doesn't have permissions %v", privatePerms)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+)
+
+// parseP12 runs openssl to extract the certificate, private key and
+// any ca certificates from a pkcs12 file; chain is the pem encoded
+// certificate followed by the ca certificates
+func parseP12(fileName string, password string) (cert *x509.Certificate, key crypto.Signer, chain []byte) {
+	out := readP12(fileName, password)
+
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, out = pem.Decode(out)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			c, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				errorLog.Fatalf("Failed to parse certificate in %s: %s", fileName, err)
+			}
+			certs = append(certs, c)
+		case "PRIVATE KEY":
+			k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				errorLog.Fatalf("Failed to parse private key in %s: %s", fileName, err)
+			}
+			var ok bool
+			if key, ok = k.(crypto.Signer); !ok {
+				errorLog.Fatalf("Unsupported private key type in %s", fileName)
+			}
+		}
+	}
+	if key == nil {
+		errorLog.Fatalf("No private key found in %s", fileName)
+	}
+
+	// the certificate is the one matching the private key, and the rest
+	// are the ca chain
+	var others []*x509.Certificate
+	for _, c := range certs {
+		if cert == nil && publicKeysEqual(c.PublicKey, key.Public()) {
+			cert = c
+		} else {
+			others = append(others, c)
+		}
+	}
+	if cert == nil {
+		errorLog.Fatalf("No certificate matching the private key found in %s", fileName)
+	}
+	buf := new(bytes.Buffer)
+	for _, c := range append([]*x509.Certificate{cert}, others...) {
+		if err := pem.Encode(buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}); err != nil {
+			errorLog.Fatalf("Failed to marshall certificate chain: %s", err)
+		}
+	}
+	return cert, key, buf.Bytes()
+}
+
+// rootOfChain returns the pem encoded root certificate of a chain (the
+// self-signed certificate, or the last certificate if none are)
+func rootOfChain(chain []byte) []byte {
+	var last *pem.Block
+	for {
+		var block *pem.Block
+		block, chain = pem.Decode(chain)
+		if block == nil {
+			break
+		}
+		last = block
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil && isSelfSigned(cert) {
+			break
+		}
+	}
+	return pem.EncodeToMemory(last)
+}
+
+func publicKeysEqual(a crypto.PublicKey, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
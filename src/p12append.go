@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// friendlyNamePattern finds the alias in the bag attributes which
+// openssl prints before each pem block
+var friendlyNamePattern = regexp.MustCompile(`friendlyName: (.*)`)
+
+// p12Entry is a certificate in a pkcs12 file with its alias
+type p12Entry struct {
+	cert  *x509.Certificate
+	alias string
+}
+
+// readP12 runs openssl to print the contents of a pkcs12 file with the
+// private key unencrypted, retrying with legacy algorithms for files
+// from older systems
+func readP12(fileName string, password string) []byte {
+	infoLog.Printf("Running openssl to read %s\n", fileName)
+	args := []string{"pkcs12", "-in", fileName, "-nodes", "-passin", "stdin"}
+	out, err := runOpenssl(args, password)
+	if e, ok := err.(*opensslError); ok && e.unsupported() {
+		// pkcs12 files from older systems use RC2 or 3DES which OpenSSL
+		// 3.x only supports with the legacy provider
+		infoLog.Printf("Retrying openssl with legacy algorithms enabled to read %s\n", fileName)
+		out, err = runOpenssl(append(args, "-legacy"), password)
+	}
+	if err != nil {
+		errorLog.Fatalf("Error running openssl to read %s: %s", fileName, err)
+	}
+	return out
+}
+
+// p12PasswordVar is the environment variable which passes the export
+// password to openssl when stdin holds the pkcs12 contents
+const p12PasswordVar = "CERTSHOP_P12_PASSWORD"
+
+// p12AppendArgs returns the openssl arguments to re-export the pkcs12
+// file with the certificates of chain added after its own entries, and
+// the pem input (private key, certificate and other certificates) to
+// write to openssl's stdin so the unencrypted key never touches the
+// disk; certificates already in the file are skipped and new aliases
+// are made unique
+func p12AppendArgs(fileName string, password string, chain []byte, alias string) ([]string, []byte) {
+	out := readP12(fileName, password)
+	var keyBlock *pem.Block
+	var key crypto.Signer
+	entries := []p12Entry{}
+	for {
+		start := bytes.Index(out, []byte("-----BEGIN "))
+		if start < 0 {
+			break
+		}
+		entryAlias := ""
+		if match := friendlyNamePattern.FindSubmatch(out[:start]); match != nil {
+			entryAlias = strings.TrimSpace(string(match[1]))
+		}
+		var block *pem.Block
+		block, out = pem.Decode(out[start:])
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				errorLog.Fatalf("Failed to parse certificate in %s: %s", fileName, err)
+			}
+			entries = append(entries, p12Entry{cert: cert, alias: entryAlias})
+		case "PRIVATE KEY":
+			k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				errorLog.Fatalf("Failed to parse private key in %s: %s", fileName, err)
+			}
+			var ok bool
+			if key, ok = k.(crypto.Signer); !ok {
+				errorLog.Fatalf("Unsupported private key type in %s", fileName)
+			}
+			keyBlock = block
+		}
+	}
+	if key == nil {
+		errorLog.Fatalf("No private key found in %s (only pkcs12 files with a key entry can be appended to)", fileName)
+	}
+
+	var leaf *p12Entry
+	others := []p12Entry{}
+	seen := map[[sha256.Size]byte]bool{}
+	used := map[string]bool{}
+	for i, entry := range entries {
+		seen[sha256.Sum256(entry.cert.Raw)] = true
+		used[entry.alias] = true
+		if leaf == nil && publicKeysEqual(entry.cert.PublicKey, key.Public()) {
+			leaf = &entries[i]
+		} else {
+			others = append(others, entry)
+		}
+	}
+	if leaf == nil {
+		errorLog.Fatalf("No certificate matching the private key found in %s", fileName)
+	}
+
+	uniqueAlias := func(alias string) string {
+		unique := alias
+		for i := 2; used[unique]; i++ {
+			unique = fmt.Sprintf("%s-%d", alias, i)
+		}
+		used[unique] = true
+		return unique
+	}
+	// -caname applies to the certificates in order, so entries without
+	// an alias are named after their common name rather than left blank
+	for i := range others {
+		if others[i].alias == "" {
+			others[i].alias = uniqueAlias(others[i].cert.Subject.CommonName)
+		}
+	}
+
+	added := 0
+	for _, cert := range parseCertsPem(chain) {
+		if seen[sha256.Sum256(cert.Raw)] {
+			infoLog.Printf("Skipping %s which is already in %s\n", formatDn(cert.Subject), fileName)
+			continue
+		}
+		seen[sha256.Sum256(cert.Raw)] = true
+		newAlias := alias
+		if added > 0 && cert.Subject.CommonName != "" {
+			newAlias = cert.Subject.CommonName
+		}
+		unique := uniqueAlias(newAlias)
+		if unique != newAlias {
+			infoLog.Printf("Renaming the %s entry to %s because %s is already used in %s\n", formatDn(cert.Subject), unique, newAlias, fileName)
+		}
+		others = append(others, p12Entry{cert: cert, alias: unique})
+		added++
+	}
+	infoLog.Printf("Appending %d certificates to the %d entries of %s\n", added, len(entries), fileName)
+
+	// openssl reads the key from stdin before the certificates (the leaf
+	// first, so it gets "-name"), so the key must come first
+	input := pem.EncodeToMemory(keyBlock)
+	input = append(input, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.cert.Raw})...)
+	for _, entry := range others {
+		input = append(input, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: entry.cert.Raw})...)
+	}
+
+	args := []string{"pkcs12", "-export", "-passout", "env:" + p12PasswordVar}
+	if leaf.alias != "" {
+		args = append(args, "-name", leaf.alias)
+	}
+	// openssl gives the -caname values to the other certificates in order
+	for _, entry := range others {
+		args = append(args, "-caname", entry.alias)
+	}
+	return args, input
+}
+
+// parseCertsPem parses the certificates in pem data
+func parseCertsPem(data []byte) []*x509.Certificate {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			errorLog.Fatalf("Failed to parse certificate: %s", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
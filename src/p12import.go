@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pfxHeader is the start of a pkcs12 PFX structure (RFC 7292), enough to
+// recognise a pkcs12 file without decrypting it
+type pfxHeader struct {
+	Version  int
+	AuthSafe asn1.RawValue
+	MacData  asn1.RawValue `asn1:"optional"`
+}
+
+// isPKCS12File reports whether fileName is a regular file containing a
+// der encoded pkcs12 (version 3) structure rather than a tree directory
+func isPKCS12File(fileName string) bool {
+	info, err := os.Stat(fileName)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		errorLog.Fatalf("Failed to read %s: %s", fileName, err)
+	}
+	header := pfxHeader{}
+	rest, err := asn1.Unmarshal(data, &header)
+	return err == nil && len(rest) == 0 && header.Version == 3
+}
+
+// p12TreeName is the certificate name of a pkcs12 file, its file name
+// without the .p12 or .pfx extension
+func p12TreeName(fileName string) string {
+	name := filepath.Base(fileName)
+	if ext := strings.ToLower(filepath.Ext(name)); ext == ".p12" || ext == ".pfx" {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name
+}
+
+// p12Tree is the contents of a pkcs12 file in the tree layout: the
+// certificate followed by the ca certificates of the file, the private
+// key, and the self-signed root (nil when the file doesn't include it)
+type p12Tree struct {
+	chain []byte
+	key   []byte
+	ca    []byte
+}
+
+// readP12Tree extracts a pkcs12 file in the tree layout; ecdsa keys are
+// saved in sec1 format like the rest of the tree and other keys (ie.
+// rsa) in pkcs8 format
+func readP12Tree(fileName string, password string) p12Tree {
+	infoLog.Printf("Reading pkcs12 file %s\n", fileName)
+	cert, key, chain := parseP12(fileName, password)
+	certs := parseCertsPem(chain)
+	infoLog.Printf("Found %s with %d ca certificates in %s\n", formatDn(cert.Subject), len(certs)-1, fileName)
+
+	var keyBlock *pem.Block
+	if ecKey, ok := key.(*ecdsa.PrivateKey); ok {
+		der, err := x509.MarshalECPrivateKey(ecKey)
+		if err != nil {
+			errorLog.Fatalf("Failed to marshal private key in %s: %s", fileName, err)
+		}
+		keyBlock = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			errorLog.Fatalf("Failed to marshal private key in %s: %s", fileName, err)
+		}
+		keyBlock = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	tree := p12Tree{chain: chain, key: pem.EncodeToMemory(keyBlock)}
+	if root := certs[len(certs)-1]; isSelfSigned(root) {
+		tree.ca = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+	} else {
+		infoLog.Printf("%s doesn't include its root certificate, so there is no ca.pem\n", fileName)
+	}
+	return tree
+}
+
+// save writes the tree layout files to directory
+func (t p12Tree) save(directory string) {
+	t.saveCerts(directory)
+	writeFile(filepath.Join(directory, filepath.Base(directory)+".key"), t.key, privatePerms)
+}
+
+// saveCerts writes the tree layout files to directory except for the
+// private key
+func (t p12Tree) saveCerts(directory string) {
+	createDirectory(directory)
+	writeFile(filepath.Join(directory, filepath.Base(directory)+".crt"), t.chain, publicPerms)
+	if t.ca != nil {
+		writeFile(filepath.Join(directory, "ca.pem"), t.ca, publicPerms)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestP12RoundTrip(t *testing.T) {
+	dir := newTree(t)
+	p12File := exportP12(t, dir, "ca/ica/server", "secret")
+	key := parseKey(filepath.Join(dir, "ca/ica/server"))
+	chain := parseCertsPem([]byte(readFile(filepath.Join(dir, "ca/ica/server/server.crt"))))
+	root := readCert(t, filepath.Join(dir, "ca/ca.crt"))
+
+	// openssl lists any key files in the temporary directory while it
+	// runs, since the key of the pkcs12 file must only be kept in memory
+	real, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl isn't installed")
+	}
+	keyLog := filepath.Join(t.TempDir(), "keys")
+	installOpenssl(t, "find \"$TMPDIR\" -name '*.key' >> '"+keyLog+"'\nexec '"+real+"' \"$@\"\n")
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	tests := []struct {
+		name     string
+		args     []string
+		password string
+	}{
+		{"pem", nil, ""},
+		{"pkcs8", []string{"-key-encoding=pkcs8"}, ""},
+		{"openssh", []string{"-key-encoding=openssh", "-pass-out=other"}, "other"},
+		{"p12", []string{"-p12", "-password=other"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"export", "-pass-in=secret"}, tt.args...)
+			entries := readTgz(t, certshop(t, dir, append(args, p12File)...))
+			if tt.name == "p12" {
+				// the new pkcs12 file is exported again to check its contents
+				reexported := filepath.Join(dir, "reexported.p12")
+				if err := os.WriteFile(reexported, entries["server.p12"], 0600); err != nil {
+					t.Fatal(err)
+				}
+				defer os.Remove(reexported)
+				entries = readTgz(t, certshop(t, dir, "export", "-pass-in=other", reexported))
+				entries["server.crt"], entries["server.key"] = entries["reexported.crt"], entries["reexported.key"]
+			}
+			certs := parseCertsPem(entries["server.crt"])
+			if len(certs) != len(chain) {
+				t.Fatalf("got %d certificates, want %d", len(certs), len(chain))
+			}
+			for i := range certs {
+				if !certs[i].Equal(chain[i]) {
+					t.Errorf("certificate %d is %s, want %s", i, formatDn(certs[i].Subject), formatDn(chain[i].Subject))
+				}
+			}
+			if got := parseKeyData("server.key", entries["server.key"], tt.password); !got.Equal(key) {
+				t.Errorf("the exported key is a different key")
+			}
+			if ca := parseCertsPem(entries["ca.pem"]); len(ca) != 1 || !ca[0].Equal(root) {
+				t.Errorf("ca.pem isn't the root certificate")
+			}
+			if files, err := os.ReadDir(tmp); err != nil || len(files) > 0 {
+				t.Errorf("temporary files were left behind: %v", files)
+			}
+		})
+	}
+	if keys, err := os.ReadFile(keyLog); err != nil || len(keys) > 0 {
+		t.Errorf("the private key was written to the temporary directory: %q", keys)
+	}
+}
+
+func TestP12TreeOut(t *testing.T) {
+	dir := newTree(t)
+	p12File := exportP12(t, dir, "ca/ica/server", "secret")
+	certshop(t, dir, "export", "-pass-in=secret", "-tree-out=imported/server", p12File)
+	for _, file := range []struct {
+		name  string
+		perms os.FileMode
+	}{{"server.crt", publicPerms}, {"server.key", privatePerms}, {"ca.pem", publicPerms}} {
+		info, err := os.Stat(filepath.Join(dir, "imported/server", file.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != file.perms {
+			t.Errorf("%s has permissions %v, want %v", file.name, info.Mode().Perm(), file.perms)
+		}
+	}
+	if !parseKey(filepath.Join(dir, "imported/server")).Equal(parseKey(filepath.Join(dir, "ca/ica/server"))) {
+		t.Errorf("the imported key is a different key")
+	}
+	certshop(t, dir, "verify", "imported/server")
+}
+
+func TestP12ExportInvalidFlags(t *testing.T) {
+	dir := newTree(t)
+	p12File := exportP12(t, dir, "ca/ica/server", "secret")
+	// nothing is extracted before the flags are checked
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"key encoding", []string{"-key-encoding=der"}, "Invalid key encoding der"},
+		{"archive format", []string{"-archive-format=rar"}, "Invalid archive format rar"},
+		{"chain order", []string{"-chain-order=random"}, "Invalid chain order random"},
+		{"p12 password", []string{"-p12"}, "A password is required"},
+		{"pass-out", []string{"-pass-out=other"}, "only supported with \"-key-encoding=openssh\""},
+		{"owner", []string{"-owner=0:0", "-archive-format=zip"}, "only supported with \"-archive-format=tgz\""},
+		{"wrong password", []string{"-pass-in=wrong"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"export", "-pass-in=secret"}, tt.args...)
+			res := runCertshop(t, dir, nil, append(args, p12File)...)
+			if res.code == 0 || !strings.Contains(res.stderr, tt.err) {
+				t.Errorf("got status %d, want an error with %q:\n%s", res.code, tt.err, res.stderr)
+			}
+			if len(res.stdout) > 0 {
+				t.Errorf("%d bytes were written to stdout", len(res.stdout))
+			}
+			if files, err := os.ReadDir(tmp); err != nil || len(files) > 0 {
+				t.Errorf("temporary files were left behind: %v", files)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/asn1"
+	"encoding/pem"
+)
+
+var oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+var oidData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []asn1.RawValue `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+// marshalP7b encodes pem encoded certificates as a "degenerate" pkcs7
+// SignedData structure with no signers (a .p7b certificate bundle)
+func marshalP7b(certs []byte) []byte {
+	raw := []byte{}
+	for {
+		var block *pem.Block
+		block, certs = pem.Decode(certs)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			raw = append(raw, block.Bytes...)
+		}
+	}
+	signedData, err := asn1.Marshal(pkcs7SignedData{
+		Version:      1,
+		ContentInfo:  pkcs7ContentInfo{ContentType: oidData},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw},
+	})
+	if err != nil {
+		errorLog.Fatalf("Failed to marshall pkcs7 signed data: %s", err)
+	}
+	der, err := asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+	if err != nil {
+		errorLog.Fatalf("Failed to marshall pkcs7 content info: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"encoding/pem"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestExportP7b(t *testing.T) {
+	dir := newTree(t)
+	entries := readTgz(t, certshop(t, dir, "export", "-p7b", "ca/ica/server"))
+	p7b := entries["server.p7b"]
+	if block, _ := pem.Decode(p7b); block == nil || block.Type != "PKCS7" {
+		t.Fatalf("server.p7b isn't a pem encoded pkcs7 file:\n%s", p7b)
+	}
+	if bytes.Contains(p7b, []byte("PRIVATE KEY")) {
+		t.Error("server.p7b includes the private key")
+	}
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl isn't installed")
+	}
+	cmd := exec.Command("openssl", "pkcs7", "-print_certs", "-noout")
+	cmd.Stdin = bytes.NewReader(p7b)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("openssl can't read server.p7b: %s\n%s", err, out)
+	}
+	// openssl 1.x prints "subject=/CN=root" and 3.x "subject=CN = root"
+	printed := strings.NewReplacer(" ", "", "=/", "=").Replace(string(out))
+	for _, subject := range []string{"subject=CN=server", "subject=CN=ica", "subject=CN=root"} {
+		if !strings.Contains(printed, subject) {
+			t.Errorf("%s isn't in the certificates printed by openssl:\n%s", subject, out)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+)
+
+// MaxSerialNumberOctets is the longest serial number allowed by RFC 5280
+const MaxSerialNumberOctets = 20
+
+// SerialNumberLimit is the default upper bound of new serial numbers
+// (128 bits, well within MaxSerialNumberOctets)
+var SerialNumberLimit = new(big.Int).Lsh(big.NewInt(1), 128)
+
+// NewSerialNumber returns a random positive serial number below limit
+// (zero is drawn again because RFC 5280 forbids it)
+func NewSerialNumber(random io.Reader, limit *big.Int) (*big.Int, error) {
+	for {
+		serialNumber, err := rand.Int(random, limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate serial number: %w", err)
+		}
+		if serialNumber.Sign() > 0 {
+			return serialNumber, nil
+		}
+	}
+}
+
+// CheckSerialNumber returns an error unless the serial number is
+// positive and at most MaxSerialNumberOctets when der encoded, as
+// required by RFC 5280 (strict validators reject other certificates)
+func CheckSerialNumber(serialNumber *big.Int) error {
+	if serialNumber == nil || serialNumber.Sign() <= 0 {
+		return fmt.Errorf("invalid serial number %v: must be positive and non-zero", serialNumber)
+	}
+	// der integers need a leading zero octet when the high bit is set
+	if octets := serialNumber.BitLen()/8 + 1; octets > MaxSerialNumberOctets {
+		return fmt.Errorf("invalid serial number %s: %d octets is longer than the maximum of %d", serialNumber.Text(16), octets, MaxSerialNumberOctets)
+	}
+	return nil
+}
+
+// Sign checks the serial number of template and returns the der
+// certificate for the public key pub signed by parent with signer
+// (parent is template itself for a self signed certificate)
+func Sign(random io.Reader, template *x509.Certificate, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) ([]byte, error) {
+	if err := CheckSerialNumber(template.SerialNumber); err != nil {
+		return nil, err
+	}
+	return x509.CreateCertificate(random, template, parent, pub, signer)
+}
+
+// ParseCertificates parses every certificate in pem data (ie. a
+// certificate followed by the certificates of its ca chain), skipping
+// other pem blocks
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
+
+// NormalizePEM re-encodes the certificates in a pem bundle so that each
+// block ends with a single newline and nothing (ie. comments, blank
+// lines or a missing final newline) is left between them
+func NormalizePEM(data []byte) []byte {
+	normalized := []byte{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			normalized = append(normalized, pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes})...)
+		}
+	}
+	return normalized
+}
+
+// WriteCertificate writes the der certificate followed by the pem ca
+// chain to the certificate file of the existing folder dir
+func WriteCertificate(dir string, der []byte, chain []byte) (err error) {
+	fileName := CertFile(dir)
+	certFile, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, PublicPerms)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := certFile.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	if err = pem.Encode(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		return err
+	}
+	if _, err = certFile.Write(NormalizePEM(chain)); err != nil {
+		return err
+	}
+	return certFile.Sync()
+}
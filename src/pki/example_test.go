@@ -0,0 +1,71 @@
+package pki_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+
+	"github.com/varasys/certshop/pki"
+)
+
+// Example creates a root ca, an intermediate ca and a server
+// certificate, and exports the server certificate like "certshop
+// export" does
+func Example() {
+	dir, err := os.MkdirTemp("", "pki")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tree := pki.Tree{Dir: dir}
+
+	if _, err = tree.Create("ca", pki.Request{Subject: pkix.Name{CommonName: "root"}, IsCA: true, MaxPathLen: 1}); err != nil {
+		log.Fatal(err)
+	}
+	if _, err = tree.Create("ca/ica", pki.Request{Subject: pkix.Name{CommonName: "ica"}, IsCA: true}); err != nil {
+		log.Fatal(err)
+	}
+	server, err := tree.Create("ca/ica/server", pki.Request{
+		Subject:     pkix.Name{CommonName: "server"},
+		DNSNames:    []string{"server.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(server.Cert.Subject.CommonName, "issued by", server.Chain[0].Subject.CommonName, "with root", server.Root.Subject.CommonName)
+
+	archive := new(bytes.Buffer)
+	if err = tree.Export(archive, "ca/ica/server", true); err != nil {
+		log.Fatal(err)
+	}
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(header.Name)
+	}
+	// Output:
+	// server issued by ica with root root
+	// server.crt
+	// cert.pem
+	// server.key
+	// key.pem
+	// ca.pem
+}
@@ -0,0 +1,55 @@
+package pki
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Export writes a tgz archive of the certificate path to w with the
+// same entries as "certshop export": <name>.crt (hard linked as
+// cert.pem), <name>.key (hard linked as key.pem) if includeKey is set,
+// and ca.pem
+func (t Tree) Export(w io.Writer, path string, includeKey bool) (err error) {
+	dir := t.path(path)
+	name := filepath.Base(dir)
+	type entry struct {
+		fileName, name, link string
+		mode                 os.FileMode
+	}
+	entries := []entry{{CertFile(dir), name + ".crt", "cert.pem", PublicPerms}}
+	if includeKey {
+		entries = append(entries, entry{KeyFile(dir), name + ".key", "key.pem", PrivatePerms})
+	}
+	entries = append(entries, entry{CAFile(dir), "ca.pem", "", PublicPerms})
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	defer func() {
+		err = errors.Join(err, tw.Close(), gz.Close())
+	}()
+	now := time.Now()
+	for _, e := range entries {
+		data, err := os.ReadFile(e.fileName)
+		if err != nil {
+			return err
+		}
+		if err = tw.WriteHeader(&tar.Header{Name: e.name, Mode: int64(e.mode), ModTime: now, Size: int64(len(data))}); err != nil {
+			return fmt.Errorf("failed to write %s: %w", e.name, err)
+		}
+		if _, err = tw.Write(data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", e.name, err)
+		}
+		if e.link != "" {
+			if err = tw.WriteHeader(&tar.Header{Name: e.link, Mode: int64(e.mode), ModTime: now, Linkname: e.name, Typeflag: tar.TypeLink}); err != nil {
+				return fmt.Errorf("failed to write %s: %w", e.link, err)
+			}
+		}
+	}
+	return nil
+}
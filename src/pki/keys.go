@@ -0,0 +1,68 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+)
+
+// GenerateKey returns a new P-384 private key, the curve of every key
+// certshop creates
+func GenerateKey(random io.Reader) (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P384(), random)
+}
+
+// EncodePrivateKey returns the sec1 ("EC PRIVATE KEY") pem encoding of
+// the key
+func EncodePrivateKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParsePrivateKey parses a sec1 ("EC PRIVATE KEY") or pkcs8 ("PRIVATE
+// KEY") pem block holding an ecdsa private key
+func ParsePrivateKey(block *pem.Block) (*ecdsa.PrivateKey, error) {
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		pkcs8, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := pkcs8.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T (only ecdsa keys are supported)", pkcs8)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported pem block type %s", block.Type)
+}
+
+// WriteKey writes the pem private key to the key file of the existing
+// folder dir, which is only readable by the current user (also when an
+// existing key with looser permissions is overwritten)
+func WriteKey(dir string, data []byte) (err error) {
+	keyFile, err := os.OpenFile(KeyFile(dir), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, PrivatePerms)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := keyFile.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	// OpenFile only applies PrivatePerms to new files
+	if err = keyFile.Chmod(PrivatePerms); err != nil {
+		return err
+	}
+	_, err = keyFile.Write(data)
+	return err
+}
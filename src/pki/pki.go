@@ -0,0 +1,257 @@
+// Package pki creates, reads and exports the certificates of a certshop
+// tree, so other Go programs can do what the certshop command does.
+//
+// Each certificate lives in a folder named after it, which holds
+// <name>.crt (the certificate followed by its ca chain), <name>.key (the
+// private key) and ca.pem (the root certificate); the certificate in the
+// parent folder is its signing ca, and a top level folder holds a self
+// signed root ca. Unlike the certshop command the functions return
+// errors instead of exiting, and the paths of a Tree are relative to its
+// Dir rather than the working directory.
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DirPerms, PublicPerms and PrivatePerms are the permissions of the
+// folders, certificates and private keys of a tree
+const (
+	DirPerms     os.FileMode = 0755
+	PublicPerms  os.FileMode = 0644
+	PrivatePerms os.FileMode = 0600
+)
+
+// DefaultValidity is the validity of a certificate whose Request has no
+// Validity
+const DefaultValidity = 365 * 24 * time.Hour
+
+// CertFile, KeyFile and CAFile return the certificate, private key and
+// root certificate files of the certificate folder dir
+func CertFile(dir string) string { return filepath.Join(dir, filepath.Base(dir)+".crt") }
+func KeyFile(dir string) string  { return filepath.Join(dir, filepath.Base(dir)+".key") }
+func CAFile(dir string) string   { return filepath.Join(dir, "ca.pem") }
+
+// Tree is a certshop tree in the folder Dir (the working directory if
+// it is empty)
+type Tree struct {
+	Dir string
+}
+
+// Certificate is a certificate of a tree with its ca chain and private
+// key
+type Certificate struct {
+	// Path is the folder of the certificate relative to the tree
+	Path string
+	Cert *x509.Certificate
+	// Chain is the ca chain of Cert (starting with its issuer), which is
+	// empty for a root ca
+	Chain []*x509.Certificate
+	Root  *x509.Certificate
+	// Key is nil if the private key isn't in the tree (ie. a root ca
+	// whose key was moved offline)
+	Key *ecdsa.PrivateKey
+}
+
+// Request describes a certificate to create
+type Request struct {
+	Subject        pkix.Name
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	// IsCA creates a certificate authority; MaxPathLen is only used for a
+	// root ca, since the path length of an intermediate ca is one less
+	// than its signing ca's
+	IsCA       bool
+	MaxPathLen int
+	// KeyUsage defaults to digitalSignature, and keyCertSign for a ca
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
+	// NotBefore defaults to the current time and Validity to
+	// DefaultValidity
+	NotBefore time.Time
+	Validity  time.Duration
+	// Key is the private key to certify (a new key is generated if it is
+	// nil)
+	Key *ecdsa.PrivateKey
+}
+
+// path returns the folder of the certificate path
+func (t Tree) path(path string) string {
+	return filepath.Join(t.Dir, filepath.Clean(path))
+}
+
+// Create creates the certificate path in the tree, signed by the
+// certificate authority in the parent folder (or self signed if path is
+// a top level folder), and fails if the certificate already exists
+func (t Tree) Create(path string, req Request) (*Certificate, error) {
+	path = filepath.Clean(path)
+	dir := t.path(path)
+	for _, fileName := range []string{CertFile(dir), KeyFile(dir), CAFile(dir)} {
+		if _, err := os.Stat(fileName); err == nil {
+			return nil, fmt.Errorf("%s already exists", fileName)
+		}
+	}
+
+	key := req.Key
+	if key == nil {
+		var err error
+		if key, err = GenerateKey(rand.Reader); err != nil {
+			return nil, fmt.Errorf("failed to generate private key: %w", err)
+		}
+	}
+	serialNumber, err := NewSerialNumber(rand.Reader, SerialNumberLimit)
+	if err != nil {
+		return nil, err
+	}
+	notBefore, validity := req.NotBefore, req.Validity
+	if notBefore.IsZero() {
+		notBefore = time.Now()
+	}
+	if validity == 0 {
+		validity = DefaultValidity
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               req.Subject,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(validity),
+		BasicConstraintsValid: true,
+		IsCA:                  req.IsCA,
+		KeyUsage:              req.KeyUsage,
+		ExtKeyUsage:           req.ExtKeyUsage,
+		DNSNames:              req.DNSNames,
+		IPAddresses:           req.IPAddresses,
+		EmailAddresses:        req.EmailAddresses,
+	}
+	if template.KeyUsage == 0 {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		if req.IsCA {
+			template.KeyUsage |= x509.KeyUsageCertSign
+		}
+	}
+
+	var parent *x509.Certificate
+	var parentKey *ecdsa.PrivateKey
+	var chain []byte
+	if filepath.Dir(path) == "." {
+		if !req.IsCA {
+			return nil, fmt.Errorf("the top level certificate %s must be a certificate authority", path)
+		}
+		template.MaxPathLen, template.MaxPathLenZero = req.MaxPathLen, req.MaxPathLen == 0
+		parent, parentKey = template, key
+	} else {
+		ca, err := t.Load(filepath.Dir(path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the signing ca: %w", err)
+		}
+		if !ca.Cert.IsCA {
+			return nil, fmt.Errorf("%s is not a certificate authority", ca.Path)
+		} else if ca.Key == nil {
+			return nil, fmt.Errorf("the private key of the signing ca %s isn't in the tree", ca.Path)
+		}
+		if req.IsCA {
+			if ca.Cert.MaxPathLen <= 0 {
+				return nil, fmt.Errorf("certificate authority %s can't sign other certificate authorities (maxPathLength exceeded)", ca.Path)
+			}
+			template.MaxPathLen = ca.Cert.MaxPathLen - 1
+			template.MaxPathLenZero = template.MaxPathLen == 0
+		}
+		parent, parentKey = ca.Cert, ca.Key
+		if chain, err = os.ReadFile(CertFile(t.path(ca.Path))); err != nil {
+			return nil, err
+		}
+	}
+
+	der, err := Sign(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign %s: %w", path, err)
+	}
+	if err = os.MkdirAll(dir, DirPerms); err != nil {
+		return nil, err
+	}
+	if err = WriteCertificate(dir, der, chain); err != nil {
+		return nil, err
+	}
+	keyPem, err := EncodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = WriteKey(dir, keyPem); err != nil {
+		return nil, err
+	}
+	// ca.pem is the root certificate, which is the signing ca's ca.pem
+	root := CertFile(dir)
+	if parent != template {
+		root = CAFile(filepath.Dir(dir))
+	}
+	if err = copyRoot(root, CAFile(dir)); err != nil {
+		return nil, err
+	}
+	return t.Load(path)
+}
+
+// copyRoot writes the first certificate of the file source to dest
+func copyRoot(source string, dest string) error {
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("no certificate found in %s", source)
+	}
+	return os.WriteFile(dest, pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes}), PublicPerms)
+}
+
+// Load reads the certificate path of the tree with its chain, root
+// certificate and (if it is in the tree) private key
+func (t Tree) Load(path string) (*Certificate, error) {
+	path = filepath.Clean(path)
+	dir := t.path(path)
+	data, err := os.ReadFile(CertFile(dir))
+	if err != nil {
+		return nil, err
+	}
+	certs, err := ParseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", CertFile(dir), err)
+	}
+	cert := &Certificate{Path: path, Cert: certs[0], Chain: certs[1:]}
+
+	if data, err = os.ReadFile(CAFile(dir)); err != nil {
+		return nil, err
+	}
+	roots, err := ParseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", CAFile(dir), err)
+	}
+	cert.Root = roots[0]
+
+	data, err = os.ReadFile(KeyFile(dir))
+	if errors.Is(err, os.ErrNotExist) {
+		return cert, nil
+	} else if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no pem data found", KeyFile(dir))
+	}
+	if cert.Key, err = ParsePrivateKey(block); err != nil {
+		return nil, fmt.Errorf("%s: %w", KeyFile(dir), err)
+	} else if !cert.Key.PublicKey.Equal(cert.Cert.PublicKey) {
+		return nil, fmt.Errorf("%s doesn't match the public key of %s", KeyFile(dir), CertFile(dir))
+	}
+	return cert, nil
+}
@@ -0,0 +1,93 @@
+package pki
+
+import (
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestTreesWithDifferentDirs(t *testing.T) {
+	// the working directory is an empty folder, which must stay empty
+	cwd := t.TempDir()
+	t.Chdir(cwd)
+	trees := []struct {
+		name string
+		tree Tree
+	}{
+		{"first", Tree{Dir: t.TempDir()}},
+		{"second", Tree{Dir: t.TempDir()}},
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(trees))
+	for i, tt := range trees {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, errs[i] = tt.tree.Create("ca", Request{Subject: pkix.Name{CommonName: tt.name}, IsCA: true}); errs[i] != nil {
+				return
+			}
+			_, errs[i] = tt.tree.Create("ca/server", Request{Subject: pkix.Name{CommonName: tt.name + " server"}})
+		}()
+	}
+	wg.Wait()
+
+	for i, tt := range trees {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs[i] != nil {
+				t.Fatal(errs[i])
+			}
+			server, err := tt.tree.Load("ca/server")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if server.Root.Subject.CommonName != tt.name || server.Chain[0].Subject.CommonName != tt.name {
+				t.Errorf("ca/server is signed by %s, want %s", server.Chain[0].Subject.CommonName, tt.name)
+			}
+			if err := server.Cert.CheckSignatureFrom(server.Root); err != nil {
+				t.Errorf("ca/server isn't signed by the root of its tree: %s", err)
+			}
+			for _, fileName := range []string{"ca.crt", "ca.key", "ca.pem", "server/server.crt", "server/server.key", "server/ca.pem"} {
+				if _, err := os.Stat(filepath.Join(tt.tree.Dir, "ca", fileName)); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+	if wd, err := os.Getwd(); err != nil || wd != cwd {
+		t.Errorf("the working directory changed to %s", wd)
+	}
+	if entries, err := os.ReadDir(cwd); err != nil || len(entries) > 0 {
+		t.Errorf("files were created in the working directory: %v", entries)
+	}
+}
+
+func TestCreateErrors(t *testing.T) {
+	tree := Tree{Dir: t.TempDir()}
+	if _, err := tree.Create("ca", Request{Subject: pkix.Name{CommonName: "root"}, IsCA: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Create("ca/leaf", Request{Subject: pkix.Name{CommonName: "leaf"}}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		path string
+		req  Request
+	}{
+		{"existing", "ca", Request{IsCA: true}},
+		{"root leaf", "leaf", Request{}},
+		{"missing ca", "missing/leaf", Request{}},
+		{"leaf signer", "ca/leaf/other", Request{}},
+		{"path length", "ca/ica", Request{IsCA: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tree.Create(tt.path, tt.req); err == nil {
+				t.Errorf("%s was created", tt.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pruneCertificates removes the folders of certificates which expired
+// before runTime minus the grace period; a ca folder is only removed if
+// every certificate below it has expired too
+func pruneCertificates(args []string) {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	addCommonFlags(fs)
+	grace := fs.Duration("grace", 0, "only remove certificates which expired more than this duration ago")
+	dryRun := fs.Bool("dry-run", false, "list the folders which would be removed without removing them")
+	force := fs.Bool("force", false, "remove the folders without asking for confirmation (same as \"-yes\")")
+	auditLog, operator := addAuditFlags(fs)
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	path := "ca"
+	if len(fs.Args()) > 1 {
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+	} else if len(fs.Args()) == 1 {
+		path = fs.Arg(0)
+	}
+	if *grace < 0 {
+		errorLog.Fatalf("The \"-grace\" duration can't be negative: %s", *grace)
+	}
+	infoLog.Printf("Pruning Certificates expired before %s in %s", runTime.Add(-*grace).Format(time.RFC3339), path)
+
+	if _, err := os.Stat(path); err != nil {
+		errorLog.Fatalf("Failed to read %s: %s", path, err)
+	}
+	expired := map[string]bool{}
+	derCerts := map[string][]byte{}
+	paths := []string{}
+	defer lockTree(path)()
+	walkCertificates(path, func(path string, cert *x509.Certificate) {
+		paths = append(paths, path)
+		expired[path] = cert.NotAfter.Before(runTime.Add(-*grace))
+		derCerts[path] = cert.Raw
+	})
+	sort.Strings(paths)
+
+	remove := []string{}
+	for _, p := range paths {
+		if !expired[p] || isBelowAny(p, remove) {
+			continue
+		}
+		live := ""
+		for _, child := range paths {
+			if isBelow(child, p) && !expired[child] {
+				live = child
+				break
+			}
+		}
+		if live != "" {
+			infoLog.Printf("Keeping expired certificate authority %s because %s has not expired", p, live)
+			continue
+		}
+		remove = append(remove, p)
+	}
+
+	if len(remove) == 0 {
+		infoLog.Print("No expired certificates to remove")
+		return
+	}
+	for _, p := range remove {
+		fmt.Println(p)
+	}
+	if *dryRun {
+		infoLog.Printf("Dry run: %d folders would be removed", len(remove))
+		return
+	}
+	if !*force {
+		confirm(fmt.Sprintf("Remove %d folders listed above?", len(remove)), "prune certificates")
+	}
+	for _, p := range remove {
+		infoLog.Printf("Removing %s", p)
+		if err := os.RemoveAll(p); err != nil {
+			errorLog.Fatalf("Failed to remove %s: %s", p, err)
+		}
+		// every certificate in the folder is removed with it
+		for _, removed := range paths {
+			if removed == p || isBelow(removed, p) {
+				writeAuditLog(*auditLog, "prune", *operator, removed, derCerts[removed])
+			}
+		}
+	}
+	infoLog.Printf("Finished Pruning Certificates in %s", path)
+}
+
+// isBelow reports whether path is a sub folder of parent
+func isBelow(path string, parent string) bool {
+	rel, err := filepath.Rel(parent, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func isBelowAny(path string, parents []string) bool {
+	for _, parent := range parents {
+		if isBelow(path, parent) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCert saves a certificate expiring at notAfter in path, signed by
+// the ca in the parent folder, so tests can create expired certificates
+func writeCert(t *testing.T, dir string, path string, notAfter time.Time, isCA bool) {
+	t.Helper()
+	parent := filepath.Join(dir, filepath.Dir(path))
+	caCert, caKey := readCert(t, filepath.Join(parent, filepath.Base(parent)+".crt")), parseKey(parent)
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: filepath.Base(path)},
+		NotBefore:             notAfter.AddDate(-1, 0, 0),
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join(dir, path, filepath.Base(path))
+	if err = os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(base+".crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(base+".key", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	expired, live := time.Now().Add(-time.Hour), time.Now().AddDate(1, 0, 0)
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root", "-maxPathLength=2")
+	writeCert(t, dir, "ca/expired-leaf", expired, false)
+	writeCert(t, dir, "ca/live-leaf", live, false)
+	// an expired ca with a live child is kept along with the child
+	writeCert(t, dir, "ca/expired-ca", expired, true)
+	writeCert(t, dir, "ca/expired-ca/live-leaf", live, false)
+	writeCert(t, dir, "ca/expired-ca/expired-leaf", expired, false)
+	// a live child deeper down also keeps the ca
+	writeCert(t, dir, "ca/expired-ca2", expired, true)
+	writeCert(t, dir, "ca/expired-ca2/expired-ica", expired, true)
+	writeCert(t, dir, "ca/expired-ca2/expired-ica/live-leaf", live, false)
+	// an expired ca with only expired children is removed with them
+	writeCert(t, dir, "ca/dead-ca", expired, true)
+	writeCert(t, dir, "ca/dead-ca/expired-leaf", expired, false)
+
+	removed := []string{"ca/dead-ca", "ca/expired-ca/expired-leaf", "ca/expired-leaf"}
+	tests := []struct {
+		name    string
+		args    []string
+		listed  []string
+		removed bool
+	}{
+		{"grace", []string{"-grace=2h", "-force"}, nil, false},
+		{"dry run", []string{"-dry-run"}, removed, false},
+		{"force", []string{"-force"}, removed, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := strings.Fields(string(certshop(t, dir, append([]string{"prune"}, tt.args...)...)))
+			sort.Strings(out)
+			if strings.Join(out, ",") != strings.Join(tt.listed, ",") {
+				t.Errorf("got listed %v, want %v", out, tt.listed)
+			}
+			for _, path := range []string{"ca/live-leaf", "ca/expired-ca", "ca/expired-ca/live-leaf", "ca/expired-ca2/expired-ica/live-leaf", "ca/dead-ca", "ca/expired-leaf"} {
+				_, err := os.Stat(filepath.Join(dir, path))
+				if isRemoved := os.IsNotExist(err); isRemoved != (tt.removed && containsString(removed, path)) {
+					t.Errorf("%s removed is %t", path, isRemoved)
+				}
+			}
+		})
+	}
+}
+
+func TestIsBelow(t *testing.T) {
+	tests := []struct {
+		path, parent string
+		want         bool
+	}{
+		{"ca/ica", "ca", true},
+		{"ca/ica/server", "ca", true},
+		{"ca", "ca", false},
+		{"ca", "ca/ica", false},
+		{"ca2/ica", "ca", false},
+		{"ca/..ica", "ca", true},
+	}
+	for _, tt := range tests {
+		if got := isBelow(tt.path, tt.parent); got != tt.want {
+			t.Errorf("isBelow(%q, %q) = %t, want %t", tt.path, tt.parent, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"io"
+	"time"
+)
+
+// randomSource provides the randomness for private keys and serial
+// numbers; it is only replaced by "-insecure-deterministic-seed"
+var randomSource io.Reader = rand.Reader
+
+// deterministic is set by "-insecure-deterministic-seed"
+var deterministic bool
+
+// deterministicReader is a sha256 counter mode stream: each block is
+// sha256(seed || counter)
+type deterministicReader struct {
+	seed    []byte
+	counter uint64
+	buffer  []byte
+}
+
+func (r *deterministicReader) Read(p []byte) (int, error) {
+	for n := 0; n < len(p); {
+		if len(r.buffer) == 0 {
+			var counter [8]byte
+			binary.BigEndian.PutUint64(counter[:], r.counter)
+			r.counter++
+			block := sha256.Sum256(append(append([]byte{}, r.seed...), counter[:]...))
+			r.buffer = block[:]
+		}
+		copied := copy(p[n:], r.buffer)
+		r.buffer = r.buffer[copied:]
+		n += copied
+	}
+	return len(p), nil
+}
+
+// addDeterministicSeedFlag adds the "-insecure-deterministic-seed" flag
+// to the commands which generate keys, serial numbers or signatures
+func addDeterministicSeedFlag(fs *flag.FlagSet) {
+	fs.Func("insecure-deterministic-seed", "hex seed for reproducible keys and certificates in test fixtures (INSECURE, never use in production)", setDeterministicSeed)
+}
+
+// setDeterministicSeed makes keys, serial numbers and signatures
+// (RFC 6979) depend only on the seed and validity periods start at
+// midnight UTC, so the same commands create identical certificates on
+// the same day; this is only for test fixtures because anyone with the
+// seed can recreate the private keys
+func setDeterministicSeed(seed string) error {
+	decoded, err := hex.DecodeString(seed)
+	if err != nil {
+		return err
+	}
+	if len(decoded) == 0 {
+		return errors.New("the seed is empty")
+	}
+	infoLog.Printf("WARNING: INSECURE DETERMINISTIC MODE: the private keys are derived from \"-insecure-deterministic-seed\" and can be recreated by anyone with the seed; NEVER use these certificates outside of tests\n")
+	randomSource = &deterministicReader{seed: decoded}
+	deterministic = true
+	runTime = runTime.Truncate(24 * time.Hour)
+	return nil
+}
+
+// signingRandom returns the randomness for x509.CreateCertificate, which
+// is nil (deterministic RFC 6979 ecdsa signatures) in deterministic mode
+func signingRandom() io.Reader {
+	if deterministic {
+		return nil
+	}
+	return rand.Reader
+}
+
+// deterministicKey derives a p-384 key from randomSource (go's
+// ecdsa.GenerateKey ignores custom random sources)
+func deterministicKey() (*ecdsa.PrivateKey, error) {
+	scalar := make([]byte, 48)
+	for {
+		if _, err := io.ReadFull(randomSource, scalar); err != nil {
+			return nil, err
+		}
+		// out of range (or zero) scalars are redrawn
+		if key, err := ecdsa.ParseRawPrivateKey(elliptic.P384(), scalar); err == nil {
+			return key, nil
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// seededTree creates a root ca, an intermediate ca and a server
+// certificate in a new temporary directory with args added to each
+// command, and returns the contents of their files
+func seededTree(t *testing.T, args ...string) map[string][]byte {
+	t.Helper()
+	dir := t.TempDir()
+	for _, command := range [][]string{
+		{"ca", "-dn=/CN=root", "-maxPathLength=1"},
+		{"ica", "-dn=/CN=ica", "ca/ica"},
+		{"server", "-dn=/CN=server", "-san=server.example.com", "ca/ica/server"},
+	} {
+		res := runCertshop(t, dir, nil, append(append(command[:1:1], args...), command[1:]...)...)
+		if res.code != 0 {
+			t.Fatalf("certshop %s failed with status %d:\n%s", command[0], res.code, res.stderr)
+		}
+		if seeded := len(args) > 0; strings.Contains(res.stderr, "WARNING: INSECURE DETERMINISTIC MODE") != seeded {
+			t.Errorf("certshop %s: got warning %t, want %t:\n%s", command[0], !seeded, seeded, res.stderr)
+		}
+	}
+	files := map[string][]byte{}
+	for _, fileName := range []string{"ca/ca.crt", "ca/ca.key", "ca/ica/ica.crt", "ca/ica/ica.key", "ca/ica/server/server.crt", "ca/ica/server/server.key"} {
+		data, err := os.ReadFile(filepath.Join(dir, fileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[fileName] = data
+	}
+	return files
+}
+
+func TestDeterministicSeed(t *testing.T) {
+	seeded := seededTree(t, "-insecure-deterministic-seed=00112233")
+	tests := []struct {
+		name string
+		args []string
+		same bool
+	}{
+		{"same seed", []string{"-insecure-deterministic-seed=00112233"}, true},
+		{"other seed", []string{"-insecure-deterministic-seed=00112234"}, false},
+		{"random", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for fileName, data := range seededTree(t, tt.args...) {
+				if bytes.Equal(data, seeded[fileName]) != tt.same {
+					t.Errorf("%s: got identical %t, want %t", fileName, !tt.same, tt.same)
+				}
+			}
+		})
+	}
+}
+
+func TestDeterministicSeedInvalid(t *testing.T) {
+	for _, seed := range []string{"", "not hex", "123"} {
+		res := runCertshop(t, t.TempDir(), nil, "ca", "-insecure-deterministic-seed="+seed)
+		if res.code == 0 {
+			t.Errorf("the seed %q was accepted", seed)
+		}
+	}
+}
+
+func TestDeterministicSeedOnlyForSigningCommands(t *testing.T) {
+	dir := newTree(t)
+	// the seed would truncate the time these commands check against
+	for _, command := range []string{"verify", "expiring"} {
+		res := runCertshop(t, dir, nil, command, "-insecure-deterministic-seed=00112233", "ca/ica/server")
+		if res.code == 0 || !strings.Contains(res.stderr, "flag provided but not defined: -insecure-deterministic-seed") {
+			t.Errorf("%s accepted the seed: status %d\n%s", command, res.code, res.stderr)
+		}
+	}
+}
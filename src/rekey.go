@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/pem"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rekeyPassword changes the passphrase of the openssh format private key
+// in path; the key itself and the certificate are left unchanged
+func rekeyPassword(args []string) {
+	fs := flag.NewFlagSet("rekey-password", flag.ContinueOnError)
+	addCommonFlags(fs)
+	passIn := fs.String("pass-in", "", "current passphrase of the private key (empty if it isn't encrypted)")
+	passOut := fs.String("pass-out", "", "new passphrase of the private key (empty to remove the passphrase)")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	if len(fs.Args()) != 1 {
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+	}
+	path := filepath.Clean(fs.Arg(0))
+	keyFile := filepath.Join(path, filepath.Base(path)+".key")
+	infoLog.Printf("Changing the passphrase of %s\n", keyFile)
+
+	defer lockTree(path)()
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		errorLog.Fatalf("Failed to read private key file %s: %s", keyFile, err)
+	}
+	if block, _ := pem.Decode(data); block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+		errorLog.Fatalf("The private key %s is not in openssh format; only keys created with \"-key-format=openssh\" can have a passphrase", keyFile)
+	}
+	if *passIn == "" && isEncryptedOpenSSHKey(data) {
+		errorLog.Fatalf("Failed to parse private key %s (use \"-pass-in\" for an encrypted key)", keyFile)
+	}
+	key, err := parseOpenSSHKey(data, *passIn)
+	if err != nil {
+		errorLog.Fatalf("Failed to decrypt %s (is \"-pass-in\" correct?): %s", keyFile, err)
+	}
+	if data, err = marshalOpenSSHKey(key, filepath.Base(path), *passOut); err != nil {
+		errorLog.Fatalf("Failed to marshal %s: %s", keyFile, err)
+	}
+	if _, err = os.Stat(filepath.Join(path, filepath.Base(path)+".crt")); err == nil {
+		checkSigner(path, parseCert(path), key)
+	}
+
+	if err = replaceFile(keyFile, data, privatePerms); err != nil {
+		errorLog.Fatalf("Failed to replace %s: %s", keyFile, err)
+	}
+	infoLog.Printf("Finished changing the passphrase of %s\n", keyFile)
+}
+
+// replaceFile writes data to a temporary file next to fileName and
+// renames it over fileName, so the old file is never lost or left half
+// written if something fails; the temporary file is removed on every
+// error (before the caller exits with errorLog.Fatalf)
+func replaceFile(fileName string, data []byte, perms os.FileMode) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(fileName), ".rekey")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perms); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fileName)
+}
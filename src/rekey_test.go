@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRekeyPassword(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-key-format=openssh", "-pass-out=first", "ca")
+	keyFile := filepath.Join(dir, "ca", "ca.key")
+	original, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := parseOpenSSHKey(original, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		passIn  string
+		passOut string
+		fail    bool
+	}{
+		{"wrong passphrase", "wrong", "second", true},
+		{"missing passphrase", "", "second", true},
+		{"change", "first", "second", false},
+		{"remove", "second", "", false},
+		{"set", "", "third", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := os.ReadFile(keyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := runCertshop(t, dir, nil, "rekey-password", "-pass-in="+tt.passIn, "-pass-out="+tt.passOut, "ca")
+			after, err := os.ReadFile(keyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.fail {
+				if res.code == 0 {
+					t.Errorf("rekey-password succeeded")
+				}
+				if !bytes.Equal(before, after) {
+					t.Errorf("the key changed although rekey-password failed")
+				}
+			} else {
+				if res.code != 0 {
+					t.Fatalf("rekey-password failed with status %d:\n%s", res.code, res.stderr)
+				}
+				got, err := parseOpenSSHKey(after, tt.passOut)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !got.Equal(key) {
+					t.Errorf("the private key changed")
+				}
+			}
+			if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != privatePerms {
+				t.Errorf("%s has permissions %v, want %v", keyFile, info.Mode().Perm(), privatePerms)
+			}
+			for _, fileName := range listTree(t, filepath.Join(dir, "ca")) {
+				if strings.HasPrefix(filepath.Base(fileName), ".rekey") {
+					t.Errorf("temporary file %s was left behind", fileName)
+				}
+			}
+		})
+	}
+}
+
+func TestReplaceFileRemovesTemporaryFile(t *testing.T) {
+	dir := t.TempDir()
+	// a file can't be renamed over a folder that isn't empty
+	target := filepath.Join(dir, "target")
+	if err := os.MkdirAll(filepath.Join(target, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceFile(target, []byte("secret"), privatePerms); err == nil {
+		t.Fatalf("%s was replaced", target)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("temporary file was left behind: %v", entries)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// hostnamePattern matches dns names made of letter, digit and hyphen
+// labels (not starting or ending with a hyphen), optionally with a
+// leading wildcard label
+var hostnamePattern = regexp.MustCompile(`^(\*\.)?([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// subjectAltNameExtension encodes the subject alternative names of the
+// template with an explicit critical flag; go's own encoding is only
+// critical when the subject is empty, and it is skipped when the
+// extension is in ExtraExtensions
+func subjectAltNameExtension(template *x509.Certificate, critical bool) (pkix.Extension, error) {
+	// same order as go's encoding
+	names := []asn1.RawValue{}
+	for _, name := range template.DNSNames {
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte(name)})
+	}
+	for _, email := range template.EmailAddresses {
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: []byte(email)})
+	}
+	for _, ip := range template.IPAddresses {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 7, Bytes: ip})
+	}
+	value, err := asn1.Marshal(names)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: oidSubjectAltName, Critical: critical, Value: value}, nil
+}
+
+// validateSubjectAlternativeNames fails if a dns name isn't a well formed
+// host name, an ip address can't identify a host, or a server
+// certificate has no dns or ip names, and warns if the certificate
+// wouldn't verify for its own common name
+func validateSubjectAlternativeNames(template *x509.Certificate) {
+	for _, name := range template.DNSNames {
+		if len(name) > 253 || !hostnamePattern.MatchString(name) {
+			usageLog.Fatalf("Invalid dns subject alternative name %s: not a well formed host name", name)
+		}
+	}
+	for _, ip := range template.IPAddresses {
+		if ip.IsUnspecified() || ip.IsMulticast() {
+			usageLog.Fatalf("Invalid ip subject alternative name %s: not a host address", ip)
+		}
+	}
+	for _, usage := range template.ExtKeyUsage {
+		if usage != x509.ExtKeyUsageServerAuth {
+			continue
+		}
+		if len(template.DNSNames) == 0 && len(template.IPAddresses) == 0 {
+			errorLog.Fatalf("Server certificate has no dns or ip subject alternative names for tls")
+		}
+		cn := template.Subject.CommonName
+		if cn == "" {
+			break
+		}
+		cert := &x509.Certificate{DNSNames: template.DNSNames, IPAddresses: template.IPAddresses}
+		if err := cert.VerifyHostname(cn); err != nil {
+			infoLog.Printf("WARNING: the common name %s isn't one of the subject alternative names: %s\n", cn, err)
+		}
+	}
+}
+
+// checkWildcard returns an error if a dns name has a wildcard that tls
+// clients won't match: the only wildcard allowed is a whole leftmost "*"
+// label followed by at least two labels (ie. *.example.com but not
+// *.*.example.com, foo.*.example.com, f*o.example.com or *.com)
+func checkWildcard(name string) error {
+	if !strings.Contains(name, "*") {
+		return nil
+	}
+	labels := strings.Split(name, ".")
+	if labels[0] != "*" {
+		return errors.New("a wildcard must be the whole leftmost label")
+	}
+	for _, label := range labels[1:] {
+		if strings.Contains(label, "*") {
+			return errors.New("only the leftmost label may be a wildcard")
+		}
+	}
+	if len(labels) < 3 {
+		return errors.New("a wildcard must be followed by at least two labels")
+	}
+	return nil
+}
+
+// validateWildcards fails if a dns subject alternative name or a host
+// name common name has a wildcard that tls clients won't match
+func validateWildcards(template *x509.Certificate) {
+	for _, name := range template.DNSNames {
+		if err := checkWildcard(name); err != nil {
+			usageLog.Fatalf("Invalid wildcard subject alternative name %s: %s", name, err)
+		}
+	}
+	if cn := template.Subject.CommonName; !strings.Contains(cn, " ") {
+		if err := checkWildcard(cn); err != nil {
+			usageLog.Fatalf("Invalid wildcard common name %s: %s", cn, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/varasys/certshop/pki"
+)
+
+// selfSign creates a self-signed server certificate (not a certificate
+// authority) for throwaway tls, ie. dev servers, without a ca in the
+// tree; the equivalent of "openssl req -x509"
+func selfSign(args []string) {
+	fs := flag.NewFlagSet("selfsign", flag.ContinueOnError)
+	addCommonFlags(fs)
+	addDeterministicSeedFlag(fs)
+	dn := fs.String("dn", "/CN=localhost", "certificate subject")
+	san := fs.String("san", "localhost,127.0.0.1", "subject alternative names")
+	validity := fs.Int("validity", 30, "certificate validity in days")
+	clockSkew := fs.Duration("clock-skew", defaultClockSkew, "backdate the start of the validity period by this duration to tolerate clock skew")
+	overwrite := fs.Bool("overwrite", false, "overwrite any existing files")
+	keyFormat := fs.String("key-format", "pem", "private key format (pem or openssh)")
+	passOut := fs.String("pass-out", "", "passphrase for the private key (openssh key format only)")
+	auditLog, operator := addAuditFlags(fs)
+	out := fs.String("out", "", "file to write the certificate and private key to in pem format (- for stdout) instead of the path")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+	checkKeyFormat(*keyFormat, *passOut)
+
+	path := "selfsigned"
+	if len(fs.Args()) > 1 {
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+	} else if len(fs.Args()) == 1 {
+		path = filepath.Clean(fs.Arg(0))
+	}
+	if *out != "" && len(fs.Args()) == 1 {
+		errorLog.Fatalf("The \"-out\" option can't be used with a path")
+	} else if *out != "" && (*keyFormat != "pem" || *passOut != "") {
+		errorLog.Fatalf("The \"-out\" option only writes pem format private keys")
+	}
+
+	if *out == "" {
+		infoLog.Printf("Creating Self-Signed Certificate %s with Subject: %s\n", path, *dn)
+		defer lockTree(path)()
+		if !*overwrite {
+			checkExisting(path)
+		} else {
+			confirmOverwrite(path)
+		}
+	} else {
+		infoLog.Printf("Creating Self-Signed Certificate with Subject: %s\n", *dn)
+		if _, err := os.Stat(*out); *out != "-" && err == nil && !*overwrite {
+			errorLog.Fatalf("Skipping creation of %s because it already exists.\nUse the \"-overwrite\" option to overwrite the existing file.", *out)
+		} else if *out != "-" && err == nil {
+			confirm("Overwrite "+*out+"?", "overwrite "+*out)
+		}
+	}
+
+	start := time.Now()
+	key, derKey, err := generatePrivateKey()
+	if err != nil {
+		errorLog.Fatalf("Failed to generate private key: %s", err)
+	}
+	debugTiming("key generation", start)
+
+	notBefore, notAfter := validityPeriod(*clockSkew, *validity)
+	template := x509.Certificate{
+		SerialNumber:          newSerialNumber(),
+		Subject:               *parseDn(nil, *dn),
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	parseSubjectAlternativeNames(*san, &template)
+	validateWildcards(&template)
+	checkSubjectAlternativeNames(&template, false)
+	template.RawSubject = rawSubject(template.Subject, "printable")
+	start = time.Now()
+	derCert, err := pki.Sign(signingRandom(), &template, &template, &key.PublicKey, key)
+	if err != nil {
+		errorLog.Fatalf("Failed to create Self-Signed Certificate %s: %s", path, err)
+	}
+	debugTiming("signing", start)
+
+	if *out != "" {
+		bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derCert})
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: derKey})...)
+		if *out == "-" {
+			if _, err = os.Stdout.Write(bundle); err != nil {
+				errorLog.Fatalf("Failed to write to stdout: %s", err)
+			}
+		} else {
+			writeFile(*out, bundle, privatePerms)
+			if err = os.Chmod(*out, privatePerms); err != nil {
+				errorLog.Fatalf("Failed to set permissions of %s: %s", *out, err)
+			}
+		}
+		writeAuditLog(*auditLog, "selfsign", *operator, *out, derCert)
+		infoLog.Printf("Finished Creating Self-Signed Certificate with Subject: %s\n", formatDn(template.Subject))
+		return
+	}
+
+	start = time.Now()
+	// an empty chain stops saveCert looking for a ca in the parent folder
+	saveCert(path, derCert, []byte{})
+	saveKey(path, key, derKey, *keyFormat, *passOut)
+	// the certificate is its own trust anchor
+	writeFile(filepath.Join(path, "ca.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derCert}), publicPerms)
+	debugTiming("marshaling and saving", start)
+	writeAuditLog(*auditLog, "selfsign", *operator, path, derCert)
+	infoLog.Printf("Finished Creating Self-Signed Certificate %s with Subject: %s\n", path, formatDn(template.Subject))
+}
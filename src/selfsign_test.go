@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelfSign(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		certFile string
+		dns      []string
+		ips      []string
+		days     int
+	}{
+		{"defaults", nil, "selfsigned/selfsigned.crt", []string{"localhost"}, []string{"127.0.0.1"}, 30},
+		{"path", []string{"-dn=/CN=dev.example.com", "-san=dev.example.com,*.dev.example.com,10.0.0.5", "-validity=7", "dev"}, "dev/dev.crt", []string{"dev.example.com", "*.dev.example.com"}, []string{"10.0.0.5"}, 7},
+		{"out", []string{"-san=dev.example.com", "-out=dev.pem"}, "dev.pem", []string{"dev.example.com"}, nil, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			certshop(t, dir, append([]string{"selfsign"}, tt.args...)...)
+			data, err := os.ReadFile(filepath.Join(dir, tt.certFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			block, rest := pem.Decode(data)
+			if block == nil || block.Type != "CERTIFICATE" {
+				t.Fatalf("%s doesn't start with a certificate", tt.certFile)
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// isSelfSigned only accepts certificate authorities
+			if !bytes.Equal(cert.RawIssuer, cert.RawSubject) || cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) != nil {
+				t.Errorf("the certificate isn't self-signed")
+			}
+			if cert.IsCA || !cert.BasicConstraintsValid {
+				t.Errorf("the certificate is a ca")
+			}
+			if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+				t.Errorf("extended key usage %v, want server auth", cert.ExtKeyUsage)
+			}
+			if strings.Join(cert.DNSNames, ",") != strings.Join(tt.dns, ",") {
+				t.Errorf("dns names %v, want %v", cert.DNSNames, tt.dns)
+			}
+			ips := []string{}
+			for _, ip := range cert.IPAddresses {
+				ips = append(ips, ip.String())
+			}
+			if strings.Join(ips, ",") != strings.Join(tt.ips, ",") {
+				t.Errorf("ip addresses %v, want %v", ips, tt.ips)
+			}
+			if days := int(cert.NotAfter.Sub(time.Now()).Hours()/24 + 0.5); days != tt.days {
+				t.Errorf("valid for %d days, want %d", days, tt.days)
+			}
+			if _, err = cert.Verify(x509.VerifyOptions{Roots: certPool(cert), DNSName: tt.dns[0]}); err != nil {
+				t.Errorf("the certificate doesn't verify as its own trust anchor: %s", err)
+			}
+
+			var key *ecdsa.PrivateKey
+			if filepath.Ext(tt.certFile) == ".pem" {
+				// the key follows the certificate in the same file
+				if keyBlock, _ := pem.Decode(rest); keyBlock == nil || keyBlock.Type != "EC PRIVATE KEY" {
+					t.Fatalf("%s has no private key after the certificate", tt.certFile)
+				} else if key, err = x509.ParseECPrivateKey(keyBlock.Bytes); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				path := filepath.Dir(filepath.Join(dir, tt.certFile))
+				key = parseKey(path)
+				if ca := parseCertChain(filepath.Join(path, "ca.pem")); len(ca) != 1 || !ca[0].Equal(cert) {
+					t.Errorf("ca.pem isn't the certificate itself")
+				}
+			}
+			if !publicKeysEqual(cert.PublicKey, key.Public()) {
+				t.Errorf("the private key doesn't match the certificate")
+			}
+			if info, err := os.Stat(filepath.Join(dir, tt.certFile)); err == nil && filepath.Ext(tt.certFile) == ".pem" && info.Mode().Perm() != privatePerms {
+				t.Errorf("%s has permissions %v, want %v", tt.certFile, info.Mode().Perm(), privatePerms)
+			}
+		})
+	}
+}
+
+func TestSelfSignErrors(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "selfsign", "existing")
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"existing", []string{"existing"}, "already exists"},
+		{"out with path", []string{"-out=dev.pem", "dev"}, "can't be used with a path"},
+		{"out with openssh", []string{"-out=dev.pem", "-key-format=openssh"}, "only writes pem format"},
+		{"invalid wildcard", []string{"-san=*.*.example.com", "wild"}, "Invalid wildcard"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := runCertshop(t, dir, nil, append([]string{"selfsign"}, tt.args...)...)
+			if res.code == 0 || !strings.Contains(res.stderr, tt.err) {
+				t.Errorf("got status %d, want an error with %q:\n%s", res.code, tt.err, res.stderr)
+			}
+		})
+	}
+}
+
+// certPool returns a pool of the certificates
+func certPool(certs ...*x509.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// errSkipped marks self tests which need a missing external program
+var errSkipped = errors.New("skipped")
+
+// selfTest checks that keys and certificates can be created, encoded
+// and verified, and that the external programs work, returning the
+// exit status (1 if any test failed)
+func selfTest(args []string) int {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	addCommonFlags(fs)
+	addOpensslFlags(fs)
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+	if len(fs.Args()) != 0 {
+		usageLog.Fatalf("Invalid arguments %s", strings.Join(fs.Args(), ","))
+	}
+
+	key, derKey, err := generatePrivateKey()
+	if err != nil {
+		fmt.Printf("FAIL: ecdsa P-384 key generation: %s\n", err)
+		return 1
+	}
+	fmt.Println("PASS: ecdsa P-384 key generation")
+
+	var derCert []byte
+	tests := []struct {
+		name string
+		test func() error
+	}{
+		{"self-signed certificate creation and verification", func() error {
+			template := &x509.Certificate{
+				SerialNumber:          big.NewInt(1),
+				Subject:               pkix.Name{CommonName: "certshop selftest"},
+				NotBefore:             runTime.Add(-time.Minute),
+				NotAfter:              runTime.Add(time.Hour),
+				BasicConstraintsValid: true,
+				IsCA:                  true,
+				KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			}
+			if derCert, err = x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key); err != nil {
+				return err
+			}
+			cert, err := x509.ParseCertificate(derCert)
+			if err != nil {
+				return err
+			}
+			roots := x509.NewCertPool()
+			roots.AddCert(cert)
+			_, err = cert.Verify(x509.VerifyOptions{Roots: roots, CurrentTime: runTime})
+			return err
+		}},
+		{"sec1 and pkcs8 key encoding", func() error {
+			sec1, err := x509.ParseECPrivateKey(derKey)
+			if err != nil {
+				return err
+			}
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			if err != nil {
+				return err
+			}
+			pkcs8, err := x509.ParsePKCS8PrivateKey(der)
+			if err != nil {
+				return err
+			}
+			if !key.Equal(sec1) || !key.Equal(pkcs8) {
+				return errors.New("decoded key doesn't match")
+			}
+			return nil
+		}},
+		{"openssh key encoding", func() error {
+			encoded, err := marshalOpenSSHKey(key, "selftest", "")
+			if err != nil {
+				return err
+			}
+			decoded, err := parseOpenSSHKey(encoded, "")
+			if err != nil {
+				return err
+			}
+			if !key.Equal(decoded) {
+				return errors.New("decoded key doesn't match")
+			}
+			return nil
+		}},
+		{"openssl pkcs12 export and import", func() error {
+			if _, err := exec.LookPath("openssl"); err != nil || noOpenssl {
+				return errSkipped
+			}
+			return selfTestP12(key, derKey, derCert)
+		}},
+		{"openssh key encryption", func() error {
+			encrypted, err := marshalOpenSSHKey(key, "selftest", "selftest")
+			if err != nil {
+				return err
+			}
+			decrypted, err := parseOpenSSHKey(encrypted, "selftest")
+			if err != nil {
+				return err
+			}
+			if !key.Equal(decrypted) {
+				return errors.New("decrypted key doesn't match")
+			}
+			return nil
+		}},
+	}
+
+	status := 0
+	for _, t := range tests {
+		if err := t.test(); err == errSkipped {
+			fmt.Printf("SKIP: %s (not installed or disabled)\n", t.name)
+		} else if err != nil {
+			fmt.Printf("FAIL: %s: %s\n", t.name, err)
+			status = 1
+		} else {
+			fmt.Printf("PASS: %s\n", t.name)
+		}
+	}
+	return status
+}
+
+// selfTestP12 exports the key and certificate to pkcs12 with openssl
+// and reads them back
+func selfTestP12(key *ecdsa.PrivateKey, derKey []byte, derCert []byte) error {
+	if derCert == nil {
+		return errors.New("no certificate to export")
+	}
+	certFile := writeTempFile(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derCert}))
+	defer os.Remove(certFile)
+	keyFile := writeTempFile(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: derKey}))
+	defer os.Remove(keyFile)
+	p12, err := runOpenssl([]string{"pkcs12", "-export", "-in", certFile, "-inkey", keyFile, "-passout", "stdin"}, "selftest")
+	if err != nil {
+		return err
+	}
+	p12File := writeTempFile(p12)
+	defer os.Remove(p12File)
+	out, err := runOpenssl([]string{"pkcs12", "-in", p12File, "-nodes", "-passin", "stdin"}, "selftest")
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derCert})) {
+		return errors.New("certificate not found in pkcs12 file")
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	installed := "PASS"
+	if _, err := exec.LookPath("openssl"); err != nil {
+		installed = "SKIP"
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		broken  bool
+		openssl string
+		code    int
+	}{
+		{"default", nil, false, installed, 0},
+		{"no openssl", []string{"-no-openssl"}, false, "SKIP", 0},
+		{"broken openssl", nil, true, "FAIL", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.broken {
+				fakeOpenssl(t, "unable to load certificates")
+			}
+			res := runCertshop(t, t.TempDir(), nil, append([]string{"selftest"}, tt.args...)...)
+			if res.code != tt.code {
+				t.Errorf("got exit status %d, want %d", res.code, tt.code)
+			}
+			reported := false
+			for _, line := range strings.Split(string(res.stdout), "\n") {
+				status, name, ok := strings.Cut(line, ": ")
+				if !ok || (status != "PASS" && status != "SKIP" && status != "FAIL") {
+					// the rest of a multi-line failure message
+					continue
+				}
+				if strings.HasPrefix(name, "openssl") {
+					reported = true
+					if status != tt.openssl {
+						t.Errorf("got %q, want the openssl test to %s", line, tt.openssl)
+					}
+				} else if status != "PASS" {
+					t.Errorf("got %q", line)
+				}
+			}
+			if !reported {
+				t.Errorf("the openssl capability isn't reported:\n%s", res.stdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/varasys/certshop/pki"
+)
+
+// newSerialNumber returns a random positive serial number below
+// pki.SerialNumberLimit
+func newSerialNumber() *big.Int {
+	serialNumber, err := pki.NewSerialNumber(randomSource, pki.SerialNumberLimit)
+	if err != nil {
+		errorLog.Fatalf("Failed to generate serial number: %s", err)
+	}
+	return serialNumber
+}
+
+// serialFlag returns the serial number to use for a new certificate:
+// the "-serial" value, which must be a positive number (decimal, or hex
+// with a 0x prefix) of at most pki.MaxSerialNumberOctets as required by
+// RFC 5280, or a random serial number if it is empty
+func serialFlag(value string) *big.Int {
+	if value == "" {
+		return newSerialNumber()
+	}
+	serialNumber, err := parseSerialNumber(value)
+	if err != nil {
+		usageLog.Fatalf("Invalid \"-serial\" value: %s", err)
+	}
+	return serialNumber
+}
+
+// parseSerialNumber parses a decimal or 0x prefixed hex serial number
+// and checks that it is valid for RFC 5280
+func parseSerialNumber(value string) (*big.Int, error) {
+	serialNumber, ok := new(big.Int).SetString(value, 0)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a decimal or 0x prefixed hex number", value)
+	}
+	return serialNumber, pki.CheckSerialNumber(serialNumber)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSerialNumber(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string // hex, empty if the value is invalid
+	}{
+		{"decimal", "4096", "1000"},
+		{"hex", "0x1000", "1000"},
+		{"max 20 octets", "0x" + "7f" + strings.Repeat("ff", 19), "7f" + strings.Repeat("ff", 19)},
+		{"zero", "0", ""},
+		{"negative", "-1", ""},
+		{"21 octets", "0x80" + strings.Repeat("00", 19), ""},
+		{"not a number", "serial", ""},
+		{"hex without prefix", "ff", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serialNumber, err := parseSerialNumber(tt.value)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("%s was accepted as %v", tt.value, serialNumber)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := serialNumber.Text(16); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerialFlag(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-serial=0x1234", "-maxPathLength=1", "-dn=/CN=root", "ca")
+	certshop(t, dir, "ca", "-serial=42", "-dn=/CN=ica", "ca/ica")
+	certshop(t, dir, "server", "-serial=0x"+strings.Repeat("7f", 20), "-dn=/CN=server", "ca/ica/server")
+	tests := []struct {
+		path string
+		want *big.Int
+	}{
+		{"ca/ca.crt", big.NewInt(0x1234)},
+		{"ca/ica/ica.crt", big.NewInt(42)},
+		{"ca/ica/server/server.crt", new(big.Int).SetBytes([]byte(strings.Repeat("\x7f", 20)))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := readCert(t, filepath.Join(dir, tt.path)).SerialNumber; got.Cmp(tt.want) != 0 {
+				t.Errorf("serial number %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, args := range [][]string{
+		{"ca", "-serial=0", "-dn=/CN=zero", "zero"},
+		{"server", "-serial=0x80" + strings.Repeat("00", 19), "-dn=/CN=long", "ca/long"},
+	} {
+		res := runCertshop(t, dir, nil, args...)
+		if res.code == 0 || !strings.Contains(res.stderr, `Invalid "-serial" value`) {
+			t.Errorf("certshop %s: status %d:\n%s", strings.Join(args, " "), res.code, res.stderr)
+		}
+		if _, err := os.Stat(filepath.Join(dir, args[len(args)-1])); err == nil {
+			t.Errorf("certshop %s created %s", strings.Join(args, " "), args[len(args)-1])
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"strings"
+)
+
+var (
+	ecdsaSignatureAlgorithms = []x509.SignatureAlgorithm{x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512}
+	rsaSignatureAlgorithms   = []x509.SignatureAlgorithm{x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS}
+	ed25519SignatureAlgorithms = []x509.SignatureAlgorithm{x509.PureEd25519}
+)
+
+// signatureAlgorithms returns the signature algorithms which can be
+// used with the signing key
+func signatureAlgorithms(signer crypto.PublicKey) []x509.SignatureAlgorithm {
+	switch signer.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsaSignatureAlgorithms
+	case *rsa.PublicKey:
+		return rsaSignatureAlgorithms
+	case ed25519.PublicKey:
+		return ed25519SignatureAlgorithms
+	}
+	return nil
+}
+
+// parseSignatureAlgorithm returns the "-signature-algorithm" (named as
+// in go and openssl's text output, ie. ECDSA-SHA384) or fails with an
+// explanation if the ca signing key can't make that kind of signature;
+// an empty name leaves the choice to go (ie. ECDSA-SHA384 for P-384)
+func parseSignatureAlgorithm(name string, ca string, signer crypto.PublicKey) x509.SignatureAlgorithm {
+	if name == "" {
+		return x509.UnknownSignatureAlgorithm
+	}
+	allowed := signatureAlgorithms(signer)
+	names := []string{}
+	for _, algorithm := range allowed {
+		names = append(names, algorithm.String())
+	}
+	for _, algorithm := range append(append(append([]x509.SignatureAlgorithm{}, ecdsaSignatureAlgorithms...), rsaSignatureAlgorithms...), ed25519SignatureAlgorithms...) {
+		if !strings.EqualFold(name, algorithm.String()) {
+			continue
+		}
+		for _, a := range allowed {
+			if a == algorithm {
+				return algorithm
+			}
+		}
+		errorLog.Fatalf("The %s signature algorithm can't be used with the %s signing key of %s (use one of %s)",
+			algorithm, publicKeyAlgorithm(signer), ca, strings.Join(names, ", "))
+	}
+	errorLog.Fatalf("Unknown signature algorithm %s (the %s signing key of %s can use %s)",
+		name, publicKeyAlgorithm(signer), ca, strings.Join(names, ", "))
+	return x509.UnknownSignatureAlgorithm
+}
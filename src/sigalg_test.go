@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSignatureAlgorithm(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		name      string
+		algorithm string
+		want      x509.SignatureAlgorithm
+		err       string
+	}{
+		{"default", "", x509.ECDSAWithSHA384, ""},
+		{"ecdsa sha256", "ECDSA-SHA256", x509.ECDSAWithSHA256, ""},
+		{"ecdsa sha512", "ecdsa-sha512", x509.ECDSAWithSHA512, ""},
+		{"rsa", "SHA256-RSA", 0, "can't be used with the ECDSA P-384 signing key"},
+		{"rsa pss", "SHA384-RSAPSS", 0, "can't be used with the ECDSA P-384 signing key"},
+		{"ed25519", "Ed25519", 0, "can't be used with the ECDSA P-384 signing key"},
+		{"unknown", "MD5-RSA", 0, "Unknown signature algorithm"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suffix := strconv.Itoa(i)
+			for _, args := range [][]string{
+				{"ica", "-dn=/CN=ica" + suffix, "ca/ica" + suffix},
+				{"server", "-dn=/CN=server" + suffix, "-san=server.example.com", "ca/ica/server" + suffix},
+			} {
+				command, path := args[0], args[len(args)-1]
+				args = append([]string{command, "-signature-algorithm=" + tt.algorithm}, args[1:]...)
+				res := runCertshop(t, dir, nil, args...)
+				if tt.err != "" {
+					if res.code == 0 || !strings.Contains(res.stderr, tt.err) {
+						t.Errorf("%s: status %d, want an error with %q:\n%s", command, res.code, tt.err, res.stderr)
+					}
+					// the suitable algorithms are listed
+					if !strings.Contains(res.stderr, "ECDSA-SHA256, ECDSA-SHA384, ECDSA-SHA512") {
+						t.Errorf("%s: the ecdsa algorithms aren't listed:\n%s", command, res.stderr)
+					}
+					return
+				}
+				if res.code != 0 {
+					t.Fatalf("%s failed with status %d:\n%s", command, res.code, res.stderr)
+				}
+				cert := readCert(t, filepath.Join(dir, path, filepath.Base(path)+".crt"))
+				if cert.SignatureAlgorithm != tt.want {
+					t.Errorf("%s: signature algorithm %s, want %s", command, cert.SignatureAlgorithm, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+)
+
+// signerCache holds the signers already loaded by this process (by ca
+// path and kms key), so an encrypted ca key is only decrypted once, ie.
+// for every row of a batch; decrypted keys are never written to disk, but
+// they stay in memory (see clearSignerCache)
+var signerCache = map[string]crypto.Signer{}
+
+// caSigner returns the signer for the ca in path: the ca private key
+// file, or the aws kms key when kmsKeyID is set; anything implementing
+// crypto.Signer can sign as long as its public key matches the ca
+// certificate; it fails if the issuance policy of the ca doesn't allow
+// signing now; password decrypts an openssh format ca key
+func caSigner(path string, caCert *x509.Certificate, kmsKeyID string, password string) crypto.Signer {
+	checkIssuancePolicy(path)
+	cacheKey := filepath.Clean(path) + "\x00" + kmsKeyID
+	signer, ok := signerCache[cacheKey]
+	if ok {
+		checkSigner(path, caCert, signer)
+		return signer
+	}
+	if kmsKeyID != "" {
+		kms, err := newKMSCASigner(kmsKeyID)
+		if err != nil {
+			errorLog.Fatalf("Failed to use kms key %s for %s: %s", kmsKeyID, path, err)
+		}
+		signer = kms
+	} else {
+		keyFile := filepath.Join(path, filepath.Base(path)+".key")
+		if password == "" && isEncryptedOpenSSHKey([]byte(readFile(keyFile))) {
+			errorLog.Fatalf("The private key %s is encrypted; give its passphrase with \"-ca-pass\" or the CERTSHOP_CA_PASS environment variable", keyFile)
+		}
+		signer = parseKeyFile(keyFile, password)
+	}
+	checkSigner(path, caCert, signer)
+	signerCache[cacheKey] = signer
+	return signer
+}
+
+// caPassword is the "-ca-pass" flag, or the CERTSHOP_CA_PASS environment
+// variable so that the password doesn't have to be on the command line
+// (or in a batch manifest)
+func caPassword(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("CERTSHOP_CA_PASS")
+}
+
+// clearSignerCache drops the references to the cached signers so they
+// can be garbage collected; it doesn't wipe the decrypted keys, since go
+// keeps its own copies of them that can't be cleared, so they remain in
+// memory until it is reused or the process exits; only batch calls it,
+// once all of its rows are created (the other commands, and a batch that
+// fails, exit with the signers cached)
+func clearSignerCache() {
+	for cacheKey := range signerCache {
+		delete(signerCache, cacheKey)
+	}
+}
+
+// checkSigner fails if the signer's public key doesn't match the ca
+// certificate, which would create certificates that don't validate
+func checkSigner(path string, caCert *x509.Certificate, signer crypto.Signer) {
+	if !publicKeysEqual(caCert.PublicKey, signer.Public()) {
+		errorLog.Fatalf("The signing key of %s doesn't match the public key of its certificate", path)
+	}
+}
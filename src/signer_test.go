@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recordingSigner counts the signatures made through it
+type recordingSigner struct {
+	crypto.Signer
+	calls int
+}
+
+func (s *recordingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.calls++
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestDelegatedSigner(t *testing.T) {
+	dir := newTree(t)
+	t.Chdir(dir)
+	tests := []struct {
+		command string
+		args    []string
+		path    string
+	}{
+		{"client", []string{"-dn=/CN=client"}, "ca/ica/client"},
+		{"server", []string{"-dn=/CN=www", "-san=www.example.com"}, "ca/ica/www"},
+		{"ica", []string{"-dn=/CN=ica2"}, "ca/ica2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			ca := filepath.Dir(tt.path)
+			signer := &recordingSigner{Signer: parseKey(ca)}
+			signerCache[ca+"\x00"] = signer
+			t.Cleanup(func() { delete(signerCache, ca+"\x00") })
+
+			createCommands[tt.command](append(tt.args, tt.path))
+			if signer.calls != 1 {
+				t.Errorf("the delegated signer was called %d times, want 1", signer.calls)
+			}
+			if err := parseCert(tt.path).CheckSignatureFrom(parseCert(ca)); err != nil {
+				t.Errorf("the certificate isn't signed by %s: %s", ca, err)
+			}
+		})
+	}
+}
+
+func TestEncryptedCABatch(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root", "-key-format=openssh", "-pass-out=secret")
+	tests := []struct {
+		name     string
+		env      string
+		defaults string
+		err      string
+	}{
+		{"manifest", "", `"ca-pass": "secret"`, ""},
+		{"environment", "secret", "", ""},
+		{"wrong passphrase", "", `"ca-pass": "wrong"`, "ca/ca.key"},
+		{"no passphrase", "", "", "ca/ca.key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CERTSHOP_CA_PASS", tt.env)
+			t.Cleanup(func() {
+				for _, path := range []string{"ca/web1", "ca/web2", "ca/alice"} {
+					os.RemoveAll(filepath.Join(dir, path))
+				}
+			})
+			// every row is signed by the ca, which is only decrypted once
+			manifest := `{"defaults": {` + tt.defaults + `}, "certificates": [
+				{"path": "ca/web1", "dn": "/CN=web1", "san": ["web1.example.com"]},
+				{"path": "ca/web2", "dn": "/CN=web2", "san": ["web2.example.com"]},
+				{"command": "client", "path": "ca/alice", "dn": "/CN=alice"}
+			]}`
+			if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+			res := runCertshop(t, dir, nil, "batch", "manifest.json")
+			if tt.err != "" {
+				if res.code == 0 || !strings.Contains(res.stderr, tt.err) {
+					t.Errorf("got status %d, want an error with %q:\n%s", res.code, tt.err, res.stderr)
+				}
+				return
+			}
+			if res.code != 0 {
+				t.Fatalf("the batch failed with status %d:\n%s", res.code, res.stderr)
+			}
+			ca := readCert(t, filepath.Join(dir, "ca/ca.crt"))
+			for _, path := range []string{"ca/web1", "ca/web2", "ca/alice"} {
+				cert := readCert(t, filepath.Join(dir, path, filepath.Base(path)+".crt"))
+				if err := cert.CheckSignatureFrom(ca); err != nil {
+					t.Errorf("%s isn't signed by the encrypted ca: %s", path, err)
+				}
+			}
+		})
+	}
+}
+
+func TestClearSignerCache(t *testing.T) {
+	dir := newTree(t)
+	t.Chdir(dir)
+	for _, path := range []string{"ca", "ca/ica"} {
+		signerCache[path+"\x00"] = parseKey(path)
+	}
+	clearSignerCache()
+	if len(signerCache) != 0 {
+		t.Errorf("%d signers are still cached", len(signerCache))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// applySpec sets flags from a json certificate specification where
+// each key is a flag name, such as:
+//
+//	{"dn": "/CN=host.domain.com/O=My Organization",
+//	 "san": ["host.domain.com", "10.0.0.1"],
+//	 "validity": 90,
+//	 "ext-key-usage": ["serverAuth", "clientAuth"]}
+//
+// or the same in yaml when the file name ends with .yaml or .yml;
+// lists are joined with commas, and flags which were provided on the
+// command line take precedence over the spec
+func applySpec(fs *flag.FlagSet, specFile string) {
+	if specFile == "" {
+		return
+	}
+	infoLog.Printf("Reading certificate specification %s\n", specFile)
+	data, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		errorLog.Fatalf("Failed to read certificate specification %s: %s", specFile, err)
+	}
+	spec := map[string]interface{}{}
+	if ext := strings.ToLower(filepath.Ext(specFile)); ext == ".yaml" || ext == ".yml" {
+		err = yaml.Unmarshal(data, &spec)
+	} else {
+		err = json.Unmarshal(data, &spec)
+	}
+	if err != nil {
+		errorLog.Fatalf("Failed to parse certificate specification %s: %s", specFile, err)
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for name, value := range spec {
+		if fs.Lookup(name) == nil || name == "spec" {
+			errorLog.Fatalf("Unknown field %s in certificate specification %s", name, specFile)
+		}
+		if set[name] {
+			continue
+		}
+		var text string
+		switch v := value.(type) {
+		case []interface{}:
+			values := []string{}
+			for _, item := range v {
+				values = append(values, specValue(item))
+			}
+			text = strings.Join(values, ",")
+		default:
+			text = specValue(v)
+		}
+		if err = fs.Set(name, text); err != nil {
+			errorLog.Fatalf("Invalid value for %s in certificate specification %s: %s", name, specFile, err)
+		}
+	}
+}
+
+// specValue converts a spec value to flag text; yaml decodes unquoted
+// dates (ie. "issue-until: 2027-01-01") as timestamps
+func specValue(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		if t.Equal(t.Truncate(24 * time.Hour)) {
+			return t.Format("2006-01-02")
+		}
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
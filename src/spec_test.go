@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertificateSpec(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root/O=Example")
+	tests := []struct {
+		fileName string
+		spec     string
+	}{
+		{"host.json", `{"dn": "/CN=host.example.com/OU=Web",
+			"san": ["host.example.com", "10.0.0.1", "admin@example.com"],
+			"validity": 90,
+			"key-usage": ["digitalSignature"],
+			"ext-key-usage": ["serverAuth", "clientAuth"],
+			"subject-serial": "S-1"}`},
+		{"host.yaml", `dn: /CN=host.example.com/OU=Web
+san:
+  - host.example.com
+  - 10.0.0.1
+  - admin@example.com
+validity: 90
+key-usage: [digitalSignature]
+ext-key-usage:
+  - serverAuth
+  - clientAuth
+subject-serial: S-1
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(dir, tt.fileName), []byte(tt.spec), 0644); err != nil {
+				t.Fatal(err)
+			}
+			path := "ca/" + strings.ReplaceAll(tt.fileName, ".", "-")
+			certshop(t, dir, "server", "-spec="+tt.fileName, path)
+			cert := parseCert(filepath.Join(dir, path))
+			if got := formatDn(cert.Subject); got != "/CN=host.example.com/serialNumber=S-1/O=Example/OU=Web" {
+				t.Errorf("got subject %s", got)
+			}
+			if got := strings.Join(subjectAlternativeNames(cert), ","); got != "host.example.com,10.0.0.1,admin@example.com" {
+				t.Errorf("got subject alternative names %s", got)
+			}
+			if days := cert.NotAfter.Sub(cert.NotBefore) - defaultClockSkew; days != 90*24*time.Hour {
+				t.Errorf("got a validity of %s, want 90 days", days)
+			}
+			if got := strings.Join(keyUsageNames(cert.KeyUsage), ","); got != "digitalSignature" {
+				t.Errorf("got key usages %s", got)
+			}
+			if got := strings.Join(extKeyUsageNames(cert.ExtKeyUsage), ","); got != "serverAuth,clientAuth" {
+				t.Errorf("got extended key usages %s", got)
+			}
+
+			// flags on the command line take precedence over the spec
+			certshop(t, dir, "server", "-spec="+tt.fileName, "-validity=30", "-dn=/CN=override", path+"-override")
+			cert = parseCert(filepath.Join(dir, path+"-override"))
+			if cert.Subject.CommonName != "override" || cert.NotAfter.Sub(cert.NotBefore)-defaultClockSkew != 30*24*time.Hour {
+				t.Errorf("the command line flags didn't override the spec")
+			}
+		})
+	}
+}
+
+func TestCertificateSpecErrors(t *testing.T) {
+	dir := t.TempDir()
+	certshop(t, dir, "ca", "-dn=/CN=root")
+	tests := []struct {
+		fileName, spec, problem string
+	}{
+		{"unknown.json", `{"colour": "blue"}`, "Unknown field colour"},
+		{"unknown.yml", "colour: blue\n", "Unknown field colour"},
+		{"invalid.yaml", "dn: [unclosed\n", "Failed to parse"},
+		{"invalid.json", `dn: /CN=yaml`, "Failed to parse"},
+		{"value.yaml", "validity: ninety\n", "Invalid value for validity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(dir, tt.fileName), []byte(tt.spec), 0644); err != nil {
+				t.Fatal(err)
+			}
+			res := runCertshop(t, dir, nil, "server", "-spec="+tt.fileName, "ca/server")
+			if res.code == 0 || !strings.Contains(res.stderr, tt.problem) {
+				t.Errorf("got status %d, want a failure reporting %q: %s", res.code, tt.problem, res.stderr)
+			}
+		})
+	}
+}
+
+func TestSpecValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"text", "text"},
+		{90, "90"},
+		{float64(90), "90"},
+		{true, "true"},
+		{time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), "2027-01-01"},
+		{time.Date(2027, 1, 1, 12, 30, 0, 0, time.UTC), "2027-01-01T12:30:00Z"},
+	}
+	for _, tt := range tests {
+		if got := specValue(tt.value); got != tt.want {
+			t.Errorf("specValue(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+func verifyCertificate(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	addCommonFlags(fs)
+	systemRoots := fs.Bool("system-roots", false, "verify against the system trust store instead of ca.pem")
+	chainFile := fs.String("chain", "", "pem file with the intermediate certificates to verify with instead of the saved chain")
+	caOnly := fs.Bool("ca-only", false, "only check that the certificate is a valid self-signed root certificate authority")
+
+	err := fs.Parse(args)
+	if err != nil {
+		usageLog.Fatalf("Failed to parse command line arguments: %s", err)
+	}
+
+	if len(fs.Args()) != 1 {
+		usageLog.Fatalf("Invalid path %s", strings.Join(fs.Args(), ","))
+	}
+	path := fs.Arg(0)
+	infoLog.Printf("Verifying Certificate %s", path)
+
+	if *caOnly {
+		if problems := checkTrustAnchor(parseCert(path)); len(problems) > 0 {
+			errorLog.Fatalf("Certificate %s is not a valid trust anchor:\n\t%s", path, strings.Join(problems, "\n\t"))
+		}
+		fmt.Printf("OK: %s is a valid trust anchor\n", path)
+		return
+	}
+
+	chain := parseCertChain(filepath.Join(path, filepath.Base(path)+".crt"))
+	var roots *x509.CertPool
+	if *systemRoots {
+		// on windows and macos the pool defers to the platform verifier
+		if roots, err = x509.SystemCertPool(); err != nil {
+			infoLog.Printf("WARNING: failed to load the system roots (%s), using the default verifier\n", err)
+			roots = nil
+		}
+	} else {
+		roots = x509.NewCertPool()
+		for _, cert := range parseCertChain(filepath.Join(path, "ca.pem")) {
+			roots.AddCert(cert)
+		}
+	}
+	intermediates := x509.NewCertPool()
+	if *chainFile != "" {
+		chain = append(chain[:1], parseCertChain(*chainFile)...)
+	}
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err = chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   runTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		errorLog.Fatalf("Failed to verify certificate %s: %s", path, err)
+	}
+	fmt.Printf("OK: %s\n", path)
+}
+
+// checkTrustAnchor returns a list of reasons the certificate isn't
+// suitable for distribution as a root trust anchor
+func checkTrustAnchor(cert *x509.Certificate) []string {
+	problems := []string{}
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		problems = append(problems, "issuer "+formatDn(cert.Issuer)+" is not the same as the subject "+formatDn(cert.Subject))
+	} else if err := cert.CheckSignatureFrom(cert); err != nil {
+		problems = append(problems, "signature does not verify with its own public key: "+err.Error())
+	}
+	if !cert.BasicConstraintsValid || !cert.IsCA {
+		problems = append(problems, "not a certificate authority")
+	}
+	if cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		problems = append(problems, "missing the keyCertSign key usage")
+	}
+	if runTime.Before(cert.NotBefore) {
+		problems = append(problems, "not valid until "+cert.NotBefore.UTC().String())
+	} else if runTime.After(cert.NotAfter) {
+		problems = append(problems, "expired on "+cert.NotAfter.UTC().String())
+	}
+	return problems
+}
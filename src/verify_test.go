@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestVerifyTrustAnchor(t *testing.T) {
+	dir := newTree(t)
+	tests := []struct {
+		path    string
+		problem string
+	}{
+		{"ca", ""},
+		{"ca/ica", "is not the same as the subject"},
+		{"ca/ica/server", "not a certificate authority"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res := runCertshop(t, dir, nil, "verify", "-ca-only", tt.path)
+			if tt.problem == "" && res.code != 0 {
+				t.Errorf("the root isn't a valid trust anchor: %s", res.stderr)
+			} else if tt.problem != "" && (res.code == 0 || !strings.Contains(res.stderr, tt.problem)) {
+				t.Errorf("got status %d, want a failure reporting %q: %s", res.code, tt.problem, res.stderr)
+			}
+		})
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	dir := newTree(t)
+	other := t.TempDir()
+	certshop(t, other, "ca", "-dn=/CN=other")
+	// a leaf handed over without its chain, which only verifies with an
+	// explicit "-chain"
+	certshop(t, dir, "ica", "-dn=/CN=ica2", "ca/ica2")
+	leaf := filepath.Join("handed", "server")
+	if err := os.MkdirAll(filepath.Join(dir, leaf), 0755); err != nil {
+		t.Fatal(err)
+	}
+	server, err := os.ReadFile(filepath.Join(dir, "ca/ica/server/server.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(server)
+	if err = os.WriteFile(filepath.Join(dir, leaf, "server.crt"), pem.EncodeToMemory(block), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root, err := os.ReadFile(filepath.Join(dir, "ca/ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, leaf, "ca.pem"), root, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"ca/ica/server"}, true},
+		{[]string{"ca/ica"}, true},
+		{[]string{"-chain=" + other + "/ca/ca.crt", "ca/ica/server"}, false},
+		{[]string{leaf}, false},
+		{[]string{"-chain=ca/ica/ica.crt", leaf}, true},
+		{[]string{"-chain=ca/ica2/ica2.crt", leaf}, false},
+		{[]string{"-chain=" + other + "/ca/ca.crt", leaf}, false},
+	}
+	for _, tt := range tests {
+		res := runCertshop(t, dir, nil, append([]string{"verify"}, tt.args...)...)
+		if (res.code == 0) != tt.ok {
+			t.Errorf("verify %s: got status %d: %s", strings.Join(tt.args, " "), res.code, res.stderr)
+		}
+	}
+}
+
+func TestVerifySystemRoots(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SSL_CERT_FILE only selects the system roots on linux")
+	}
+	dir := newTree(t)
+	other := t.TempDir()
+	certshop(t, other, "ca", "-dn=/CN=other")
+	tests := []struct {
+		name  string
+		roots string
+		ok    bool
+	}{
+		{"trusted", filepath.Join(dir, "ca", "ca.crt"), true},
+		{"untrusted", filepath.Join(other, "ca", "ca.crt"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SSL_CERT_FILE", tt.roots)
+			t.Setenv("SSL_CERT_DIR", t.TempDir())
+			res := runCertshop(t, dir, nil, "verify", "-system-roots", "ca/ica/server")
+			if (res.code == 0) != tt.ok {
+				t.Errorf("got status %d with the system roots %s: %s", res.code, tt.roots, res.stderr)
+			}
+		})
+	}
+}